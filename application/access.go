@@ -0,0 +1,233 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reasons access of a user with valid credentials is refused.
+var (
+	ErrAccountDisabled     = errors.New("account disabled")
+	ErrAccountExpired      = errors.New("account expired")
+	ErrOutsideUploadWindow = errors.New("outside upload window")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// UploadWindow is a time of day range, on some weekdays, when user may
+// upload. Times are in server's time zone, End before Start spans midnight.
+type UploadWindow struct {
+	// Days are all days of the week when empty.
+	Days []time.Weekday
+	// Start and End are minutes since midnight.
+	Start int
+	End   int
+}
+
+// ParseUploadWindow parses "[<days>] HH:MM-HH:MM", where days are
+// comma-separated days or day ranges, ie. "mon-fri 08:00-18:00" or
+// "sat,sun 10:00-14:00".
+func ParseUploadWindow(s string) (UploadWindow, error) {
+	var window UploadWindow
+
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 || len(fields) > 2 {
+		return window, fmt.Errorf("upload window %q: use [<days>] HH:MM-HH:MM", s)
+	}
+
+	if len(fields) == 2 {
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return window, fmt.Errorf("upload window %q: %v", s, err)
+		}
+
+		window.Days = days
+	}
+
+	times := strings.Split(fields[len(fields)-1], "-")
+	if len(times) != 2 {
+		return window, fmt.Errorf("upload window %q: use [<days>] HH:MM-HH:MM", s)
+	}
+
+	var err error
+
+	window.Start, err = parseClock(times[0])
+	if err == nil {
+		window.End, err = parseClock(times[1])
+	}
+
+	if err != nil {
+		return window, fmt.Errorf("upload window %q: %v", s, err)
+	}
+
+	if window.Start == window.End {
+		return window, fmt.Errorf("upload window %q: empty time range", s)
+	}
+
+	return window, nil
+}
+
+func parseDays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.Split(part, "-")
+
+		first, ok := weekdays[bounds[0]]
+		if !ok || len(bounds) > 2 {
+			return nil, fmt.Errorf("unknown day %q", part)
+		}
+
+		last := first
+		if len(bounds) == 2 {
+			last, ok = weekdays[bounds[1]]
+			if !ok {
+				return nil, fmt.Errorf("unknown day %q", part)
+			}
+		}
+
+		for day := first; ; day = (day + 1) % 7 {
+			days = append(days, day)
+
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("time %q is not HH:MM", s)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t is inside the window. Part of a window after
+// midnight belongs to the day it started on.
+func (w UploadWindow) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End && w.onDay(day)
+	}
+
+	if minute >= w.Start {
+		return w.onDay(day)
+	}
+
+	return minute < w.End && w.onDay((day+6)%7)
+}
+
+func (w UploadWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w UploadWindow) String() string {
+	clock := fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+
+	if len(w.Days) == 0 {
+		return clock
+	}
+
+	name := func(day time.Weekday) string {
+		return strings.ToLower(day.String()[:3])
+	}
+
+	// runs of three and more days are shown as ranges, ie. "mon-fri"
+	var days []string
+	for i := 0; i < len(w.Days); {
+		j := i
+		for j+1 < len(w.Days) && w.Days[j+1] == (w.Days[j]+1)%7 {
+			j++
+		}
+
+		switch {
+		case j-i >= 2:
+			days = append(days, name(w.Days[i])+"-"+name(w.Days[j]))
+		case j > i:
+			days = append(days, name(w.Days[i]), name(w.Days[j]))
+		default:
+			days = append(days, name(w.Days[i]))
+		}
+
+		i = j + 1
+	}
+
+	return strings.Join(days, ",") + " " + clock
+}
+
+// ParseExpiry parses account expiry, "never" for zero time, a date for the
+// end of that day or RFC 3339 time.
+func ParseExpiry(value string) (time.Time, error) {
+	if value == "never" {
+		return time.Time{}, nil
+	}
+
+	if day, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return day.AddDate(0, 0, 1), nil
+	}
+
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expiry %q is not YYYY-MM-DD, RFC 3339 time or never", value)
+	}
+
+	return expires, nil
+}
+
+// CheckAccess returns reason user with valid credentials may not use the
+// server at the time, nil if access is allowed. Upload windows are checked
+// separately, they only limit uploads.
+func (u *UserAuth) CheckAccess(now time.Time) error {
+	if u.Disabled {
+		return ErrAccountDisabled
+	}
+
+	if !u.Expires.IsZero() && !now.Before(u.Expires) {
+		return ErrAccountExpired
+	}
+
+	return nil
+}
+
+// CheckUploadWindow returns ErrOutsideUploadWindow when user may not upload
+// at the time.
+func (u *UserAuth) CheckUploadWindow(now time.Time) error {
+	if len(u.UploadWindows) == 0 {
+		return nil
+	}
+
+	for _, w := range u.UploadWindows {
+		if w.Contains(now) {
+			return nil
+		}
+	}
+
+	return ErrOutsideUploadWindow
+}
@@ -0,0 +1,78 @@
+package application
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUploadWindow(t *testing.T) {
+	// 2026-10-19 is a Monday
+	at := func(day int, clock string) time.Time {
+		c, _ := time.Parse("15:04", clock)
+		return time.Date(2026, 10, day, c.Hour(), c.Minute(), 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		window string
+		at     time.Time
+		in     bool
+	}{
+		{"08:00-18:00", at(19, "08:00"), true},
+		{"08:00-18:00", at(19, "18:00"), false},
+		{"mon-fri 08:00-18:00", at(23, "12:00"), true},
+		{"mon-fri 08:00-18:00", at(24, "12:00"), false},
+		{"sat,sun 10:00-14:00", at(25, "13:59"), true},
+		{"fri-mon 10:00-14:00", at(20, "11:00"), false},
+		{"fri-mon 10:00-14:00", at(19, "11:00"), true},
+		// overnight part belongs to the day the window started
+		{"fri 22:00-06:00", at(24, "05:00"), true},
+		{"fri 22:00-06:00", at(23, "05:00"), false},
+	}
+
+	for _, test := range tests {
+		window, err := ParseUploadWindow(test.window)
+		if err != nil {
+			t.Error("Error while running test", err)
+			continue
+		}
+
+		if window.Contains(test.at) != test.in {
+			t.Errorf("%q contains %s: expected %t", test.window, test.at.Format(time.RFC1123), test.in)
+		}
+	}
+
+	for _, invalid := range []string{"", "8-18", "mon-fri", "xyz 08:00-18:00", "10:00-10:00", "mon 08:00-25:00"} {
+		if _, err := ParseUploadWindow(invalid); err == nil {
+			t.Errorf("Expected %q not valid", invalid)
+		}
+	}
+
+	for spec, expected := range map[string]string{
+		"Mon-Wed 8:00-18:30":      "mon-wed 08:00-18:30",
+		"sat,sun 10:00-14:00":     "sat,sun 10:00-14:00",
+		"fri-mon,wed 22:00-06:00": "fri-mon,wed 22:00-06:00",
+	} {
+		if window, _ := ParseUploadWindow(spec); window.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, window.String())
+		}
+	}
+}
+
+func TestUploadWindowLimitsUploadsOnly(t *testing.T) {
+	window, _ := ParseUploadWindow("08:00-18:00")
+	userAuth := &UserAuth{Username: "alice", UploadWindows: []UploadWindow{window}}
+
+	night := time.Date(2026, 10, 19, 22, 0, 0, 0, time.Local)
+
+	if err := userAuth.CheckAccess(night); err != nil {
+		t.Error("Expected access outside upload window allowed, got", err)
+	}
+
+	if err := userAuth.CheckUploadWindow(night); err != ErrOutsideUploadWindow {
+		t.Errorf("Expected ErrOutsideUploadWindow, got %v", err)
+	}
+
+	if err := userAuth.CheckUploadWindow(night.Add(-10 * time.Hour)); err != nil {
+		t.Error("Expected upload in window allowed, got", err)
+	}
+}
@@ -0,0 +1,126 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Scanner interface {
+	Scan(r io.Reader) (*ScanResult, error)
+}
+
+// AntivirusProcessor scans closed files and moves infected ones out of the
+// user folder into the quarantine directory. Verdict is recorded in the file
+// metadata either way.
+type AntivirusProcessor struct {
+	scanner    Scanner
+	quarantine string
+	store      FileStore
+	metadata   FileMetadataRepository
+}
+
+func NewAntivirusProcessor(scanner Scanner, quarantine string, store FileStore,
+	metadata FileMetadataRepository) (*AntivirusProcessor, error) {
+	if quarantine == "" {
+		return nil, fmt.Errorf("processor antivirus: quarantine path not set")
+	}
+
+	return &AntivirusProcessor{
+		scanner:    scanner,
+		quarantine: quarantine,
+		store:      store,
+		metadata:   metadata,
+	}, nil
+}
+
+func (p *AntivirusProcessor) Name() string {
+	return "antivirus"
+}
+
+func (p *AntivirusProcessor) Process(ctx context.Context, job *ProcessingJob) (string, error) {
+	f, err := os.Open(job.Path)
+	if err != nil {
+		return "", err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	result, err := p.scanner.Scan(f)
+	if err != nil {
+		return "", err
+	}
+
+	meta, err := readOrNewMetadata(p.metadata, job.Username, job.File)
+	if err != nil {
+		return "", err
+	}
+
+	meta.Size = job.Size
+	meta.Digest = job.Digest
+	meta.Scan = result
+	meta.Updated = time.Now()
+
+	err = p.metadata.Save(meta)
+	if err != nil {
+		return "", err
+	}
+
+	if !result.Infected {
+		return "clean", nil
+	}
+
+	dir := filepath.Join(p.quarantine, job.Username)
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := quarantineFile(job.Path, dir, job.File)
+	if err != nil {
+		return "", err
+	}
+
+	err = p.store.RemoveClosedFile(ctx, job.File)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("infected with %s, quarantined to %s", result.Signature, target), ErrSkipRemaining
+}
+
+// quarantineFile copies infected file into dir under the first version of its
+// name not quarantined yet, earlier copies are never replaced. The name is
+// reserved by creating the file, so concurrent jobs don't pick the same one.
+func quarantineFile(from, dir, file string) (string, error) {
+	var target string
+
+	_, err := nextVersionName(file, func(name string) (bool, error) {
+		target = filepath.Join(dir, StorageFileName(name))
+
+		reserved, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if os.IsExist(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		return false, reserved.Close()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = copyFile(from, target)
+	if err != nil {
+		_ = os.Remove(target)
+		return "", err
+	}
+
+	return target, nil
+}
@@ -0,0 +1,242 @@
+package application
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Audited actions, events of files and refused access keep their event type.
+const (
+	AuditUserCreated        = "user.created"
+	AuditUserDeleted        = "user.deleted"
+	AuditPasswordChanged    = "user.password_changed"
+	AuditRoleChanged        = "user.role_changed"
+	AuditUserDisabled       = "user.disabled"
+	AuditUserEnabled        = "user.enabled"
+	AuditExpiryChanged      = "user.expiry_changed"
+	AuditWindowsChanged     = "user.upload_windows_changed"
+	AuditUsersExported      = "users.exported"
+	AuditProjectCreated     = "project.created"
+	AuditProjectDeleted     = "project.deleted"
+	AuditMemberAdded        = "project.member_added"
+	AuditMemberRemoved      = "project.member_removed"
+	AuditBackupWritten      = "database.backup_written"
+	AuditCertificateIssued  = "certificate.issued"
+	AuditCertificateRevoked = "certificate.revoked"
+)
+
+// auditHashVersion is hashed with entries, so the hashed fields can change
+// without breaking existing chains.
+const auditHashVersion = 1
+
+var ErrAuditSequence = errors.New("audit entry out of sequence")
+var ErrAuditDisabled = errors.New("audit log is not enabled")
+
+// AuditEntry is a record of who did what and when. Every entry includes hash
+// of the previous one, so editing, removing or inserting entries breaks the
+// chain.
+type AuditEntry struct {
+	// Seq numbers entries from 1 without gaps.
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Actor is username of uploader, or operator of admin commands.
+	Actor   string `json:"actor"`
+	Action  string `json:"action"`
+	Subject string `json:"subject"`
+	Detail  string `json:"detail"`
+	// PrevHash is Hash of the previous entry, empty for the first one.
+	PrevHash string `json:"prev_hash"`
+	// Hash is hex encoded SHA-256 of all other fields.
+	Hash string `json:"hash"`
+}
+
+type AuditRepository interface {
+	// Append stores entry after the last one, failing with ErrAuditSequence
+	// if its Seq doesn't follow. Entries are never changed.
+	Append(entry *AuditEntry) error
+	// Last returns the last entry, nil if there are none.
+	Last() (*AuditEntry, error)
+	// List returns entries from Seq from in order, at most limit of them if
+	// limit is positive.
+	List(from uint64, limit int) <-chan AuditEntry
+}
+
+// ComputeHash returns hash of the entry, fields are JSON encoded so their
+// boundaries are unambiguous.
+func (e *AuditEntry) ComputeHash() string {
+	fields, _ := json.Marshal([]interface{}{
+		auditHashVersion,
+		e.Seq,
+		e.Time.UTC().Format(time.RFC3339Nano),
+		e.Actor,
+		e.Action,
+		e.Subject,
+		e.Detail,
+		e.PrevHash,
+	})
+
+	sum := sha256.Sum256(fields)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditChainError tells which entry breaks the chain.
+type AuditChainError struct {
+	Seq    uint64
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit entry %d: %s", e.Seq, e.Reason)
+}
+
+// AuditChain verifies entries appended in order, starting from the first.
+type AuditChain struct {
+	// Head is the last verified entry.
+	Head *AuditEntry
+}
+
+// Append verifies entry follows Head, returning *AuditChainError if not.
+func (c *AuditChain) Append(entry AuditEntry) error {
+	seq, prevHash := uint64(1), ""
+	if c.Head != nil {
+		seq, prevHash = c.Head.Seq+1, c.Head.Hash
+	}
+
+	switch {
+	case entry.Seq != seq:
+		return &AuditChainError{Seq: entry.Seq, Reason: fmt.Sprintf("expected entry %d, entries were removed or reordered", seq)}
+	case entry.PrevHash != prevHash:
+		return &AuditChainError{Seq: entry.Seq, Reason: "previous hash doesn't match, entries before were changed"}
+	case entry.Hash != entry.ComputeHash():
+		return &AuditChainError{Seq: entry.Seq, Reason: "hash doesn't match, entry was changed"}
+	}
+
+	c.Head = &entry
+
+	return nil
+}
+
+// AuditLog appends hash-chained entries to the repository.
+type AuditLog struct {
+	// mu serializes appends, so every entry links to the one before
+	mu     sync.Mutex
+	repo   AuditRepository
+	last   *AuditEntry
+	logger *zap.Logger
+}
+
+func NewAuditLog(repo AuditRepository, logger *zap.Logger) (*AuditLog, error) {
+	last, err := repo.Last()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditLog{
+		repo:   repo,
+		last:   last,
+		logger: logger,
+	}, nil
+}
+
+// Record appends entry, failure is logged as the recorded action already
+// happened. It's safe to call on a nil log, which records nothing.
+func (l *AuditLog) Record(actor, action, subject, detail string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := &AuditEntry{
+		Seq:     1,
+		Time:    time.Now().UTC(),
+		Actor:   actor,
+		Action:  action,
+		Subject: subject,
+		Detail:  detail,
+	}
+
+	if l.last != nil {
+		entry.Seq = l.last.Seq + 1
+		entry.PrevHash = l.last.Hash
+	}
+
+	entry.Hash = entry.ComputeHash()
+
+	err := l.repo.Append(entry)
+	if err != nil {
+		l.logger.Error("Error while writing audit log",
+			zap.String("actor", actor), zap.String("action", action), zap.String("subject", subject), zap.Error(err))
+		return
+	}
+
+	l.last = entry
+}
+
+// Handle records uploads, closed and deleted files and refused access.
+func (l *AuditLog) Handle(e Event) {
+	switch e.Type {
+	case EventUploadStarted, EventFileClosed, EventFileDeleted:
+		l.Record(e.Username, string(e.Type), e.Owner()+"/"+e.File, "")
+	case EventAccessRefused:
+		l.Record(e.Username, string(e.Type), e.Username, e.Reason)
+	}
+}
+
+// List returns entries from Seq from, at most limit of them if limit is
+// positive.
+func (l *AuditLog) List(from uint64, limit int) []AuditEntry {
+	var entries []AuditEntry
+
+	for entry := range l.repo.List(from, limit) {
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// LastSeq returns Seq of the last entry, 0 if there are none.
+func (l *AuditLog) LastSeq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.last == nil {
+		return 0
+	}
+
+	return l.last.Seq
+}
+
+// Verify checks the whole chain, returning its last entry.
+func (l *AuditLog) Verify() (*AuditEntry, error) {
+	// entries at the end could be removed from the database without breaking
+	// the chain, but not the last one written since start
+	lastSeq := l.LastSeq()
+
+	var chain AuditChain
+	var err error
+
+	for entry := range l.repo.List(1, 0) {
+		if err == nil {
+			err = chain.Append(entry)
+		}
+	}
+
+	if err != nil {
+		return chain.Head, err
+	}
+
+	if chain.Head == nil && lastSeq > 0 || chain.Head != nil && chain.Head.Seq < lastSeq {
+		return chain.Head, &AuditChainError{Seq: lastSeq, Reason: "entry missing, log was truncated"}
+	}
+
+	return chain.Head, nil
+}
@@ -0,0 +1,145 @@
+package application
+
+import (
+	"go.uber.org/zap/zaptest"
+	"sync"
+	"testing"
+)
+
+// memAuditRepo keeps entries in a slice, tests edit them directly.
+type memAuditRepo struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (r *memAuditRepo) Append(entry *AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry.Seq != uint64(len(r.entries))+1 {
+		return ErrAuditSequence
+	}
+
+	r.entries = append(r.entries, *entry)
+
+	return nil
+}
+
+func (r *memAuditRepo) Last() (*AuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.entries) == 0 {
+		return nil, nil
+	}
+
+	last := r.entries[len(r.entries)-1]
+
+	return &last, nil
+}
+
+func (r *memAuditRepo) List(from uint64, limit int) <-chan AuditEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make(chan AuditEntry, len(r.entries))
+
+	for _, entry := range r.entries {
+		if entry.Seq >= from && (limit <= 0 || len(out) < limit) {
+			out <- entry
+		}
+	}
+
+	close(out)
+
+	return out
+}
+
+func newTestAuditLog(t *testing.T) (*AuditLog, *memAuditRepo) {
+	repo := &memAuditRepo{}
+
+	log, err := NewAuditLog(repo, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	log.Record("local:root", AuditUserCreated, "alice", "")
+	log.Handle(Event{Type: EventUploadStarted, Username: "alice", File: "a.mp4"})
+	log.Handle(Event{Type: EventFileClosed, Username: "alice", Project: "case", File: "a.mp4"})
+	log.Record("local:root", AuditUserDeleted, "alice", "")
+
+	return log, repo
+}
+
+func TestAuditLog(t *testing.T) {
+	log, repo := newTestAuditLog(t)
+
+	head, err := log.Verify()
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if head.Seq != 4 || head.Hash != repo.entries[3].Hash {
+		t.Errorf("Expected head 4 %s, got %d %s", repo.entries[3].Hash, head.Seq, head.Hash)
+	}
+
+	if subject := repo.entries[2].Subject; subject != "@case/a.mp4" {
+		t.Errorf("Expected subject of project file, got %q", subject)
+	}
+
+	entries := log.List(2, 2)
+	if len(entries) != 2 || entries[0].Seq != 2 || entries[1].Seq != 3 {
+		t.Errorf("Expected entries 2 and 3, got %v", entries)
+	}
+
+	// log opened again continues the chain
+	reopened, err := NewAuditLog(repo, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	reopened.Record("local:root", AuditUserCreated, "bob", "")
+
+	if _, err := reopened.Verify(); err != nil {
+		t.Error("Expected chain continued, got", err)
+	}
+}
+
+func TestAuditLogTampering(t *testing.T) {
+	tampers := map[string]func(r *memAuditRepo){
+		"edited": func(r *memAuditRepo) {
+			r.entries[1].Actor = "bob"
+		},
+		"edited with hash": func(r *memAuditRepo) {
+			r.entries[1].Actor = "bob"
+			r.entries[1].Hash = r.entries[1].ComputeHash()
+		},
+		"removed": func(r *memAuditRepo) {
+			r.entries = append(r.entries[:1], r.entries[2:]...)
+		},
+		"renumbered": func(r *memAuditRepo) {
+			r.entries = append(r.entries[:1], r.entries[2:]...)
+			for i := 1; i < len(r.entries); i++ {
+				r.entries[i].Seq = uint64(i + 1)
+				r.entries[i].Hash = r.entries[i].ComputeHash()
+			}
+		},
+		"truncated": func(r *memAuditRepo) {
+			r.entries = r.entries[:3]
+		},
+		"emptied": func(r *memAuditRepo) {
+			r.entries = nil
+		},
+	}
+
+	for name, tamper := range tampers {
+		log, repo := newTestAuditLog(t)
+
+		tamper(repo)
+
+		_, err := log.Verify()
+		if _, ok := err.(*AuditChainError); !ok {
+			t.Errorf("%s: expected AuditChainError, got %v", name, err)
+		}
+	}
+}
@@ -3,28 +3,71 @@ package application
 import (
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"sync"
+	"time"
 )
 
 type AuthManager struct {
 	logger   *zap.Logger
 	authRepo AuthRepository
+	events   *EventBus
+	// mu guards policy and hasher, changed by config reload
+	mu     sync.RWMutex
+	policy PasswordPolicy
+	hasher PasswordHasher
 }
 
 type AuthRepository interface {
 	Create(u *UserAuth) error
+	// CreateAll creates users atomically, failing with ErrUsernameExists.
+	CreateAll(users []*UserAuth) error
 	Read(username string) (*UserAuth, error)
 	Update(user *UserAuth) error
 	Delete(username string) error
 	List() <-chan UserAuth
 }
 
-func NewAuthManager(logger *zap.Logger, authRepo AuthRepository) *AuthManager {
+func NewAuthManager(logger *zap.Logger, authRepo AuthRepository, events *EventBus) *AuthManager {
 	return &AuthManager{
 		logger:   logger,
 		authRepo: authRepo,
+		events:   events,
+		policy:   DefaultPasswordPolicy(),
+		hasher:   &bcryptHasher{cost: bcrypt.DefaultCost},
 	}
 }
 
+// SetPasswordPolicy replaces policy new passwords are checked against.
+func (m *AuthManager) SetPasswordPolicy(policy PasswordPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.policy = policy
+}
+
+// SetPasswordHasher replaces hasher of new passwords. Existing hashes are
+// upgraded on next successful login.
+func (m *AuthManager) SetPasswordHasher(hasher PasswordHasher) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hasher = hasher
+}
+
+func (m *AuthManager) passwordHasher() PasswordHasher {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.hasher
+}
+
+func (m *AuthManager) passwordPolicy() PasswordPolicy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.policy
+}
+
 func (m *AuthManager) HasUsername(username string) (bool, error) {
 	userAuth, err := m.authRepo.Read(username)
 	if err != nil {
@@ -34,20 +77,195 @@ func (m *AuthManager) HasUsername(username string) (bool, error) {
 	return userAuth != nil, nil
 }
 
+// AddUser creates user, failing with ErrUsernameExists for existing users.
+func (m *AuthManager) AddUser(username, password string) error {
+	if !ValidUsername(username) {
+		return ErrUsernameNotValid
+	}
+
+	exists, err := m.HasUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrUsernameExists
+	}
+
+	return m.SetPassword(username, password)
+}
+
+// ChangePassword sets password of existing user, failing with
+// ErrUsernameNotFound for unknown users.
+func (m *AuthManager) ChangePassword(username, password string) error {
+	if !ValidUsername(username) {
+		return ErrUsernameNotValid
+	}
+
+	exists, err := m.HasUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrUsernameNotFound
+	}
+
+	return m.SetPassword(username, password)
+}
+
+// SetPassword creates user or changes their password, rejecting passwords
+// not accepted by the password policy with *PasswordPolicyError.
 func (m *AuthManager) SetPassword(username, password string) error {
+	err := m.passwordPolicy().Check(username, password)
+	if err != nil {
+		return err
+	}
+
+	existing, err := m.authRepo.Read(username)
+	if err != nil {
+		return err
+	}
+
 	hash, err := m.hashPassword(password)
 	if err != nil {
 		return err
 	}
 
-	return m.authRepo.Create(&UserAuth{
+	if existing != nil {
+		existing.PasswordHash = hash
+
+		return m.authRepo.Update(existing)
+	}
+
+	err = m.authRepo.Create(&UserAuth{
 		Username:     username,
 		PasswordHash: hash,
+		Role:         RoleUploader,
+	})
+	if err != nil {
+		return err
+	}
+
+	m.events.Publish(Event{Type: EventUserCreated, Username: username})
+
+	return nil
+}
+
+// SetRole changes role of existing user.
+func (m *AuthManager) SetRole(username, role string) error {
+	if !ValidRole(role) {
+		return ErrRoleNotValid
+	}
+
+	return m.update(username, func(userAuth *UserAuth) {
+		userAuth.Role = role
+	})
+}
+
+// SetDisabled suspends or restores account, disabled users keep their files.
+func (m *AuthManager) SetDisabled(username string, disabled bool) error {
+	return m.update(username, func(userAuth *UserAuth) {
+		userAuth.Disabled = disabled
+	})
+}
+
+// SetExpiry sets when account expires, zero time for never.
+func (m *AuthManager) SetExpiry(username string, expires time.Time) error {
+	return m.update(username, func(userAuth *UserAuth) {
+		userAuth.Expires = expires
+	})
+}
+
+// SetUploadWindows limits when user may use the server, no windows for any
+// time.
+func (m *AuthManager) SetUploadWindows(username string, windows []UploadWindow) error {
+	return m.update(username, func(userAuth *UserAuth) {
+		userAuth.UploadWindows = windows
 	})
 }
 
+// GetUserAuth returns user record, nil for unknown users.
+func (m *AuthManager) GetUserAuth(username string) (*UserAuth, error) {
+	return m.authRepo.Read(username)
+}
+
+// CheckAccess returns why authenticated user is refused now, publishing the
+// refusal, or nil if access is allowed.
+func (m *AuthManager) CheckAccess(username string) error {
+	return m.checkUser(username, (*UserAuth).CheckAccess)
+}
+
+// CheckUploadWindow returns ErrOutsideUploadWindow, publishing the refusal,
+// when user may not upload now.
+func (m *AuthManager) CheckUploadWindow(username string) error {
+	return m.checkUser(username, (*UserAuth).CheckUploadWindow)
+}
+
+func (m *AuthManager) checkUser(username string, check func(userAuth *UserAuth, now time.Time) error) error {
+	userAuth, err := m.authRepo.Read(username)
+	if err != nil {
+		return err
+	}
+
+	if userAuth == nil {
+		return ErrUsernameNotFound
+	}
+
+	err = check(userAuth, time.Now())
+	if err != nil {
+		m.logger.Warn("Access refused", zap.String("username", username), zap.String("reason", err.Error()))
+		m.events.Publish(Event{Type: EventAccessRefused, Username: username, Reason: err.Error()})
+	}
+
+	return err
+}
+
+// update changes existing user record.
+func (m *AuthManager) update(username string, change func(userAuth *UserAuth)) error {
+	userAuth, err := m.authRepo.Read(username)
+	if err != nil {
+		return err
+	}
+
+	if userAuth == nil {
+		return ErrUsernameNotFound
+	}
+
+	change(userAuth)
+
+	return m.authRepo.Update(userAuth)
+}
+
+// GetUser returns user with the role, nil for unknown users.
+func (m *AuthManager) GetUser(username string) (*User, error) {
+	userAuth, err := m.authRepo.Read(username)
+	if userAuth == nil || err != nil {
+		return nil, err
+	}
+
+	return &User{Username: userAuth.Username, Role: userAuth.UserRole()}, nil
+}
+
+// Delete removes user, failing with ErrUsernameNotFound for unknown users.
 func (m *AuthManager) Delete(username string) error {
-	return m.authRepo.Delete(username)
+	exists, err := m.HasUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrUsernameNotFound
+	}
+
+	err = m.authRepo.Delete(username)
+	if err != nil {
+		return err
+	}
+
+	m.events.Publish(Event{Type: EventUserDeleted, Username: username})
+
+	return nil
 }
 
 func (m *AuthManager) ListUsernames() ([]string, error) {
@@ -60,25 +278,56 @@ func (m *AuthManager) ListUsernames() ([]string, error) {
 	return usernames, nil
 }
 
+// ListUsers returns records of all users.
+func (m *AuthManager) ListUsers() []UserAuth {
+	var users []UserAuth
+
+	for userAuth := range m.authRepo.List() {
+		users = append(users, userAuth)
+	}
+
+	return users
+}
+
 func (m *AuthManager) CheckPassword(username, password string) (bool, error) {
 	userAuth, err := m.authRepo.Read(username)
 	if userAuth == nil || err != nil {
 		return false, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(userAuth.PasswordHash), []byte(password))
-	if err != nil {
+	ok, err := VerifyPasswordHash(userAuth.PasswordHash, password)
+	if !ok || err != nil {
 		return false, err
 	}
 
+	if m.passwordHasher().Outdated(userAuth.PasswordHash) {
+		m.rehash(userAuth, password)
+	}
+
 	return true, nil
 }
 
-func (m *AuthManager) hashPassword(plain string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+// rehash replaces outdated hash of verified password, login succeeds even if
+// the upgrade fails.
+func (m *AuthManager) rehash(userAuth *UserAuth, password string) {
+	hash, err := m.hashPassword(password)
+	if err == nil {
+		err = m.update(userAuth.Username, func(current *UserAuth) {
+			// password changed meanwhile
+			if current.PasswordHash == userAuth.PasswordHash {
+				current.PasswordHash = hash
+			}
+		})
+	}
+
 	if err != nil {
-		return "", err
+		m.logger.Error("Error while upgrading password hash", zap.String("username", userAuth.Username), zap.Error(err))
+		return
 	}
 
-	return string(hash), nil
+	m.logger.Info("Password hash upgraded", zap.String("username", userAuth.Username))
+}
+
+func (m *AuthManager) hashPassword(plain string) (string, error) {
+	return m.passwordHasher().Hash(plain)
 }
@@ -0,0 +1,45 @@
+package application
+
+import (
+	"go.uber.org/zap/zaptest"
+	"testing"
+)
+
+func TestDeleteUser(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	events := NewEventBus(logger)
+
+	var deleted []string
+
+	events.Subscribe(func(e Event) {
+		if e.Type == EventUserDeleted {
+			deleted = append(deleted, e.Username)
+		}
+	})
+
+	am := NewAuthManager(logger, &memAuthRepo{users: map[string]UserAuth{}}, events)
+
+	if err := am.AddUser("alice", testPassword); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := am.Delete("nobody"); err != ErrUsernameNotFound {
+		t.Errorf("Expected ErrUsernameNotFound, got %v", err)
+	}
+
+	if err := am.Delete("alice"); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if exists, _ := am.HasUsername("alice"); exists {
+		t.Error("Expected user deleted")
+	}
+
+	if err := am.Delete("alice"); err != ErrUsernameNotFound {
+		t.Errorf("Expected ErrUsernameNotFound, got %v", err)
+	}
+
+	if len(deleted) != 1 || deleted[0] != "alice" {
+		t.Errorf("Expected one deleted event for alice, got %v", deleted)
+	}
+}
@@ -0,0 +1,142 @@
+package application
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const clamdChunkSize = 64 * 1024
+
+type ScanResult struct {
+	Infected  bool
+	Signature string
+	Scanner   string
+	Time      time.Time
+}
+
+// ClamdClient scans data with clamd using the INSTREAM command.
+type ClamdClient struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdClient accepts clamd address as tcp://host:port or
+// unix:///path/to/clamd.sock URL.
+func NewClamdClient(address string, timeout time.Duration) (*ClamdClient, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &ClamdClient{
+		network: u.Scheme,
+		timeout: timeout,
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		client.address = u.Host
+	case "unix":
+		client.address = u.Path
+	default:
+		return nil, fmt.Errorf("unsupported clamd address %q", address)
+	}
+
+	if client.timeout <= 0 {
+		client.timeout = 2 * time.Minute
+	}
+
+	return client, nil
+}
+
+func (c *ClamdClient) Scan(r io.Reader) (*ScanResult, error) {
+	conn, err := net.DialTimeout(c.network, c.address, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(c.timeout))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeChunks(conn, r)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// writeChunks sends data as length prefixed chunks terminated by zero length
+// chunk.
+func writeChunks(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 4+clamdChunkSize)
+
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+
+	return err
+}
+
+// parseClamdReply parses "stream: OK", "stream: <signature> FOUND" and
+// "<message> ERROR" replies.
+func parseClamdReply(reply string) (*ScanResult, error) {
+	result := &ScanResult{
+		Scanner: "clamd",
+		Time:    time.Now().UTC(),
+	}
+
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return result, nil
+
+	case strings.HasSuffix(reply, " FOUND"):
+		result.Infected = true
+		result.Signature = strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return result, nil
+
+	case strings.HasSuffix(reply, " ERROR"):
+		return nil, fmt.Errorf("clamd: %s", strings.TrimSuffix(reply, " ERROR"))
+	}
+
+	return nil, fmt.Errorf("unexpected clamd reply %q", reply)
+}
@@ -0,0 +1,230 @@
+package application
+
+import (
+	"bytes"
+	"encoding/binary"
+	"go.uber.org/zap/zaptest"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// split so the test source itself isn't flagged by scanners
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR` + `-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// startFakeClamd accepts INSTREAM sessions and reports streams containing
+// the EICAR test string as infected.
+func startFakeClamd(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveFakeClamd(conn)
+		}
+	}()
+
+	return "tcp://" + listener.Addr().String()
+}
+
+func serveFakeClamd(conn net.Conn) {
+	//noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	command := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(conn, command); err != nil || string(command) != "zINSTREAM\x00" {
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var data bytes.Buffer
+
+	for {
+		var size uint32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+
+		if size == 0 {
+			break
+		}
+
+		if _, err := io.CopyN(&data, conn, int64(size)); err != nil {
+			return
+		}
+	}
+
+	if strings.Contains(data.String(), eicar) {
+		_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+
+	_, _ = conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamdClient_Scan(t *testing.T) {
+	client, err := NewClamdClient(startFakeClamd(t), time.Second)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	// clean data spanning several chunks
+	result, err := client.Scan(bytes.NewReader(make([]byte, 3*clamdChunkSize+10)))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	if result.Infected {
+		t.Errorf("Clean data reported as infected")
+	}
+
+	result, err = client.Scan(strings.NewReader("header " + eicar))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	if !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Errorf("Expected Eicar-Test-Signature, got %+v", result)
+	}
+}
+
+func TestAntivirusProcessor_Quarantine(t *testing.T) {
+	client, _ := NewClamdClient(startFakeClamd(t), time.Second)
+
+	quarantine, err := ioutil.TempDir("", "direct-upload-quarantine")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(quarantine)
+
+	store := NewMemoryFileStore(MemoryFileStoreConfig{}, nil, zaptest.NewLogger(t))
+	metadata := &memFileMetadataRepo{metadata: map[string]FileMetadata{}}
+
+	antivirus, err := NewAntivirusProcessor(client, quarantine, store, metadata)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	after := &flakyProcessor{}
+
+	pipeline := NewProcessingPipeline(ProcessingConfig{}, []Processor{antivirus, after}, store,
+		&memProcessingRepo{statuses: map[string]ProcessingStatus{}}, zaptest.NewLogger(t))
+
+	// second infected upload under the same name keeps the first one quarantined
+	for _, file := range []string{"clean.txt", "infected.txt", "infected.txt"} {
+		content := "nothing to see here"
+		if file == "infected.txt" {
+			content = eicar
+		}
+
+		_ = store.AppendFile(newCtx(), file, ioutil.NopCloser(strings.NewReader(content)))
+		_, _ = store.CloseFile(newCtx(), file)
+
+		pipeline.Handle(Event{Type: EventFileClosed, Username: UsernameTest, File: file})
+		pipeline.process(<-pipeline.queue)
+	}
+
+	if info, _ := store.GetFileInfo(newCtx(), "clean.txt"); info.Size == 0 {
+		t.Errorf("Clean file removed from user folder")
+	}
+
+	if _, err := store.OpenFile(newCtx(), "infected.txt"); err != ErrNotFound {
+		t.Errorf("Infected file left in user folder: %v", err)
+	}
+
+	for _, name := range []string{"infected.txt", "infected (2).txt"} {
+		data, err := ioutil.ReadFile(filepath.Join(quarantine, UsernameTest, StorageFileName(name)))
+		if err != nil || string(data) != eicar {
+			t.Errorf("Infected file not quarantined as %s: %v", name, err)
+		}
+	}
+
+	meta, _ := metadata.Read(UsernameTest, "infected.txt")
+	if meta == nil || meta.Scan == nil || !meta.Scan.Infected {
+		t.Errorf("Verdict not recorded: %+v", meta)
+	}
+
+	if after.calls != 1 {
+		t.Errorf("Expected steps after antivirus to run only for clean file, ran %d times", after.calls)
+	}
+}
+
+// TestAntivirusProcessor_QuarantineVersion makes sure infected version is
+// removed, not the upload or the versions before it.
+func TestAntivirusProcessor_QuarantineVersion(t *testing.T) {
+	client, _ := NewClamdClient(startFakeClamd(t), time.Second)
+
+	quarantine, err := ioutil.TempDir("", "direct-upload-quarantine")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(quarantine)
+
+	store := NewMemoryFileStore(MemoryFileStoreConfig{Collision: CollisionVersion}, nil, zaptest.NewLogger(t))
+	metadata := &memFileMetadataRepo{metadata: map[string]FileMetadata{}}
+
+	antivirus, err := NewAntivirusProcessor(client, quarantine, store, metadata)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	pipeline := NewProcessingPipeline(ProcessingConfig{}, []Processor{antivirus}, store,
+		&memProcessingRepo{statuses: map[string]ProcessingStatus{}}, zaptest.NewLogger(t))
+
+	for _, content := range []string{"nothing to see here", eicar} {
+		_ = store.AppendFile(newCtx(), "statement.txt", ioutil.NopCloser(strings.NewReader(content)))
+
+		closed, _ := store.CloseFile(newCtx(), "statement.txt")
+
+		pipeline.Handle(Event{Type: EventFileClosed, Username: UsernameTest, File: closed})
+		pipeline.process(<-pipeline.queue)
+	}
+
+	if _, err := store.OpenFile(newCtx(), "statement (2).txt"); err != ErrNotFound {
+		t.Errorf("Infected version left in user folder: %v", err)
+	}
+
+	if _, err := store.OpenFile(newCtx(), "statement.txt"); err != nil {
+		t.Errorf("Clean version removed from user folder: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(quarantine, UsernameTest, StorageFileName("statement (2).txt"))); err != nil {
+		t.Errorf("Infected version not quarantined: %v", err)
+	}
+}
+
+type memFileMetadataRepo struct {
+	metadata map[string]FileMetadata
+}
+
+func (r *memFileMetadataRepo) Save(meta *FileMetadata) error {
+	r.metadata[meta.Username+"/"+meta.File] = *meta
+	return nil
+}
+
+func (r *memFileMetadataRepo) Read(username, file string) (*FileMetadata, error) {
+	meta, ok := r.metadata[username+"/"+file]
+	if !ok {
+		return nil, nil
+	}
+	return &meta, nil
+}
+
+func (r *memFileMetadataRepo) Delete(username, file string) error {
+	delete(r.metadata, username+"/"+file)
+	return nil
+}
@@ -0,0 +1,56 @@
+package application
+
+// commonPasswordList are most used and leaked passwords, rejected by
+// PasswordPolicy regardless of case and of digits or symbols added around
+// them. Few are as long as DefaultPasswordMinLength, so operators should add
+// larger lists with password-policy.common-file.
+const commonPasswordList = `
+123456 password 12345678 qwerty 123456789 12345 1234 111111 1234567 dragon 123123 baseball abc123
+football monkey letmein 696969 shadow master 666666 qwertyuiop 123321 mustang 1234567890 michael
+654321 superman 1qaz2wsx 7777777 121212 000000 qazwsx 123qwe killer trustno1 jordan jennifer zxcvbnm
+asdfgh hunter buster soccer harley batman andrew tigger sunshine iloveyou 2000 charlie robert thomas
+hockey ranger daniel starwars klaster 112233 george computer michelle jessica pepper 1111 zxcvbn
+555555 11111111 131313 freedom 777777 pass maggie 159753 aaaaaa ginger princess joshua cheese amanda
+summer love ashley nicole chelsea matthew access yankees 987654321 dallas austin thunder taylor
+matrix mobilemail mom monitor monitoring montana moon moscow william corvette hello martin heather
+secret merlin diamond 1234qwer gfhjkm hammer silver 222222 88888888 anthony justin test bailey
+q1w2e3r4t5 patrick internet scooter orange 11111 golfer cookie richard samantha bigdog guitar
+jackson whatever mickey chicken sparky snoopy maverick phoenix camaro peanut morgan welcome falcon
+cowboy ferrari samsung andrea smokey steelers joseph mercedes dakota arsenal eagles melissa boomer
+booboo spider nascar monster tigers yellow xxxxxx 123123123 gateway marina diablo bulldog qwer1234
+compaq purple banana junior hannah 123654 porsche lakers iceman money cowboys 987654 london tennis
+999999 ncc1701 coffee scooby 0000 miller boston q1w2e3r4 brandon yamaha chester mother forever
+johnny edward 333333 oliver redsox player nikita knight fender barney midnight please brandy chicago
+badboy slayer rangers charles angel flower bigdaddy rabbit wizard jasper enter rachel chris steven
+winner adidas victoria natasha 1q2w3e4r jasmine winter prince marine ghbdtn fishing cocacola casper
+james 232323 raiders 888888 marlboro gandalf asdfasdf crystal 87654321 12344321 golden 8675309
+disney gemini 11223344 hello123 password1 password123 qwerty123 1q2w3e 1q2w3e4r5t qwertyu admin
+admin123 administrator root toor changeme default guest login user letmein123 welcome1 welcome123
+passw0rd p@ssw0rd p@ssword pa55word passpass password12 password1234 iloveyou1 princess1 monkey1
+dragon1 sunshine1 football1 baseball1 superman1 trustno11 abc12345 abcd1234 abcdef abcdefg abcdefgh
+qweasd qweasdzxc zaq12wsx zaq1zaq1 asdf1234 asdfghjkl zxcvbnm123 1qazxsw2 q1w2e3 aa123456 a123456
+a12345678 123abc 1a2b3c 000000000 00000000 0123456789 1111111 11111111111 1212121212 123 12345678910
+1234554321 123456123 12345678901 123456a 123456aa 123456q 123654789 123abc123 147258 147258369
+159357 159753456 1qaz2wsx3edc 2222 252525 3333 4444 5555 6666 6969 7777 789456 789456123 8888 9999
+99999999 asdasd asdzxc azerty bismillah blink182 buttercup butterfly charlie1 chocolate cookie1
+daniel1 flower1 friends hottie jennifer1 jesus jessica1 jordan23 justinbieber liverpool loveme
+lovely michael1 naruto nicole1 pokemon qazwsxedc qwerty1 qwerty12 qwertyui secret1 shadow1 soccer1
+starwars1 sunflower superstar tinkerbell tweety whatever1 xxxxxxxx zxcv1234 letmein1 master1 hunter2
+trustme solo mypass mypassword newpass newpassword temp temp123 test123 testing test1234 demo
+demo123 sample secure security system server direct upload directupload tella horizontal
+horizontal123 upload123 journalist reporter evidence freedom1 liberty justice1 truth qwerty1234
+asdfgh123 iloveu 111222 121314 131415 1314520 5201314 woaini 7758521 a1b2c3 a1b2c3d4 aaaaaaaa abcabc
+azertyuiop bonjour bienvenue soleil doudou loulou chouchou marseille hallo passwort schatz hallo123
+qwertz123 contraseña contrasena hola123 teamo spiderman batman1 summer1 winter1 spring autumn
+january february sunday monday friday samsung1 apple iphone google facebook twitter youtube
+instagram linkedin yahoo hotmail gmail email office office123 company welcome2020 welcome2021
+welcome2022 welcome2023 welcome2024 welcome2025 welcome2026 summer2020 summer2021 summer2022
+summer2023 summer2024 summer2025 summer2026 winter2024 winter2025 winter2026 password2020
+password2021 password2022 password2023 password2024 password2025 password2026 spring2025 spring2026
+autumn2025 autumn2026 correcthorsebatterystaple correct horse battery staple letmeinplease
+opensesame nopassword nothing blahblah whatever123 iloveyou123 mylove babygirl sweetheart angel1
+princess123 lovelove 1q1q1q1q 1qaz1qaz 2wsx3edc qwaszx zxcasdqwe qazxswedc poiuytrewq mnbvcxz
+lkjhgfdsa 987654321a 1029384756 q1q1q1q1 aaa111 abc111 asd123 qwe123 zxc123 xyz123 pass123 pass1234
+pass@123 admin@123 root123 user123 guest123 test@123 abc@123 india123 pakistan bangladesh nigeria
+ghana kenya ukraine123 russia china123 mexico brasil colombia argentina peru chile
+`
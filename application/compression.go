@@ -0,0 +1,381 @@
+package application
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressedSuffix marks files stored compressed. Neither plain nor encoded
+// storage names contain "=" past the first character, so it never clashes
+// with a stored name.
+const compressedSuffix = "=zst"
+
+// Every append is written as a complete zstd frame followed by a skippable
+// frame recording the logical size, so appending never rewrites earlier
+// data and HEAD reads the size from the end of the file. Decoders ignore
+// skippable frames, the file as a whole is a valid zstd stream.
+const (
+	zstdMagic          = 0xfd2fb528
+	skippableMagicMask = 0xfffffff0
+	skippableMagic     = 0x184d2a50
+	sizeTrailerMagic   = skippableMagic | 0x0e
+	sizeTrailerLength  = 8 + 16
+)
+
+// ErrStoredCompressed is returned for paths of compressed files, which can't
+// be read directly.
+var ErrStoredCompressed = errors.New("file stored compressed")
+
+var errTornFrame = errors.New("torn zstd frame")
+
+// fallbackContentTypes covers compressible types missing from minimal
+// systems without mime.types.
+var fallbackContentTypes = map[string]string{
+	".csv":  "text/csv",
+	".log":  "text/plain",
+	".md":   "text/markdown",
+	".tsv":  "text/tab-separated-values",
+	".txt":  "text/plain",
+	".json": "application/json",
+	".xml":  "application/xml",
+}
+
+type CompressionConfig struct {
+	// ContentTypes lists media types, or type prefixes like "text/", of
+	// files stored compressed. Empty disables compression.
+	ContentTypes []string
+	// Level is one of zstd levels "fastest", "default", "better" or "best".
+	Level string
+}
+
+// ContentTypeByName guesses media type of a file from its extension.
+func ContentTypeByName(file string) string {
+	ext := strings.ToLower(filepath.Ext(file))
+
+	contentType := mime.TypeByExtension(ext)
+	if contentType == "" {
+		contentType = fallbackContentTypes[ext]
+	}
+
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+
+	return strings.TrimSpace(contentType)
+}
+
+func (c CompressionConfig) compressible(file string) bool {
+	contentType := ContentTypeByName(file)
+	if contentType == "" {
+		return false
+	}
+
+	for _, t := range c.ContentTypes {
+		if contentType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c CompressionConfig) Validate() error {
+	_, err := c.encoderLevel()
+	return err
+}
+
+func (c CompressionConfig) encoderLevel() (zstd.EncoderLevel, error) {
+	if c.Level == "" {
+		return zstd.SpeedDefault, nil
+	}
+
+	ok, level := zstd.EncoderLevelFromString(c.Level)
+	if !ok {
+		return 0, fmt.Errorf("unknown compression level %q", c.Level)
+	}
+
+	return level, nil
+}
+
+// appendCompressed writes data as a new frame at the end of the last complete
+// append, dropping anything an interrupted append left behind. It returns
+// number of uncompressed bytes written.
+func appendCompressed(f *os.File, data io.Reader, level zstd.EncoderLevel) (int64, error) {
+	end, size, err := compressedEnd(f)
+	if err != nil {
+		return 0, err
+	}
+
+	err = f.Truncate(end)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.Seek(end, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+
+	enc, err := zstd.NewWriter(f, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(enc, data)
+
+	closeErr := enc.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = writeSizeTrailer(f, size+written)
+	}
+
+	if err != nil {
+		// don't leave partial frame for the next append to clean up
+		_ = f.Truncate(end)
+		return 0, err
+	}
+
+	return written, nil
+}
+
+func writeSizeTrailer(f *os.File, size int64) error {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	trailer := make([]byte, sizeTrailerLength)
+	binary.LittleEndian.PutUint32(trailer[0:], sizeTrailerMagic)
+	binary.LittleEndian.PutUint32(trailer[4:], 16)
+	binary.LittleEndian.PutUint64(trailer[8:], uint64(size))
+	binary.LittleEndian.PutUint64(trailer[16:], uint64(offset+sizeTrailerLength))
+
+	_, err = f.Write(trailer)
+
+	return err
+}
+
+// compressedSize returns uncompressed size of a stored file.
+func compressedSize(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	_, size, err := compressedEnd(f)
+
+	return size, err
+}
+
+// compressedEnd returns end offset of the last complete append and the
+// logical size of data up to it.
+func compressedEnd(f *os.File) (int64, int64, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if stat.Size() == 0 {
+		return 0, 0, nil
+	}
+
+	// fast path, last append completed
+	if stat.Size() >= sizeTrailerLength {
+		trailer := make([]byte, sizeTrailerLength)
+
+		_, err = f.ReadAt(trailer, stat.Size()-sizeTrailerLength)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if end, size, ok := parseSizeTrailer(trailer); ok && end == stat.Size() {
+			return end, size, nil
+		}
+	}
+
+	return scanCompressed(io.NewSectionReader(f, 0, stat.Size()))
+}
+
+func parseSizeTrailer(trailer []byte) (int64, int64, bool) {
+	if binary.LittleEndian.Uint32(trailer[0:]) != sizeTrailerMagic || binary.LittleEndian.Uint32(trailer[4:]) != 16 {
+		return 0, 0, false
+	}
+
+	return int64(binary.LittleEndian.Uint64(trailer[16:])), int64(binary.LittleEndian.Uint64(trailer[8:])), true
+}
+
+// scanCompressed walks frames from the start to find the last size trailer
+// following complete frames.
+func scanCompressed(r *io.SectionReader) (int64, int64, error) {
+	var end, size, offset int64
+
+	header := make([]byte, 8)
+
+	for {
+		_, err := r.ReadAt(header[:4], offset)
+		if err == io.EOF {
+			return end, size, nil
+		}
+
+		if err != nil {
+			return 0, 0, err
+		}
+
+		magic := binary.LittleEndian.Uint32(header)
+
+		switch {
+		case magic&skippableMagicMask == skippableMagic:
+			_, err = r.ReadAt(header, offset)
+			if err != nil {
+				return end, size, nil
+			}
+
+			length := int64(binary.LittleEndian.Uint32(header[4:]))
+
+			if magic == sizeTrailerMagic && length == 16 {
+				trailer := make([]byte, sizeTrailerLength)
+
+				if _, err := r.ReadAt(trailer, offset); err != nil {
+					return end, size, nil
+				}
+
+				trailerEnd, trailerSize, _ := parseSizeTrailer(trailer)
+				if trailerEnd != offset+sizeTrailerLength {
+					return end, size, nil
+				}
+
+				end, size = trailerEnd, trailerSize
+			}
+
+			offset += 8 + length
+
+		case magic == zstdMagic:
+			offset, err = skipZstdFrame(r, offset+4)
+			if err == errTornFrame {
+				return end, size, nil
+			}
+
+			if err != nil {
+				return 0, 0, err
+			}
+
+		default:
+			return end, size, nil
+		}
+	}
+}
+
+// skipZstdFrame returns offset past the frame whose header starts at offset,
+// see RFC 8878 section 3.1.1.
+func skipZstdFrame(r *io.SectionReader, offset int64) (int64, error) {
+	descriptor := make([]byte, 1)
+
+	if _, err := r.ReadAt(descriptor, offset); err != nil {
+		return 0, errTornFrame
+	}
+
+	d := descriptor[0]
+	singleSegment := d&0x20 != 0
+	checksum := d&0x04 != 0
+
+	headerSize := int64(1)
+
+	if !singleSegment {
+		headerSize++
+	}
+
+	headerSize += []int64{0, 1, 2, 4}[d&0x03]
+
+	switch d >> 6 {
+	case 0:
+		if singleSegment {
+			headerSize++
+		}
+	case 1:
+		headerSize += 2
+	case 2:
+		headerSize += 4
+	case 3:
+		headerSize += 8
+	}
+
+	offset += headerSize
+	block := make([]byte, 3)
+
+	for {
+		if _, err := r.ReadAt(block, offset); err != nil {
+			return 0, errTornFrame
+		}
+
+		h := uint32(block[0]) | uint32(block[1])<<8 | uint32(block[2])<<16
+		last := h&1 != 0
+		size := int64(h >> 3)
+
+		switch (h >> 1) & 0x03 {
+		case 1: // RLE block stores the byte once
+			size = 1
+		case 3:
+			return 0, errTornFrame
+		}
+
+		offset += 3 + size
+
+		if last {
+			break
+		}
+	}
+
+	if checksum {
+		offset += 4
+	}
+
+	if offset > r.Size() {
+		return 0, errTornFrame
+	}
+
+	return offset, nil
+}
+
+// compressedReader decompresses a stored file up to its last complete append.
+type compressedReader struct {
+	*zstd.Decoder
+	file *os.File
+}
+
+func openCompressed(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	end, _, err := compressedEnd(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	dec, err := zstd.NewReader(io.NewSectionReader(f, 0, end), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &compressedReader{Decoder: dec, file: f}, nil
+}
+
+func (r *compressedReader) Close() error {
+	r.Decoder.Close()
+	return r.file.Close()
+}
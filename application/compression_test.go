@@ -0,0 +1,105 @@
+package application
+
+import (
+	"bytes"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLocalFileStore_Compression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direct-upload-compression")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewLocalFileStore(LocalFileStoreConfig{
+		Path:        dir,
+		Compression: CompressionConfig{ContentTypes: []string{"text/"}, Level: "fastest"},
+	}, nil, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	chunk := strings.Repeat("2019-08-20 12:00:00 INFO request served\n", 1000)
+
+	for i := 0; i < 3; i++ {
+		err = store.AppendFile(newCtx(), "server.log", ioutil.NopCloser(strings.NewReader(chunk)))
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+	}
+
+	info, _ := store.GetFileInfo(newCtx(), "server.log")
+	if info.Size != int64(3*len(chunk)) {
+		t.Errorf("Expected logical size %d, got %d", 3*len(chunk), info.Size)
+	}
+
+	staged := store.getStagingPath(UsernameTest, "server.log") + compressedSuffix
+
+	stat, err := os.Stat(staged)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	if stat.Size() >= int64(len(chunk)) {
+		t.Errorf("File not compressed, %d bytes stored", stat.Size())
+	}
+
+	// interrupted append leaves a partial frame behind
+	f, _ := os.OpenFile(staged, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.Write([]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x58})
+	_ = f.Close()
+
+	info, _ = store.GetFileInfo(newCtx(), "server.log")
+	if info.Size != int64(3*len(chunk)) {
+		t.Errorf("Expected logical size %d after torn append, got %d", 3*len(chunk), info.Size)
+	}
+
+	_ = store.AppendFile(newCtx(), "server.log", ioutil.NopCloser(strings.NewReader("last line\n")))
+	_, _ = store.CloseFile(newCtx(), "server.log")
+
+	if _, err := store.LocalPath(newCtx(), "server.log"); err != ErrStoredCompressed {
+		t.Errorf("Expected ErrStoredCompressed, got %v", err)
+	}
+
+	r, err := store.OpenFile(newCtx(), "server.log")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	content, err := ioutil.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if !bytes.Equal(content, []byte(strings.Repeat(chunk, 3)+"last line\n")) {
+		t.Errorf("Decompressed content differs from uploaded data")
+	}
+
+	files, _ := store.ListFiles(newCtx())
+	if len(files) != 1 || files[0].Name != "server.log" || files[0].Size != int64(len(content)) {
+		t.Errorf("Unexpected files listed: %+v", files)
+	}
+}
+
+func TestCompressionConfig_Compressible(t *testing.T) {
+	config := CompressionConfig{ContentTypes: []string{"text/", "application/json"}}
+
+	tests := map[string]bool{
+		"notes.txt":    true,
+		"form.JSON":    true,
+		"data.csv":     true,
+		"video.mp4":    false,
+		"no-extension": false,
+	}
+
+	for file, expected := range tests {
+		if config.compressible(file) != expected {
+			t.Errorf("Bad compressible result for %s: expected %v", file, expected)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// objectsDir keeps content-addressed copies of closed files, user files are
+// hard links to them. The link count of an object is its reference count.
+const objectsDir = ".objects"
+
+var ErrDedupeDisabled = errors.New("deduplication not enabled")
+
+type DedupeStats struct {
+	Files   int
+	Linked  int
+	Saved   int64
+	Removed int
+}
+
+// DedupeProcessor stores closed files by their SHA-256 digest, replacing
+// duplicates with hard links to the stored copy.
+type DedupeProcessor struct {
+	store *LocalFileStore
+}
+
+func NewDedupeProcessor(store FileStore) (*DedupeProcessor, error) {
+	local, ok := store.(*LocalFileStore)
+	if !ok || !local.config.Dedupe {
+		return nil, fmt.Errorf("processor dedupe: %v", ErrDedupeDisabled)
+	}
+
+	return &DedupeProcessor{
+		store: local,
+	}, nil
+}
+
+func (p *DedupeProcessor) Name() string {
+	return "dedupe"
+}
+
+func (p *DedupeProcessor) Process(ctx context.Context, job *ProcessingJob) (string, error) {
+	path, err := p.store.LocalPath(ctx, job.File)
+	if err == ErrStoredCompressed {
+		return "stored compressed, skipped", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	linked, err := p.store.dedupe(path, job.Digest)
+	if err != nil {
+		return "", err
+	}
+
+	if linked {
+		return "linked to " + job.Digest, nil
+	}
+
+	return "stored as " + job.Digest, nil
+}
+
+// DedupeAll converts existing storage, replacing every duplicate closed file
+// with a link to its content-addressed copy, and removes stored copies no
+// longer referenced by any user file.
+func (m *LocalFileStore) DedupeAll() (*DedupeStats, error) {
+	if !m.config.Dedupe {
+		return nil, ErrDedupeDisabled
+	}
+
+	stats := &DedupeStats{}
+
+	users, err := ioutil.ReadDir(m.config.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if !user.IsDir() || strings.HasPrefix(user.Name(), ".") {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(m.getFullDir(user.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			// compressed copies of equal content differ with append boundaries
+			if !f.Mode().IsRegular() || strings.HasSuffix(f.Name(), compressedSuffix) {
+				continue
+			}
+
+			path := filepath.Join(m.getFullDir(user.Name()), f.Name())
+
+			digest, err := fileDigest(path)
+			if err != nil {
+				return nil, err
+			}
+
+			linked, err := m.dedupe(path, digest)
+			if err != nil {
+				return nil, err
+			}
+
+			stats.Files++
+
+			if linked {
+				stats.Linked++
+				stats.Saved += f.Size()
+			}
+		}
+	}
+
+	stats.Removed, err = m.removeUnreferencedObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Info("Deduplicated files", zap.Int("files", stats.Files), zap.Int("linked", stats.Linked),
+		zap.Int64("saved", stats.Saved), zap.Int("removed", stats.Removed))
+
+	return stats, nil
+}
+
+// dedupe makes path a reference to the stored copy of its content, storing it
+// first when there is none. It reports whether path was a duplicate.
+func (m *LocalFileStore) dedupe(path string, digest string) (bool, error) {
+	m.objectsMu.Lock()
+	defer m.objectsMu.Unlock()
+
+	object := m.getObjectPath(digest)
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	objectStat, err := os.Stat(object)
+
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(filepath.Dir(object), 0755)
+		if err != nil {
+			return false, err
+		}
+
+		return false, os.Link(path, object)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if os.SameFile(stat, objectStat) {
+		return false, nil
+	}
+
+	if stat.Size() != objectStat.Size() {
+		return false, fmt.Errorf("stored copy %s differs in size from %s", digest, path)
+	}
+
+	// replace the file atomically, so readers always see complete content;
+	// temporary link lives next to the object so it never shows as user file
+	tmp := object + ".link"
+	_ = os.Remove(tmp)
+
+	err = os.Link(object, tmp)
+	if err != nil {
+		return false, err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return false, err
+	}
+
+	m.logger.Debug("File deduplicated", zap.String("path", path), zap.String("sha256", digest))
+
+	return true, nil
+}
+
+// release drops the stored copy of a closed file about to be deleted, if the
+// file is its last reference.
+func (m *LocalFileStore) release(path string) error {
+	m.objectsMu.Lock()
+	defer m.objectsMu.Unlock()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	// the file itself and the stored copy
+	if links, ok := linkCount(stat); !ok || links != 2 {
+		return nil
+	}
+
+	digest, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+
+	object := m.getObjectPath(digest)
+
+	objectStat, err := os.Stat(object)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !os.SameFile(stat, objectStat) {
+		return nil
+	}
+
+	m.logger.Debug("Removing unreferenced stored copy", zap.String("sha256", digest))
+
+	return os.Remove(object)
+}
+
+func (m *LocalFileStore) removeUnreferencedObjects() (int, error) {
+	m.objectsMu.Lock()
+	defer m.objectsMu.Unlock()
+
+	removed := 0
+
+	err := filepath.Walk(filepath.Join(m.config.Path, objectsDir), func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		if links, ok := linkCount(info); ok && links == 1 {
+			removed++
+			return os.Remove(path)
+		}
+
+		return nil
+	})
+
+	return removed, err
+}
+
+func (m *LocalFileStore) getObjectPath(digest string) string {
+	return filepath.Join(m.config.Path, objectsDir, digest[:2], digest)
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,121 @@
+package application
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalFileStore_Dedupe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direct-upload-dedupe")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := NewLocalFileStore(LocalFileStoreConfig{Path: dir, Dedupe: true}, nil, zaptest.NewLogger(t))
+
+	var ctxs []context.Context
+
+	for i := 0; i < 2; i++ {
+		ctx := NewContext(context.Background(), &User{Username: uuid.New().String()})
+		ctxs = append(ctxs, ctx)
+
+		_ = store.AppendFile(ctx, "video.mp4", ioutil.NopCloser(strings.NewReader("same content")))
+		_, _ = store.CloseFile(ctx, "video.mp4")
+	}
+
+	stats, err := store.DedupeAll()
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if stats.Files != 2 || stats.Linked != 1 || stats.Saved != int64(len("same content")) {
+		t.Errorf("Unexpected dedupe stats: %+v", stats)
+	}
+
+	var infos []os.FileInfo
+
+	for _, ctx := range ctxs {
+		path, _ := store.LocalPath(ctx, "video.mp4")
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		infos = append(infos, info)
+	}
+
+	if !os.SameFile(infos[0], infos[1]) {
+		t.Errorf("Duplicate files not linked")
+	}
+
+	_ = store.RemoveClosedFile(ctxs[0], "video.mp4")
+
+	if objects := countObjects(t, dir); objects != 1 {
+		t.Errorf("Expected stored copy to be kept while referenced, found %d", objects)
+	}
+
+	_ = store.RemoveClosedFile(ctxs[1], "video.mp4")
+
+	if objects := countObjects(t, dir); objects != 0 {
+		t.Errorf("Expected unreferenced stored copy to be removed, found %d", objects)
+	}
+}
+
+func TestDedupeProcessor_Process(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direct-upload-dedupe")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := NewLocalFileStore(LocalFileStoreConfig{Path: dir, Dedupe: true}, nil, zaptest.NewLogger(t))
+
+	processor, err := NewDedupeProcessor(store)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	pipeline := NewProcessingPipeline(ProcessingConfig{}, []Processor{processor}, store,
+		&memProcessingRepo{statuses: map[string]ProcessingStatus{}}, zaptest.NewLogger(t))
+
+	for _, file := range []string{"a.txt", "b.txt"} {
+		_ = store.AppendFile(newCtx(), file, ioutil.NopCloser(strings.NewReader("same content")))
+		_, _ = store.CloseFile(newCtx(), file)
+
+		pipeline.Handle(Event{Type: EventFileClosed, Username: UsernameTest, File: file})
+		pipeline.process(<-pipeline.queue)
+	}
+
+	status, _ := pipeline.Status(UsernameTest, "b.txt")
+	if status.State != ProcessingDone || !strings.HasPrefix(status.Steps[0].Output, "linked to ") {
+		t.Errorf("Expected duplicate to be linked, got %+v", status)
+	}
+
+	if _, err := NewDedupeProcessor(NewMemoryFileStore(MemoryFileStoreConfig{}, nil, zaptest.NewLogger(t))); err == nil {
+		t.Errorf("Expected error for store without deduplication")
+	}
+}
+
+func countObjects(t *testing.T, dir string) int {
+	count := 0
+
+	err := filepath.Walk(filepath.Join(dir, objectsDir), func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	return count
+}
@@ -0,0 +1,380 @@
+package application
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Files kept in the device CA directory.
+const (
+	DeviceCACertFile = "ca.pem"
+	DeviceCAKeyFile  = "ca-key.pem"
+	DeviceCRLFile    = "crl.pem"
+)
+
+const (
+	defaultDeviceValidity = 365 * 24 * time.Hour
+	deviceCAValidity      = 20 * 365 * 24 * time.Hour
+	// crlValidity is how long relying parties may use the CRL, it is
+	// re-issued on every start and revocation.
+	crlValidity = 30 * 24 * time.Hour
+)
+
+var ErrDeviceCertNotFound = errors.New("device certificate not found")
+var ErrDeviceCADisabled = errors.New("client certificates not enabled")
+
+// DeviceCertificate records certificate issued for a user's device.
+type DeviceCertificate struct {
+	// Serial is hex encoded serial number.
+	Serial   string
+	Username string
+	Device   string
+	Issued   time.Time
+	NotAfter time.Time
+	// Revoked is zero until the certificate is revoked.
+	Revoked time.Time
+}
+
+// IssuedCertificate is a new device certificate with its private key, the
+// key is not stored by the server.
+type IssuedCertificate struct {
+	DeviceCertificate
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+type DeviceCertRepository interface {
+	Save(cert *DeviceCertificate) error
+	Read(serial string) (*DeviceCertificate, error)
+	List() <-chan DeviceCertificate
+}
+
+type DeviceCAConfig struct {
+	// Dir keeps CA certificate, key and CRL, it is created on first start.
+	Dir string
+	// Validity of issued certificates, defaults to a year.
+	Validity time.Duration
+}
+
+// DeviceCA issues client certificates for devices and revokes them by
+// publishing a CRL next to the CA certificate.
+type DeviceCA struct {
+	config DeviceCAConfig
+	repo   DeviceCertRepository
+	cert   *x509.Certificate
+	key    crypto.Signer
+	mu     sync.Mutex
+	logger *zap.Logger
+}
+
+func NewDeviceCA(config DeviceCAConfig, repo DeviceCertRepository, logger *zap.Logger) (*DeviceCA, error) {
+	if config.Validity <= 0 {
+		config.Validity = defaultDeviceValidity
+	}
+
+	ca := &DeviceCA{
+		config: config,
+		repo:   repo,
+		logger: logger,
+	}
+
+	err := ca.load()
+	if err != nil {
+		return nil, err
+	}
+
+	// CRL expires, so it is issued again on every start
+	return ca, ca.writeCRL()
+}
+
+func (ca *DeviceCA) CertFile() string {
+	return filepath.Join(ca.config.Dir, DeviceCACertFile)
+}
+
+func (ca *DeviceCA) CRLFile() string {
+	return filepath.Join(ca.config.Dir, DeviceCRLFile)
+}
+
+// load reads CA certificate and key, creating them on first start.
+func (ca *DeviceCA) load() error {
+	certPEM, err := ioutil.ReadFile(ca.CertFile())
+	if os.IsNotExist(err) {
+		return ca.create()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	keyPEM, err := ioutil.ReadFile(filepath.Join(ca.config.Dir, DeviceCAKeyFile))
+	if err != nil {
+		return err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+
+	if certBlock == nil || keyBlock == nil {
+		return fmt.Errorf("device CA in %s not valid", ca.config.Dir)
+	}
+
+	ca.cert, err = x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("device CA key in %s not valid", ca.config.Dir)
+	}
+
+	ca.key = signer
+
+	return nil
+}
+
+func (ca *DeviceCA) create() error {
+	err := os.MkdirAll(ca.config.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Direct Upload Device CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(deviceCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	// key first, certificate marks the CA as complete
+	err = writeFileAtomic(filepath.Join(ca.config.Dir, DeviceCAKeyFile),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(ca.CertFile(), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err != nil {
+		return err
+	}
+
+	ca.cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	ca.key = key
+
+	ca.logger.Info("Device CA created", zap.String("dir", ca.config.Dir))
+
+	return nil
+}
+
+// Issue creates certificate for username's device, subject common name is
+// the username.
+func (ca *DeviceCA) Issue(username, device string, validity time.Duration) (*IssuedCertificate, error) {
+	if !ValidUsername(username) {
+		return nil, fmt.Errorf("username not valid")
+	}
+
+	if validity <= 0 {
+		validity = ca.config.Validity
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: username, OrganizationalUnit: []string{device}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := &IssuedCertificate{
+		DeviceCertificate: DeviceCertificate{
+			Serial:   serial.Text(16),
+			Username: username,
+			Device:   device,
+			Issued:   now,
+			NotAfter: template.NotAfter,
+		},
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}),
+	}
+
+	err = ca.repo.Save(&issued.DeviceCertificate)
+	if err != nil {
+		return nil, err
+	}
+
+	ca.logger.Info("Device certificate issued",
+		zap.String("username", username), zap.String("device", device), zap.String("serial", issued.Serial))
+
+	return issued, nil
+}
+
+// Revoke adds certificate to the CRL, it is rejected on next handshake.
+func (ca *DeviceCA) Revoke(serial string) (*DeviceCertificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	cert, err := ca.repo.Read(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert == nil {
+		return nil, ErrDeviceCertNotFound
+	}
+
+	if !cert.Revoked.IsZero() {
+		return cert, nil
+	}
+
+	cert.Revoked = time.Now()
+
+	err = ca.repo.Save(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	ca.logger.Info("Device certificate revoked",
+		zap.String("username", cert.Username), zap.String("device", cert.Device), zap.String("serial", serial))
+
+	return cert, ca.writeCRL()
+}
+
+// List returns certificates issued for username, or all certificates for
+// empty username, ordered by issue time.
+func (ca *DeviceCA) List(username string) []DeviceCertificate {
+	var certs []DeviceCertificate
+
+	for cert := range ca.repo.List() {
+		if username == "" || cert.Username == username {
+			certs = append(certs, cert)
+		}
+	}
+
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].Issued.Before(certs[j].Issued)
+	})
+
+	return certs
+}
+
+// writeCRL publishes all revoked certificates which have not expired yet.
+func (ca *DeviceCA) writeCRL() error {
+	var revoked []pkix.RevokedCertificate
+
+	now := time.Now()
+
+	for cert := range ca.repo.List() {
+		if cert.Revoked.IsZero() || cert.NotAfter.Before(now) {
+			continue
+		}
+
+		serial, ok := new(big.Int).SetString(cert.Serial, 16)
+		if !ok {
+			return fmt.Errorf("device certificate serial %q not valid", cert.Serial)
+		}
+
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: cert.Revoked})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: revoked,
+		// increasing, as required for CRLs of the same issuer
+		Number:     big.NewInt(now.UnixNano()),
+		ThisUpdate: now,
+		NextUpdate: now.Add(crlValidity),
+	}, ca.cert, ca.key)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(ca.CRLFile(), pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0644)
+}
+
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+}
+
+// writeFileAtomic replaces file, readers see either old or new content.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+
+	err := ioutil.WriteFile(tmp, data, perm)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,156 @@
+package application
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memDeviceCertRepo struct {
+	mu    sync.Mutex
+	certs map[string]DeviceCertificate
+}
+
+func (r *memDeviceCertRepo) Save(cert *DeviceCertificate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certs[cert.Serial] = *cert
+	return nil
+}
+
+func (r *memDeviceCertRepo) Read(serial string) (*DeviceCertificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cert, ok := r.certs[serial]
+	if !ok {
+		return nil, nil
+	}
+	return &cert, nil
+}
+
+func (r *memDeviceCertRepo) List() <-chan DeviceCertificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(chan DeviceCertificate, len(r.certs))
+	for _, cert := range r.certs {
+		out <- cert
+	}
+	close(out)
+	return out
+}
+
+func readCRL(t *testing.T, ca *DeviceCA) *x509.RevocationList {
+	data, err := ioutil.ReadFile(ca.CRLFile())
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	block, _ := pem.Decode(data)
+
+	list, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := list.CheckSignatureFrom(ca.cert); err != nil {
+		t.Error("CRL not signed by CA", err)
+	}
+
+	return list
+}
+
+func TestDeviceCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direct-upload-ca")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := &memDeviceCertRepo{certs: map[string]DeviceCertificate{}}
+
+	ca, err := NewDeviceCA(DeviceCAConfig{Dir: dir}, repo, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	issued, err := ca.Issue("alice", "phone", 0)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if days := int(time.Until(issued.NotAfter).Hours() / 24); days != 364 {
+		t.Errorf("Expected default validity of a year, got %d days", days)
+	}
+
+	pair, err := tls.X509KeyPair(issued.CertPEM, issued.KeyPEM)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	if err != nil {
+		t.Error("Issued certificate not valid", err)
+	}
+
+	if leaf.Subject.CommonName != "alice" || leaf.SerialNumber.Text(16) != issued.Serial {
+		t.Errorf("Unexpected certificate %s %s", leaf.Subject, leaf.SerialNumber.Text(16))
+	}
+
+	if list := readCRL(t, ca); len(list.RevokedCertificateEntries) != 0 {
+		t.Errorf("Expected empty CRL, got %d entries", len(list.RevokedCertificateEntries))
+	}
+
+	revoked, err := ca.Revoke(issued.Serial)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if revoked.Revoked.IsZero() {
+		t.Error("Revocation not recorded")
+	}
+
+	list := readCRL(t, ca)
+	if len(list.RevokedCertificateEntries) != 1 || list.RevokedCertificateEntries[0].SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+		t.Errorf("Revoked certificate not in CRL")
+	}
+
+	if _, err := ca.Revoke("abc"); err != ErrDeviceCertNotFound {
+		t.Errorf("Expected ErrDeviceCertNotFound, got %v", err)
+	}
+
+	if certs := ca.List("alice"); len(certs) != 1 || certs[0].Device != "phone" {
+		t.Errorf("Unexpected certificates %+v", certs)
+	}
+
+	if certs := ca.List("bob"); len(certs) != 0 {
+		t.Errorf("Unexpected certificates %+v", certs)
+	}
+
+	// existing CA is loaded on restart
+	reopened, err := NewDeviceCA(DeviceCAConfig{Dir: dir}, repo, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if !reopened.cert.Equal(ca.cert) {
+		t.Error("CA certificate changed on restart")
+	}
+
+	if list := readCRL(t, reopened); len(list.RevokedCertificateEntries) != 1 {
+		t.Error("Revoked certificate not in CRL after restart")
+	}
+}
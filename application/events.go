@@ -0,0 +1,89 @@
+package application
+
+import (
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventUploadStarted EventType = "upload.started"
+	EventFileClosed    EventType = "file.closed"
+	EventFileDeleted   EventType = "file.deleted"
+	EventUserCreated   EventType = "user.created"
+	EventUserDeleted   EventType = "user.deleted"
+	// EventAccessRefused is published when user with valid credentials is
+	// refused, Reason tells why.
+	EventAccessRefused EventType = "user.access_refused"
+)
+
+type Event struct {
+	ID       string    `json:"id"`
+	Type     EventType `json:"type"`
+	Time     time.Time `json:"time"`
+	Username string    `json:"username"`
+	// Project is set for files in shared project folders.
+	Project string `json:"project,omitempty"`
+	File    string `json:"file,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Owner returns storage owner of the file, see User.Owner.
+func (e Event) Owner() string {
+	if e.Project != "" {
+		return ProjectOwner(e.Project)
+	}
+
+	return e.Username
+}
+
+type EventHandler func(e Event)
+
+// EventBus fans application events out to subscribers. Handlers are called
+// synchronously, so they should hand off any slow work.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers []EventHandler
+	logger   *zap.Logger
+}
+
+func NewEventBus(logger *zap.Logger) *EventBus {
+	return &EventBus{
+		logger: logger,
+	}
+}
+
+func (b *EventBus) Subscribe(h EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish is safe to call on a nil bus, which drops the event.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	if e.ID == "" {
+		e.ID = uuid.New().String()
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.logger.Debug("Publishing event",
+		zap.String("type", string(e.Type)), zap.String("username", e.Username), zap.String("file", e.File))
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, h := range b.handlers {
+		h(e)
+	}
+}
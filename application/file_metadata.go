@@ -0,0 +1,38 @@
+package application
+
+import "time"
+
+// FileMetadata holds what the server knows about a stored file beyond its
+// content.
+type FileMetadata struct {
+	Username  string
+	File      string
+	Size      int64
+	Digest    string
+	Scan      *ScanResult
+	Timestamp *TimestampToken
+	Updated   time.Time
+}
+
+type FileMetadataRepository interface {
+	Save(meta *FileMetadata) error
+	Read(username, file string) (*FileMetadata, error)
+	Delete(username, file string) error
+}
+
+// readOrNewMetadata returns stored metadata or a new record for the file.
+func readOrNewMetadata(repo FileMetadataRepository, username, file string) (*FileMetadata, error) {
+	meta, err := repo.Read(username, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta == nil {
+		meta = &FileMetadata{
+			Username: username,
+			File:     file,
+		}
+	}
+
+	return meta, nil
+}
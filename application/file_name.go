@@ -0,0 +1,81 @@
+package application
+
+import (
+	"encoding/base32"
+	"errors"
+	"golang.org/x/text/unicode/norm"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxFileNameLength limits normalized file names in bytes, so encoded names
+// stay under the 255 byte limit of common filesystems.
+const MaxFileNameLength = 150
+
+// encodedFileNamePrefix can't start a plain name, so encoded and plain names
+// never clash.
+const encodedFileNamePrefix = "="
+
+var ErrFileNameNotValid = errors.New("file name not valid")
+
+// plainFileRegexp matches names safe to store as they are on any supported
+// filesystem, which is what all names were before unicode support.
+var plainFileRegexp = regexp.MustCompile("^[a-zA-Z0-9_\\-][a-zA-Z0-9_.\\-]*$")
+
+// lowercase only alphabet keeps encoded names distinct on case-insensitive
+// filesystems
+var fileNameEncoding = base32.NewEncoding("0123456789abcdefghijklmnopqrstuv").WithPadding(base32.NoPadding)
+
+// NormalizeFileName validates a client supplied file name and returns its NFC
+// form, which is the name used everywhere in the application.
+func NormalizeFileName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", ErrFileNameNotValid
+	}
+
+	name = norm.NFC.String(name)
+
+	if name == "" || len(name) > MaxFileNameLength || strings.HasPrefix(name, ".") {
+		return "", ErrFileNameNotValid
+	}
+
+	for _, r := range name {
+		if r == '/' || r == '\\' || unicode.IsControl(r) || isBidiOverride(r) {
+			return "", ErrFileNameNotValid
+		}
+	}
+
+	return name, nil
+}
+
+// StorageFileName maps a normalized file name to the name used on disk.
+// Plain ASCII names are kept, anything else is encoded reversibly.
+func StorageFileName(name string) string {
+	if plainFileRegexp.MatchString(name) {
+		return name
+	}
+
+	return encodedFileNamePrefix + fileNameEncoding.EncodeToString([]byte(name))
+}
+
+// DisplayFileName reverses StorageFileName.
+func DisplayFileName(storage string) string {
+	if !strings.HasPrefix(storage, encodedFileNamePrefix) {
+		return storage
+	}
+
+	name, err := fileNameEncoding.DecodeString(strings.TrimPrefix(storage, encodedFileNamePrefix))
+	if err != nil {
+		return storage
+	}
+
+	return string(name)
+}
+
+// isBidiOverride reports explicit direction formatting characters, which
+// can disguise file extensions, ie. U+202E making "gpj.exe" look like "exe.jpg".
+func isBidiOverride(r rune) bool {
+	return (r >= '\u202a' && r <= '\u202e') || (r >= '\u2066' && r <= '\u2069')
+}
@@ -0,0 +1,77 @@
+package application
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeFileName(t *testing.T) {
+	valid := map[string]string{
+		"video.mp4":              "video.mp4",
+		"отчёт 2020.mp4":         "отчёт 2020.mp4",
+		"تقرير.jpg":              "تقرير.jpg",
+		"my report (final).pdf":  "my report (final).pdf",
+		"vide\u0301o.mp4":        "vid\u00e9o.mp4", // NFD to NFC
+		"video.part":             "video.part",
+		strings.Repeat("a", 150): strings.Repeat("a", 150),
+		"a:b*c?.txt":             "a:b*c?.txt",
+		"ف\u200cار.m":            "ف\u200cار.m", // ZWNJ used in Persian
+	}
+
+	for name, expected := range valid {
+		got, err := NormalizeFileName(name)
+		if err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+		if got != expected {
+			t.Errorf("Bad normalization of %q: expected %q, got %q", name, expected, got)
+		}
+	}
+
+	invalid := []string{
+		"",
+		".",
+		"..",
+		"../etc/passwd",
+		"dir/file",
+		"dir\\file",
+		".hidden",
+		"new\nline",
+		"nul\x00",
+		"\xff\xfe",
+		"photo\u202egpj.exe",
+		strings.Repeat("a", 151),
+	}
+
+	for _, name := range invalid {
+		if _, err := NormalizeFileName(name); err != ErrFileNameNotValid {
+			t.Errorf("Expected %q to be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestStorageFileName(t *testing.T) {
+	// plain names are kept for compatibility with existing files
+	if name := StorageFileName("Video_1.mp4"); name != "Video_1.mp4" {
+		t.Errorf("Plain name changed: %s", name)
+	}
+
+	seen := map[string]string{}
+
+	for _, name := range []string{"Отчёт.mp4", "отчёт.mp4", "ОТЧЁТ.mp4", "my report.pdf", "a:b", strings.Repeat("ж", 75)} {
+		storage := StorageFileName(name)
+
+		if !plainFileRegexp.MatchString(strings.TrimPrefix(storage, encodedFileNamePrefix)) || len(storage) > 255 {
+			t.Errorf("Unsafe storage name for %q: %q", name, storage)
+		}
+
+		if other, ok := seen[strings.ToLower(storage)]; ok {
+			t.Errorf("Storage names of %q and %q collide ignoring case", name, other)
+		}
+		seen[strings.ToLower(storage)] = name
+
+		if display := DisplayFileName(storage); display != name {
+			t.Errorf("Round trip failed: expected %q, got %q", name, display)
+		}
+	}
+}
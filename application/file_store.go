@@ -4,19 +4,47 @@ import (
 	"context"
 	"errors"
 	"io"
+	"sort"
+	"time"
 )
 
 var (
 	ErrNoUserCtx = errors.New("no user in context")
 	ErrConflict  = errors.New("conflict")
+	ErrNotFound  = errors.New("not found")
 )
 
 type FileInfo struct {
-	Size int64
+	Name    string
+	Size    int64
+	Closed  bool
+	Updated time.Time
 }
 
 type FileStore interface {
 	GetFileInfo(ctx context.Context, fileName string) (*FileInfo, error)
 	AppendFile(ctx context.Context, file string, data io.ReadCloser) error
-	CloseFile(ctx context.Context, file string) error
+	// CloseFile returns name the file was closed under, which differs from
+	// file for new versions. It is file when already closed, or the version
+	// closed last under CollisionVersion, empty when nothing was uploaded.
+	CloseFile(ctx context.Context, file string) (string, error)
+	// DeleteFile removes upload in progress, closed files are kept.
+	DeleteFile(ctx context.Context, file string) error
+	// RemoveClosedFile removes closed file or version of exactly that name,
+	// ErrNotFound if there is none. Uploads in progress are kept.
+	RemoveClosedFile(ctx context.Context, file string) error
+	// OpenFile returns content of a closed file, ErrNotFound otherwise.
+	OpenFile(ctx context.Context, file string) (io.ReadCloser, error)
+	// ListFiles returns closed files and uploads in progress.
+	ListFiles(ctx context.Context) ([]FileInfo, error)
+}
+
+// sortFileInfos orders files by name, closed file before upload in progress.
+func sortFileInfos(files []FileInfo) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Name != files[j].Name {
+			return files[i].Name < files[j].Name
+		}
+		return files[i].Closed && !files[j].Closed
+	})
 }
@@ -0,0 +1,79 @@
+package application_test
+
+import (
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/horizontal-org/direct-upload/application/filestoretest"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLocalFileStore_Conformance(t *testing.T) {
+	filestoretest.Run(t, localFileStore(application.CollisionReject))
+}
+
+func TestLocalFileStore_Versioning(t *testing.T) {
+	filestoretest.RunVersioning(t, localFileStore(application.CollisionVersion))
+}
+
+func TestMemoryFileStore_Conformance(t *testing.T) {
+	filestoretest.Run(t, memoryFileStore(application.CollisionReject))
+}
+
+func TestMemoryFileStore_Versioning(t *testing.T) {
+	filestoretest.RunVersioning(t, memoryFileStore(application.CollisionVersion))
+}
+
+func TestS3FileStore_Conformance(t *testing.T) {
+	filestoretest.Run(t, s3FileStore(application.CollisionReject))
+}
+
+func TestS3FileStore_Versioning(t *testing.T) {
+	filestoretest.RunVersioning(t, s3FileStore(application.CollisionVersion))
+}
+
+func localFileStore(collision application.CollisionPolicy) filestoretest.Factory {
+	return func(t *testing.T) application.FileStore {
+		dir, err := ioutil.TempDir("", "direct-upload")
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		t.Cleanup(func() {
+			_ = os.RemoveAll(dir)
+		})
+
+		store, err := application.NewLocalFileStore(application.LocalFileStoreConfig{
+			Path:      dir,
+			Collision: collision,
+		}, nil, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		return store
+	}
+}
+
+func memoryFileStore(collision application.CollisionPolicy) filestoretest.Factory {
+	return func(t *testing.T) application.FileStore {
+		return application.NewMemoryFileStore(application.MemoryFileStoreConfig{
+			Collision: collision,
+		}, nil, zaptest.NewLogger(t))
+	}
+}
+
+func s3FileStore(collision application.CollisionPolicy) filestoretest.Factory {
+	return func(t *testing.T) application.FileStore {
+		store, err := application.NewS3FileStore(application.S3FileStoreConfig{
+			Prefix:    "files",
+			Collision: collision,
+		}, filestoretest.NewObjectStorage(), nil, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		return store
+	}
+}
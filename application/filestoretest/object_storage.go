@@ -0,0 +1,176 @@
+package filestoretest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ObjectStorage is an in-process stand-in for S3 implementing
+// application.ObjectStorage. It enforces the multipart minimal part size.
+type ObjectStorage struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	updated map[string]time.Time
+	uploads map[string]map[int][]byte
+	nextID  int
+}
+
+func NewObjectStorage() *ObjectStorage {
+	return &ObjectStorage{
+		objects: map[string][]byte{},
+		updated: map[string]time.Time{},
+		uploads: map[string]map[int][]byte{},
+	}
+}
+
+// Object returns stored object data.
+func (s *ObjectStorage) Object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[key]
+
+	return data, ok
+}
+
+// Keys returns keys of all stored objects.
+func (s *ObjectStorage) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func (s *ObjectStorage) HeadObject(key string) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[key]
+
+	return int64(len(data)), ok, nil
+}
+
+func (s *ObjectStorage) GetObject(key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, application.ErrObjectNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *ObjectStorage) PutObject(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = append([]byte(nil), data...)
+	s.updated[key] = time.Now()
+
+	return nil
+}
+
+func (s *ObjectStorage) DeleteObject(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, key)
+	delete(s.updated, key)
+
+	return nil
+}
+
+func (s *ObjectStorage) CreateMultipartUpload(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	id := fmt.Sprintf("%s#%d", key, s.nextID)
+	s.uploads[id] = map[int][]byte{}
+
+	return id, nil
+}
+
+func (s *ObjectStorage) UploadPart(key, uploadID string, number int, data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts, ok := s.uploads[uploadID]
+	if !ok {
+		return "", errors.New("no such upload")
+	}
+
+	parts[number] = append([]byte(nil), data...)
+
+	return fmt.Sprintf("\"etag-%d\"", number), nil
+}
+
+func (s *ObjectStorage) CompleteMultipartUpload(key, uploadID string, parts []application.ObjectPart) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	uploaded, ok := s.uploads[uploadID]
+	if !ok {
+		return errors.New("no such upload")
+	}
+
+	var buf bytes.Buffer
+
+	for i, part := range parts {
+		data := uploaded[part.Number]
+		if i < len(parts)-1 && len(data) < application.MinPartSize {
+			return errors.New("entity too small")
+		}
+
+		buf.Write(data)
+	}
+
+	s.objects[key] = buf.Bytes()
+	s.updated[key] = time.Now()
+	delete(s.uploads, uploadID)
+
+	return nil
+}
+
+func (s *ObjectStorage) AbortMultipartUpload(key, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.uploads, uploadID)
+
+	return nil
+}
+
+func (s *ObjectStorage) ListObjects(prefix string) ([]application.ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var objects []application.ObjectInfo
+
+	for key, data := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, application.ObjectInfo{Key: key, Size: int64(len(data)), Modified: s.updated[key]})
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+
+	return objects, nil
+}
@@ -0,0 +1,527 @@
+// Package filestoretest provides a conformance suite for application.FileStore
+// implementations and fakes useful for testing them.
+package filestoretest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/horizontal-org/direct-upload/application"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory returns a new, empty store. Stores returned for the same test are
+// expected to be independent.
+type Factory func(t *testing.T) application.FileStore
+
+// Run runs every conformance test against stores created by factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store application.FileStore)
+	}{
+		{"MissingUserContext", testMissingUserContext},
+		{"NonExistentFile", testNonExistentFile},
+		{"Append", testAppend},
+		{"Resume", testResume},
+		{"Close", testClose},
+		{"DoubleClose", testDoubleClose},
+		{"CloseNonExistent", testCloseNonExistent},
+		{"AppendAfterClose", testAppendAfterClose},
+		{"Delete", testDelete},
+		{"RemoveClosed", testRemoveClosed},
+		{"PartSuffix", testPartSuffix},
+		{"UnicodeNames", testUnicodeNames},
+		{"Open", testOpen},
+		{"UserIsolation", testUserIsolation},
+		{"ConcurrentAppends", testConcurrentAppends},
+		{"List", testList},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, factory(t))
+		})
+	}
+}
+
+// RunVersioning runs tests of application.CollisionVersion policy against
+// stores created by factory, which must be configured with the policy.
+func RunVersioning(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store application.FileStore)
+	}{
+		{"NewVersion", testNewVersion},
+		{"ResumeVersion", testResumeVersion},
+		{"DeleteKeepsVersions", testDeleteKeepsVersions},
+		{"RemoveVersion", testRemoveVersion},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, factory(t))
+		})
+	}
+}
+
+func testMissingUserContext(t *testing.T, store application.FileStore) {
+	ctx := context.Background()
+
+	if _, err := store.GetFileInfo(ctx, "file"); err != application.ErrNoUserCtx {
+		t.Errorf("GetFileInfo: expected ErrNoUserCtx, got %v", err)
+	}
+
+	if err := store.AppendFile(ctx, "file", data(10)); err != application.ErrNoUserCtx {
+		t.Errorf("AppendFile: expected ErrNoUserCtx, got %v", err)
+	}
+
+	if _, err := store.CloseFile(ctx, "file"); err != application.ErrNoUserCtx {
+		t.Errorf("CloseFile: expected ErrNoUserCtx, got %v", err)
+	}
+
+	if err := store.DeleteFile(ctx, "file"); err != application.ErrNoUserCtx {
+		t.Errorf("DeleteFile: expected ErrNoUserCtx, got %v", err)
+	}
+
+	if err := store.RemoveClosedFile(ctx, "file"); err != application.ErrNoUserCtx {
+		t.Errorf("RemoveClosedFile: expected ErrNoUserCtx, got %v", err)
+	}
+
+	if _, err := store.OpenFile(ctx, "file"); err != application.ErrNoUserCtx {
+		t.Errorf("OpenFile: expected ErrNoUserCtx, got %v", err)
+	}
+
+	if _, err := store.ListFiles(ctx); err != application.ErrNoUserCtx {
+		t.Errorf("ListFiles: expected ErrNoUserCtx, got %v", err)
+	}
+}
+
+func testNonExistentFile(t *testing.T, store application.FileStore) {
+	expectSize(t, store, newCtx(), "file", 0)
+}
+
+func testAppend(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "file", 100)
+	expectSize(t, store, ctx, "file", 100)
+}
+
+func testResume(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "file", 100)
+	mustAppend(t, store, ctx, "file", 50)
+	mustAppend(t, store, ctx, "file", 0)
+	expectSize(t, store, ctx, "file", 150)
+}
+
+func testClose(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "file", 100)
+	mustClose(t, store, ctx, "file")
+	expectSize(t, store, ctx, "file", 100)
+}
+
+func testDoubleClose(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "file", 100)
+	expectClosed(t, "file", mustClose(t, store, ctx, "file"))
+	expectClosed(t, "file", mustClose(t, store, ctx, "file"))
+	expectSize(t, store, ctx, "file", 100)
+}
+
+func testCloseNonExistent(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	expectClosed(t, "", mustClose(t, store, ctx, "file"))
+	expectSize(t, store, ctx, "file", 0)
+}
+
+func testAppendAfterClose(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "file", 100)
+	mustClose(t, store, ctx, "file")
+
+	if err := store.AppendFile(ctx, "file", data(10)); err != application.ErrConflict {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+
+	expectSize(t, store, ctx, "file", 100)
+}
+
+func testDelete(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	// appending file
+	mustAppend(t, store, ctx, "appending", 100)
+	mustDelete(t, store, ctx, "appending")
+	expectSize(t, store, ctx, "appending", 0)
+
+	// closed file is kept
+	mustAppend(t, store, ctx, "closed", 100)
+	mustClose(t, store, ctx, "closed")
+	mustDelete(t, store, ctx, "closed")
+	expectSize(t, store, ctx, "closed", 100)
+
+	if _, err := store.OpenFile(ctx, "closed"); err != nil {
+		t.Errorf("OpenFile closed after delete: %v", err)
+	}
+
+	// non-existent
+	mustDelete(t, store, ctx, "non-existent")
+}
+
+func testRemoveClosed(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "closed", 100)
+	mustClose(t, store, ctx, "closed")
+	mustRemove(t, store, ctx, "closed")
+	expectNotFound(t, store, ctx, "closed")
+
+	// upload in progress is not closed
+	mustAppend(t, store, ctx, "appending", 100)
+
+	if err := store.RemoveClosedFile(ctx, "appending"); err != application.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	expectSize(t, store, ctx, "appending", 100)
+}
+
+// testPartSuffix makes sure names used internally by stores for in-progress
+// uploads round-trip as regular names.
+func testPartSuffix(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "video.part", 100)
+	mustAppend(t, store, ctx, "video", 10)
+	mustClose(t, store, ctx, "video.part")
+
+	expectSize(t, store, ctx, "video.part", 100)
+	expectSize(t, store, ctx, "video", 10)
+
+	mustAppend(t, store, ctx, "video", 10)
+	expectSize(t, store, ctx, "video", 20)
+}
+
+func testUnicodeNames(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+	names := []string{"отчёт 2020.mp4", "تقرير.jpg", "報告.pdf", "Отчёт 2020.mp4"}
+
+	for i, name := range names {
+		mustAppend(t, store, ctx, name, 10*(i+1))
+	}
+
+	mustClose(t, store, ctx, names[0])
+
+	for i, name := range names {
+		expectSize(t, store, ctx, name, int64(10*(i+1)))
+	}
+}
+
+func testOpen(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	if _, err := store.OpenFile(ctx, "file"); err != application.ErrNotFound {
+		t.Errorf("OpenFile non-existent: expected ErrNotFound, got %v", err)
+	}
+
+	mustAppend(t, store, ctx, "file", 100)
+	mustAppend(t, store, ctx, "file", 50)
+
+	if _, err := store.OpenFile(ctx, "file"); err != application.ErrNotFound {
+		t.Errorf("OpenFile appending: expected ErrNotFound, got %v", err)
+	}
+
+	mustClose(t, store, ctx, "file")
+
+	r, err := store.OpenFile(ctx, "file")
+	if err != nil {
+		t.Fatalf("OpenFile closed: %v", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer r.Close()
+
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Reading closed file: %v", err)
+	}
+
+	expected, _ := ioutil.ReadAll(io.MultiReader(data(100), data(50)))
+	if !bytes.Equal(content, expected) {
+		t.Errorf("Content of closed file differs from uploaded data")
+	}
+}
+
+func testUserIsolation(t *testing.T, store application.FileStore) {
+	alice, bob := newCtx(), newCtx()
+
+	mustAppend(t, store, alice, "file", 100)
+	mustClose(t, store, alice, "file")
+
+	expectSize(t, store, bob, "file", 0)
+	mustAppend(t, store, bob, "file", 10)
+	expectSize(t, store, bob, "file", 10)
+	expectSize(t, store, alice, "file", 100)
+}
+
+// testConcurrentAppends appends to different files of the same user and to
+// same named files of different users at the same time. Concurrent appends
+// to a single file are not ordered by the protocol, so they are not tested.
+func testConcurrentAppends(t *testing.T, store application.FileStore) {
+	const workers = 8
+	const appends = 5
+	const size = 1000
+
+	ctxs := []context.Context{newCtx(), newCtx()}
+
+	var wg sync.WaitGroup
+
+	for _, ctx := range ctxs {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+
+			go func(ctx context.Context, file string) {
+				defer wg.Done()
+
+				for i := 0; i < appends; i++ {
+					if err := store.AppendFile(ctx, file, data(size)); err != nil {
+						t.Errorf("AppendFile %s: %v", file, err)
+						return
+					}
+				}
+
+				if _, err := store.CloseFile(ctx, file); err != nil {
+					t.Errorf("CloseFile %s: %v", file, err)
+				}
+			}(ctx, fmt.Sprintf("file-%d", w))
+		}
+	}
+
+	wg.Wait()
+
+	for _, ctx := range ctxs {
+		for w := 0; w < workers; w++ {
+			expectSize(t, store, ctx, fmt.Sprintf("file-%d", w), appends*size)
+		}
+	}
+}
+
+func testList(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "b.mp4", 100)
+	mustClose(t, store, ctx, "b.mp4")
+	mustAppend(t, store, ctx, "a.mp4", 10)
+	mustAppend(t, store, newCtx(), "other.mp4", 10)
+
+	expectFiles(t, store, ctx, []application.FileInfo{
+		{Name: "a.mp4", Size: 10},
+		{Name: "b.mp4", Size: 100, Closed: true},
+	})
+}
+
+func testNewVersion(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "statement.mp4", 100)
+	mustClose(t, store, ctx, "statement.mp4")
+
+	// re-upload starts from scratch instead of resuming the closed file
+	expectSize(t, store, ctx, "statement.mp4", 0)
+	mustAppend(t, store, ctx, "statement.mp4", 50)
+	expectSize(t, store, ctx, "statement.mp4", 50)
+	expectClosed(t, "statement (2).mp4", mustClose(t, store, ctx, "statement.mp4"))
+
+	mustAppend(t, store, ctx, "statement.mp4", 20)
+	expectClosed(t, "statement (3).mp4", mustClose(t, store, ctx, "statement.mp4"))
+
+	// closing again returns the version closed last
+	expectClosed(t, "statement (3).mp4", mustClose(t, store, ctx, "statement.mp4"))
+	expectClosed(t, "", mustClose(t, store, ctx, "statement"))
+
+	expectFiles(t, store, ctx, []application.FileInfo{
+		{Name: "statement (2).mp4", Size: 50, Closed: true},
+		{Name: "statement (3).mp4", Size: 20, Closed: true},
+		{Name: "statement.mp4", Size: 100, Closed: true},
+	})
+
+	for name, size := range map[string]int{"statement.mp4": 100, "statement (2).mp4": 50, "statement (3).mp4": 20} {
+		r, err := store.OpenFile(ctx, name)
+		if err != nil {
+			t.Fatalf("OpenFile %s: %v", name, err)
+		}
+
+		content, _ := ioutil.ReadAll(r)
+		_ = r.Close()
+
+		if len(content) != size {
+			t.Errorf("Bad size of version %s: expected %d, got %d", name, size, len(content))
+		}
+	}
+}
+
+func testResumeVersion(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "file", 100)
+	mustClose(t, store, ctx, "file")
+
+	mustAppend(t, store, ctx, "file", 10)
+	mustAppend(t, store, ctx, "file", 10)
+	expectSize(t, store, ctx, "file", 20)
+	mustClose(t, store, ctx, "file")
+
+	expectFiles(t, store, ctx, []application.FileInfo{
+		{Name: "file", Size: 100, Closed: true},
+		{Name: "file (2)", Size: 20, Closed: true},
+	})
+}
+
+func testDeleteKeepsVersions(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "file.txt", 100)
+	mustClose(t, store, ctx, "file.txt")
+	mustAppend(t, store, ctx, "file.txt", 10)
+
+	// removes only the upload in progress
+	mustDelete(t, store, ctx, "file.txt")
+	mustDelete(t, store, ctx, "file.txt")
+
+	expectFiles(t, store, ctx, []application.FileInfo{
+		{Name: "file.txt", Size: 100, Closed: true},
+	})
+}
+
+// testRemoveVersion removes a closed version by name, as quarantine does,
+// while the upload of a next version goes on.
+func testRemoveVersion(t *testing.T, store application.FileStore) {
+	ctx := newCtx()
+
+	mustAppend(t, store, ctx, "file.txt", 100)
+	mustClose(t, store, ctx, "file.txt")
+	mustAppend(t, store, ctx, "file.txt", 50)
+	mustClose(t, store, ctx, "file.txt")
+	mustAppend(t, store, ctx, "file.txt", 10)
+
+	mustRemove(t, store, ctx, "file (2).txt")
+	expectNotFound(t, store, ctx, "file (2).txt")
+	mustRemove(t, store, ctx, "file.txt")
+	expectNotFound(t, store, ctx, "file.txt")
+
+	expectFiles(t, store, ctx, []application.FileInfo{
+		{Name: "file.txt", Size: 10},
+	})
+}
+
+func newCtx() context.Context {
+	return application.NewContext(context.Background(), &application.User{
+		Username: uuid.New().String(),
+	})
+}
+
+func data(size int) io.ReadCloser {
+	buf := make([]byte, size)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(buf))
+}
+
+func mustAppend(t *testing.T, store application.FileStore, ctx context.Context, file string, size int) {
+	t.Helper()
+
+	if err := store.AppendFile(ctx, file, data(size)); err != nil {
+		t.Fatalf("AppendFile %s: %v", file, err)
+	}
+}
+
+// mustClose returns name the file was closed under.
+func mustClose(t *testing.T, store application.FileStore, ctx context.Context, file string) string {
+	t.Helper()
+
+	closed, err := store.CloseFile(ctx, file)
+	if err != nil {
+		t.Fatalf("CloseFile %s: %v", file, err)
+	}
+
+	return closed
+}
+
+func expectClosed(t *testing.T, expected, closed string) {
+	t.Helper()
+
+	if closed != expected {
+		t.Errorf("Expected file closed as %q, got %q", expected, closed)
+	}
+}
+
+func mustDelete(t *testing.T, store application.FileStore, ctx context.Context, file string) {
+	t.Helper()
+
+	if err := store.DeleteFile(ctx, file); err != nil {
+		t.Fatalf("DeleteFile %s: %v", file, err)
+	}
+}
+
+func mustRemove(t *testing.T, store application.FileStore, ctx context.Context, file string) {
+	t.Helper()
+
+	if err := store.RemoveClosedFile(ctx, file); err != nil {
+		t.Fatalf("RemoveClosedFile %s: %v", file, err)
+	}
+}
+
+func expectNotFound(t *testing.T, store application.FileStore, ctx context.Context, file string) {
+	t.Helper()
+
+	if _, err := store.OpenFile(ctx, file); err != application.ErrNotFound {
+		t.Errorf("OpenFile %s: expected ErrNotFound, got %v", file, err)
+	}
+}
+
+func expectSize(t *testing.T, store application.FileStore, ctx context.Context, file string, size int64) {
+	t.Helper()
+
+	info, err := store.GetFileInfo(ctx, file)
+	if err != nil {
+		t.Fatalf("GetFileInfo %s: %v", file, err)
+	}
+
+	if info.Size != size {
+		t.Errorf("Bad size of %s: expected %d, got %d", file, size, info.Size)
+	}
+}
+
+// expectFiles compares listed files ignoring modification times.
+func expectFiles(t *testing.T, store application.FileStore, ctx context.Context, expected []application.FileInfo) {
+	t.Helper()
+
+	files, err := store.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+
+	for i := range files {
+		files[i].Updated = time.Time{}
+	}
+
+	if fmt.Sprint(files) != fmt.Sprint(expected) {
+		t.Errorf("Bad files listed: expected %v, got %v", expected, files)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package application
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkCount returns number of hard links to the file.
+func linkCount(info os.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(stat.Nlink), true
+}
@@ -0,0 +1,9 @@
+package application
+
+import "os"
+
+// linkCount is not available on windows, stored copies are then only removed
+// together with the whole storage.
+func linkCount(_ os.FileInfo) (uint64, bool) {
+	return 0, false
+}
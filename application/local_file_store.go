@@ -2,35 +2,61 @@ package application
 
 import (
 	"context"
+	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 type LocalFileStore struct {
-	config LocalFileStoreConfig
-	logger *zap.Logger
+	config    LocalFileStoreConfig
+	level     zstd.EncoderLevel
+	objectsMu sync.Mutex
+	events    *EventBus
+	logger    *zap.Logger
 }
 
 type LocalFileStoreConfig struct {
-	Path string
+	Path      string
+	Collision CollisionPolicy
+	// Dedupe keeps a single copy of identical closed files, see DedupeProcessor.
+	Dedupe      bool
+	Compression CompressionConfig
 }
 
 type localFile struct {
-	path   string
-	size   int64
-	exists bool
-	closed bool
+	path       string
+	size       int64
+	exists     bool
+	closed     bool
+	compressed bool
 }
 
-// todo: make this unique for every file so we can accept ".part" extensions
-const appendableSuffix = ".part"
+// stagingDir keeps files still being uploaded, separate from user folders so
+// closing a file never depends on its name. Usernames can't start with a dot,
+// so it never clashes with a user folder.
+const stagingDir = ".staging"
+
+// legacyAppendableSuffix marked files being uploaded inside user folders
+// before the staging directory was introduced.
+const legacyAppendableSuffix = ".part"
+
+const migratedMarker = ".migrated"
+
+func NewLocalFileStore(config LocalFileStoreConfig, events *EventBus, logger *zap.Logger) (*LocalFileStore, error) {
+	level, err := config.Compression.encoderLevel()
+	if err != nil {
+		return nil, err
+	}
 
-func NewLocalFileStore(config LocalFileStoreConfig, logger *zap.Logger) (*LocalFileStore, error) {
 	return &LocalFileStore{
 		config: config,
+		level:  level,
+		events: events,
 		logger: logger,
 	}, nil
 }
@@ -41,10 +67,10 @@ func (m *LocalFileStore) GetFileInfo(ctx context.Context, file string) (*FileInf
 		return nil, ErrNoUserCtx
 	}
 
-	localFile, err := m.getLocalFile(user.Username, file)
+	localFile, err := m.getLocalFile(user.Owner(), file)
 	if err != nil {
 		m.logger.Error("Error getting local file",
-			zap.String("username", user.Username), zap.String("file", file), zap.Error(err))
+			zap.String("owner", user.Owner()), zap.String("file", file), zap.Error(err))
 		return nil, err
 	}
 
@@ -58,18 +84,17 @@ func (m *LocalFileStore) GetFileInfo(ctx context.Context, file string) (*FileInf
 func (m *LocalFileStore) AppendFile(ctx context.Context, file string, data io.ReadCloser) error {
 	user, ok := UserFromContext(ctx)
 	if !ok {
-		m.logger.Debug("AppendFile: no User in ctx",
-			zap.String("username", user.Username), zap.String("file", file))
+		m.logger.Debug("AppendFile: no User in ctx", zap.String("file", file))
 		return ErrNoUserCtx
 	}
 
 	m.logger.Debug("AppendFile: started",
-		zap.String("username", user.Username), zap.String("file", file))
+		zap.String("owner", user.Owner()), zap.String("file", file))
 
-	localFile, err := m.getLocalFile(user.Username, file)
+	localFile, err := m.getLocalFile(user.Owner(), file)
 	if err != nil {
 		m.logger.Error("Error getting local file",
-			zap.String("username", user.Username), zap.String("file", file), zap.Error(err))
+			zap.String("owner", user.Owner()), zap.String("file", file), zap.Error(err))
 		return err
 	}
 
@@ -79,9 +104,21 @@ func (m *LocalFileStore) AppendFile(ctx context.Context, file string, data io.Re
 	}
 
 	// create dir, ignore error
-	m.createUserDir(user.Username)
+	m.createUserDir(user.Owner())
+
+	// names are checked once on creation, reading the folder on every chunk
+	// would make appending slow in large folders
+	if !localFile.exists && m.hasCaseConflict(user.Owner(), file) {
+		m.logger.Error("File name differs from existing file only by case", zap.String("file", file))
+		return ErrConflict
+	}
+
+	flag := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	if localFile.compressed {
+		flag = os.O_CREATE | os.O_RDWR
+	}
 
-	out, err := os.OpenFile(localFile.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	out, err := os.OpenFile(localFile.path, flag, 0644)
 	if err != nil {
 		m.logger.Error("Error opening file", zap.Error(err), zap.String("file", file))
 		return err
@@ -89,7 +126,14 @@ func (m *LocalFileStore) AppendFile(ctx context.Context, file string, data io.Re
 	//noinspection GoUnhandledErrorResult
 	defer out.Close()
 
-	written, err := io.Copy(out, data)
+	var written int64
+
+	if localFile.compressed {
+		written, err = appendCompressed(out, data, m.level)
+	} else {
+		written, err = io.Copy(out, data)
+	}
+
 	if err != nil {
 		m.logger.Error("Error writing to file", zap.Error(err), zap.String("file", file))
 		return err
@@ -103,89 +147,426 @@ func (m *LocalFileStore) AppendFile(ctx context.Context, file string, data io.Re
 
 	m.logger.Info("Appending file", zap.String("file", file), zap.Int64("written", written))
 
+	if !localFile.exists {
+		m.events.Publish(Event{Type: EventUploadStarted, Username: user.Username, Project: user.Project, File: file})
+	}
+
 	return nil
 }
 
-func (m *LocalFileStore) CloseFile(ctx context.Context, file string) error {
+func (m *LocalFileStore) CloseFile(ctx context.Context, file string) (string, error) {
 	user, ok := UserFromContext(ctx)
 	if !ok {
-		return ErrNoUserCtx
+		return "", ErrNoUserCtx
 	}
 
-	localFile, err := m.getLocalFile(user.Username, file)
+	localFile, err := m.getLocalFile(user.Owner(), file)
 	if err != nil {
 		m.logger.Error("Error getting local file",
-			zap.String("username", user.Username), zap.String("file", file), zap.Error(err))
-		return err
+			zap.String("owner", user.Owner()), zap.String("file", file), zap.Error(err))
+		return "", err
+	}
+
+	if !localFile.exists && m.config.Collision == CollisionVersion {
+		files, err := m.ListFiles(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		// retried close refers to the version closed last
+		if last := lastVersionName(files, file); last != "" {
+			m.logger.Info("Closing already closed file", zap.String("file", file), zap.String("version", last))
+			return last, nil
+		}
 	}
 
 	if !localFile.exists {
 		m.logger.Warn("Closing non-existent file", zap.String("file", file))
-		return nil
+		return "", nil
 	}
 
 	if localFile.closed {
 		m.logger.Info("Closing already closed file", zap.String("file", file))
-		return nil
+		return file, nil
+	}
+
+	target := file
+
+	if m.config.Collision == CollisionVersion {
+		target, err = nextVersionName(file, func(name string) (bool, error) {
+			closed, err := m.getClosedFile(user.Owner(), name)
+			if err != nil {
+				return false, err
+			}
+			return closed.exists, nil
+		})
+		if err != nil {
+			m.logger.Error("Error choosing version name", zap.Error(err), zap.String("file", file))
+			return "", err
+		}
 	}
 
-	err = os.Rename(localFile.path, strings.TrimSuffix(localFile.path, appendableSuffix))
+	targetPath := m.getFullPath(user.Owner(), target)
+	if localFile.compressed {
+		targetPath += compressedSuffix
+	}
+
+	err = os.Rename(localFile.path, targetPath)
 	if err != nil {
 		m.logger.Error("Error renaming file", zap.Error(err), zap.String("file", file))
+		return "", err
+	}
+
+	m.logger.Info("Closing file", zap.String("file", file), zap.String("version", target))
+
+	m.events.Publish(Event{Type: EventFileClosed, Username: user.Username, Project: user.Project, File: target})
+
+	return target, nil
+}
+
+func (m *LocalFileStore) DeleteFile(ctx context.Context, file string) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return ErrNoUserCtx
+	}
+
+	localFile, err := m.findFile(m.getStagingPath(user.Owner(), file), file, false)
+	if err != nil {
+		m.logger.Error("Error getting local file",
+			zap.String("owner", user.Owner()), zap.String("file", file), zap.Error(err))
 		return err
 	}
 
-	m.logger.Info("Closing file", zap.String("file", file))
+	if !localFile.exists {
+		m.logger.Warn("Deleting non-existent upload", zap.String("file", file))
+		return nil
+	}
+
+	err = os.Remove(localFile.path)
+	if err != nil {
+		m.logger.Error("Error removing file", zap.Error(err), zap.String("file", file))
+		return err
+	}
+
+	m.logger.Info("Deleting upload", zap.String("file", file))
+
+	m.events.Publish(Event{Type: EventFileDeleted, Username: user.Username, Project: user.Project, File: file})
+
+	return nil
+}
+
+func (m *LocalFileStore) RemoveClosedFile(ctx context.Context, file string) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return ErrNoUserCtx
+	}
+
+	localFile, err := m.getClosedFile(user.Owner(), file)
+	if err != nil {
+		return err
+	}
+
+	if !localFile.exists {
+		return ErrNotFound
+	}
+
+	if m.config.Dedupe {
+		err = m.release(localFile.path)
+		if err != nil {
+			m.logger.Error("Error releasing stored copy", zap.Error(err), zap.String("file", file))
+			return err
+		}
+	}
+
+	err = os.Remove(localFile.path)
+	if err != nil {
+		m.logger.Error("Error removing file", zap.Error(err), zap.String("file", file))
+		return err
+	}
+
+	m.logger.Info("Removing closed file", zap.String("file", file))
+
+	m.events.Publish(Event{Type: EventFileDeleted, Username: user.Username, Project: user.Project, File: file})
 
 	return nil
 }
 
-func (m *LocalFileStore) getPartName(file string) string {
-	if !strings.HasSuffix(file, appendableSuffix) {
-		return file + appendableSuffix
+func (m *LocalFileStore) OpenFile(ctx context.Context, file string) (io.ReadCloser, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	localFile, err := m.getClosedFile(user.Owner(), file)
+	if err != nil {
+		return nil, err
+	}
+
+	if !localFile.exists {
+		return nil, ErrNotFound
+	}
+
+	if localFile.compressed {
+		return openCompressed(localFile.path)
+	}
+
+	return os.Open(localFile.path)
+}
+
+// LocalPath returns path of a closed file on the local disk,
+// ErrStoredCompressed if the file content is not readable there directly.
+func (m *LocalFileStore) LocalPath(ctx context.Context, file string) (string, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return "", ErrNoUserCtx
 	}
 
-	return file
+	localFile, err := m.getClosedFile(user.Owner(), file)
+	if err != nil {
+		return "", err
+	}
+
+	if !localFile.exists {
+		return "", ErrNotFound
+	}
+
+	if localFile.compressed {
+		return "", ErrStoredCompressed
+	}
+
+	return localFile.path, nil
+}
+
+// ListFiles returns closed files, including all versions, and uploads in
+// progress of the user in context.
+func (m *LocalFileStore) ListFiles(ctx context.Context) ([]FileInfo, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	var files []FileInfo
+
+	for _, dir := range []struct {
+		path   string
+		closed bool
+	}{
+		{m.getFullDir(user.Owner()), true},
+		{m.getStagingDir(user.Owner()), false},
+	} {
+		entries, err := ioutil.ReadDir(dir.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !entry.Mode().IsRegular() {
+				continue
+			}
+
+			info := FileInfo{
+				Name:    DisplayFileName(entry.Name()),
+				Size:    entry.Size(),
+				Closed:  dir.closed,
+				Updated: entry.ModTime(),
+			}
+
+			if strings.HasSuffix(entry.Name(), compressedSuffix) {
+				info.Name = DisplayFileName(strings.TrimSuffix(entry.Name(), compressedSuffix))
+
+				info.Size, err = compressedSize(filepath.Join(dir.path, entry.Name()))
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			files = append(files, info)
+		}
+	}
+
+	sortFileInfos(files)
+
+	return files, nil
+}
+
+// Migrate moves uploads left in progress by the old layout, where they were
+// kept in user folders with ".part" suffix, into the staging directory. It
+// runs once, later ".part" files in user folders are regular closed files.
+func (m *LocalFileStore) Migrate() error {
+	staging := filepath.Join(m.config.Path, stagingDir)
+	marker := filepath.Join(staging, migratedMarker)
+
+	if _, err := os.Stat(marker); err == nil {
+		return nil
+	}
+
+	users, err := ioutil.ReadDir(m.config.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, user := range users {
+		if !user.IsDir() || strings.HasPrefix(user.Name(), ".") {
+			continue
+		}
+
+		err = m.migrateUserDir(user.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.MkdirAll(staging, 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(marker, nil, 0644)
+}
+
+func (m *LocalFileStore) migrateUserDir(username string) error {
+	files, err := ioutil.ReadDir(m.getFullDir(username))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if !f.Mode().IsRegular() || !strings.HasSuffix(f.Name(), legacyAppendableSuffix) {
+			continue
+		}
+
+		file := strings.TrimSuffix(f.Name(), legacyAppendableSuffix)
+
+		// closed file always took precedence, so this upload was abandoned
+		if _, err := os.Stat(m.getFullPath(username, file)); err == nil {
+			m.logger.Warn("Leaving stale .part file next to closed file",
+				zap.String("username", username), zap.String("file", f.Name()))
+			continue
+		}
+
+		err = os.MkdirAll(m.getStagingDir(username), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = os.Rename(filepath.Join(m.getFullDir(username), f.Name()), m.getStagingPath(username, file))
+		if err != nil {
+			return err
+		}
+
+		m.logger.Info("Migrated upload to staging",
+			zap.String("username", username), zap.String("file", file))
+	}
+
+	return nil
 }
 
 func (m *LocalFileStore) getFullPath(username string, file string) string {
-	return filepath.Join(m.getFullDir(username), file)
+	return filepath.Join(m.getFullDir(username), StorageFileName(file))
 }
 
 func (m *LocalFileStore) getFullDir(username string) string {
 	return filepath.Join(m.config.Path, username)
 }
 
+func (m *LocalFileStore) getStagingPath(username string, file string) string {
+	return filepath.Join(m.getStagingDir(username), StorageFileName(file))
+}
+
+func (m *LocalFileStore) getStagingDir(username string) string {
+	return filepath.Join(m.config.Path, stagingDir, username)
+}
+
 func (m *LocalFileStore) getLocalFile(username string, file string) (*localFile, error) {
-	// check if there is a closed file
-	closed, err := newLocalFile(m.getFullPath(username, file), true)
-	if err != nil {
-		return nil, err
+	// closed file takes precedence, unless uploading it again starts a new version
+	if m.config.Collision != CollisionVersion {
+		closed, err := m.getClosedFile(username, file)
+		if err != nil {
+			return nil, err
+		}
+
+		if closed.exists {
+			return closed, nil
+		}
 	}
 
-	if closed.exists {
-		return closed, nil
+	// return current or future staging file
+	return m.findFile(m.getStagingPath(username, file), file, false)
+}
+
+func (m *LocalFileStore) getClosedFile(username string, file string) (*localFile, error) {
+	return m.findFile(m.getFullPath(username, file), file, true)
+}
+
+// findFile returns the plain or compressed file stored at path, or the one
+// new data goes to when there is none.
+func (m *LocalFileStore) findFile(path string, file string, closed bool) (*localFile, error) {
+	for _, compressed := range []bool{false, true} {
+		found := path
+		if compressed {
+			found += compressedSuffix
+		}
+
+		localFile, err := newLocalFile(found, closed, compressed)
+		if err != nil {
+			return nil, err
+		}
+
+		if localFile.exists {
+			return localFile, nil
+		}
 	}
 
-	// closed does not exist, return current or future .part file
-	part, err := newLocalFile(m.getFullPath(username, m.getPartName(file)), false)
-	if err != nil {
-		return nil, err
+	compressed := m.config.Compression.compressible(file)
+	if compressed {
+		path += compressedSuffix
+	}
+
+	return &localFile{
+		path:       path,
+		closed:     closed,
+		compressed: compressed,
+	}, nil
+}
+
+// hasCaseConflict reports whether user has a file whose name differs only by
+// case, which would be the same file on case-insensitive filesystems.
+func (m *LocalFileStore) hasCaseConflict(username string, file string) bool {
+	name := StorageFileName(file)
+
+	for _, dir := range []string{m.getFullDir(username), m.getStagingDir(username)} {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			entryName := strings.TrimSuffix(entry.Name(), compressedSuffix)
+
+			if entryName != name && strings.EqualFold(entryName, name) {
+				return true
+			}
+		}
 	}
 
-	return part, nil
+	return false
 }
 
 func (m *LocalFileStore) createUserDir(username string) {
-	dir := m.getFullDir(username)
-	_ = os.Mkdir(dir, os.ModeDir)
-	m.logger.Debug("Dir created", zap.String("path", dir))
+	for _, dir := range []string{m.getFullDir(username), m.getStagingDir(username)} {
+		_ = os.MkdirAll(dir, 0755)
+		m.logger.Debug("Dir created", zap.String("path", dir))
+	}
 }
 
-func newLocalFile(path string, closed bool) (*localFile, error) {
+func newLocalFile(path string, closed bool, compressed bool) (*localFile, error) {
 	file := &localFile{
-		path:   path,
-		closed: closed,
+		path:       path,
+		closed:     closed,
+		compressed: compressed,
 	}
 
 	stat, err := os.Stat(file.path)
@@ -201,5 +582,12 @@ func newLocalFile(path string, closed bool) (*localFile, error) {
 	file.exists = true
 	file.size = stat.Size()
 
+	if compressed {
+		file.size, err = compressedSize(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return file, nil
 }
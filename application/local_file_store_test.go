@@ -11,19 +11,29 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
 	"testing"
 )
 
-const PathTest = "./"
-const AppendableSuffix = ".part"
-const AppendableSuffixPattern = "*" + AppendableSuffix
+var PathTest string
 
 var (
 	UsernameTest    = uuid.New().String()
 	NonExistentTest = uuid.New().String()
 )
 
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "direct-upload")
+	if err != nil {
+		panic(err)
+	}
+
+	PathTest = dir
+	code := m.Run()
+
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestManager_GetFileInfo(t *testing.T) {
 	// create application
 	fileManager := newManager(t)
@@ -45,7 +55,7 @@ func TestManager_GetFileInfo(t *testing.T) {
 
 	file, written := prepareAppendingFile(t)
 
-	fileInfo, err = fileManager.GetFileInfo(newCtx(), baseNoExt(file.Name()))
+	fileInfo, err = fileManager.GetFileInfo(newCtx(), path.Base(file.Name()))
 	if err != nil {
 		t.Error("Error while running test", err)
 	}
@@ -59,8 +69,6 @@ func TestManager_AppendFile(t *testing.T) {
 
 	// todo: test no ctx
 
-	// todo: handle *.part filenames
-
 	// test append to new file, user folder not exist
 	err := fileManager.AppendFile(newCtx(), NonExistentTest, newNopCloser(t, 100))
 	if err != nil {
@@ -74,7 +82,7 @@ func TestManager_AppendFile(t *testing.T) {
 
 	file, _ := prepareAppendingFile(t)
 
-	err = fileManager.AppendFile(newCtx(), baseNoExt(file.Name()), newNopCloser(t, 100))
+	err = fileManager.AppendFile(newCtx(), path.Base(file.Name()), newNopCloser(t, 100))
 	if err != nil {
 		t.Error("Error while running test", err)
 	}
@@ -95,7 +103,7 @@ func TestManager_CloseFile(t *testing.T) {
 	// todo: test no ctx
 
 	// test closing non-existent file
-	err := fileManager.CloseFile(newCtx(), NonExistentTest)
+	_, err := fileManager.CloseFile(newCtx(), NonExistentTest)
 	if err != nil {
 		t.Error("Error while running test", err)
 	}
@@ -106,7 +114,7 @@ func TestManager_CloseFile(t *testing.T) {
 
 	file, _ := prepareAppendingFile(t)
 
-	err = fileManager.CloseFile(newCtx(), baseNoExt(file.Name()))
+	_, err = fileManager.CloseFile(newCtx(), path.Base(file.Name()))
 	if err != nil {
 		t.Error("Error while running test", err)
 	}
@@ -114,16 +122,127 @@ func TestManager_CloseFile(t *testing.T) {
 	// test closing closed file
 	file, _ = prepareClosedFile(t)
 
-	err = fileManager.CloseFile(newCtx(), baseNoExt(file.Name()))
+	_, err = fileManager.CloseFile(newCtx(), path.Base(file.Name()))
+	if err != nil {
+		t.Error("Error while running test", err)
+	}
+}
+
+func TestManager_CaseConflict(t *testing.T) {
+	fileManager := newManager(t)
+	defer cleanUserDir(t)
+
+	err := fileManager.AppendFile(newCtx(), "Video.mp4", newNopCloser(t, 100))
+	if err != nil {
+		t.Error("Error while running test", err)
+	}
+
+	err = fileManager.AppendFile(newCtx(), "video.mp4", newNopCloser(t, 100))
+	if err != ErrConflict {
+		t.Error("Error while running test: ", err)
+	}
+
+	// upload in progress is not checked again on further chunks
+	err = ioutil.WriteFile(fileManager.getStagingPath(UsernameTest, "VIDEO.mp4"), nil, 0644)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	err = fileManager.AppendFile(newCtx(), "Video.mp4", newNopCloser(t, 100))
 	if err != nil {
 		t.Error("Error while running test", err)
 	}
+
+	if info, _ := fileManager.GetFileInfo(newCtx(), "Video.mp4"); info.Size != 200 {
+		t.Errorf("Expected 200 bytes appended, got %d", info.Size)
+	}
+}
+
+func TestManager_ProjectFolder(t *testing.T) {
+	fileManager := newManager(t)
+	defer cleanUserDir(t)
+
+	project := uuid.New().String()
+	defer os.RemoveAll(filepath.Join(PathTest, ProjectOwner(project)))
+
+	ctx := NewContext(context.TODO(), &User{Username: UsernameTest, Project: project})
+
+	err := fileManager.AppendFile(ctx, "report.pdf", newNopCloser(t, 100))
+	if err != nil {
+		t.Error("Error while running test", err)
+	}
+
+	_, err = fileManager.CloseFile(ctx, "report.pdf")
+	if err != nil {
+		t.Error("Error while running test", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(PathTest, "@"+project, "report.pdf")); err != nil {
+		t.Errorf("File not stored in project folder: %v", err)
+	}
+
+	fileInfo, _ := fileManager.GetFileInfo(newCtx(), "report.pdf")
+	if fileInfo.Size != 0 {
+		t.Errorf("Project file visible in user folder")
+	}
+}
+
+func TestManager_Migrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direct-upload-migrate")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(dir)
+
+	userDir := filepath.Join(dir, UsernameTest)
+	_ = os.MkdirAll(userDir, 0755)
+
+	// in progress, abandoned next to closed file, and closed
+	for name, size := range map[string]int{"a.mp4.part": 10, "b.mp4.part": 20, "b.mp4": 30} {
+		if err := ioutil.WriteFile(filepath.Join(userDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal("Error while running test", err)
+		}
+	}
+
+	fileManager, _ := NewLocalFileStore(LocalFileStoreConfig{Path: dir}, nil, zaptest.NewLogger(t))
+
+	err = fileManager.Migrate()
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, stagingDir, UsernameTest, "a.mp4")); err != nil {
+		t.Errorf("Upload not moved to staging: %v", err)
+	}
+
+	fileInfo, _ := fileManager.GetFileInfo(newCtx(), "a.mp4")
+	if fileInfo.Size != 10 {
+		t.Errorf("Bad size of migrated upload: expected %d, got %d", 10, fileInfo.Size)
+	}
+
+	fileInfo, _ = fileManager.GetFileInfo(newCtx(), "b.mp4")
+	if fileInfo.Size != 30 {
+		t.Errorf("Bad size of closed file: expected %d, got %d", 30, fileInfo.Size)
+	}
+
+	// second run must not touch new ".part" files
+	_ = ioutil.WriteFile(filepath.Join(userDir, "c.part"), make([]byte, 5), 0644)
+
+	err = fileManager.Migrate()
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	fileInfo, _ = fileManager.GetFileInfo(newCtx(), "c.part")
+	if fileInfo.Size != 5 {
+		t.Errorf("Closed .part file changed by second migration")
+	}
 }
 
 func newManager(t *testing.T) *LocalFileStore {
 	fileManager, err := NewLocalFileStore(LocalFileStoreConfig{
 		Path: PathTest,
-	}, zaptest.NewLogger(t))
+	}, nil, zaptest.NewLogger(t))
 	if err != nil {
 		t.Error("Error while running test", err)
 	}
@@ -138,21 +257,25 @@ func newCtx() context.Context {
 }
 
 func prepareUserDir(t *testing.T) {
-	err := os.Mkdir(filepath.Join(PathTest, UsernameTest), os.ModeDir)
-	if err != nil {
-		t.Error("Error while running test", err)
+	for _, dir := range []string{filepath.Join(PathTest, UsernameTest), filepath.Join(PathTest, stagingDir, UsernameTest)} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Error("Error while running test", err)
+		}
 	}
 }
 
 func cleanUserDir(t *testing.T) {
-	err := os.RemoveAll(filepath.Join(PathTest, UsernameTest))
-	if err != nil {
-		t.Error("Error while running test", err)
+	for _, dir := range []string{filepath.Join(PathTest, UsernameTest), filepath.Join(PathTest, stagingDir, UsernameTest)} {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			t.Error("Error while running test", err)
+		}
 	}
 }
 
 func prepareAppendingFile(t *testing.T) (*os.File, int) {
-	return newFile(t, filepath.Join(PathTest, UsernameTest), AppendableSuffixPattern, 100)
+	return newFile(t, filepath.Join(PathTest, stagingDir, UsernameTest), "", 100)
 }
 
 func prepareClosedFile(t *testing.T) (*os.File, int) {
@@ -189,11 +312,3 @@ func newNopCloser(t *testing.T, size int64) io.ReadCloser {
 
 	return ioutil.NopCloser(bytes.NewReader(data))
 }
-
-func baseNoExt(file string) string {
-	return fileNoExt(filepath.Base(file))
-}
-
-func fileNoExt(file string) string {
-	return strings.TrimSuffix(file, filepath.Ext(file))
-}
@@ -0,0 +1,258 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryFileStore keeps files in memory. It is meant for tests and for
+// trying the server out, everything is lost on restart.
+type MemoryFileStore struct {
+	config  MemoryFileStoreConfig
+	mu      sync.Mutex
+	closed  map[string]*memoryFile
+	uploads map[string]*memoryFile
+	events  *EventBus
+	logger  *zap.Logger
+}
+
+type MemoryFileStoreConfig struct {
+	Collision CollisionPolicy
+}
+
+type memoryFile struct {
+	data    []byte
+	updated time.Time
+}
+
+func NewMemoryFileStore(config MemoryFileStoreConfig, events *EventBus, logger *zap.Logger) *MemoryFileStore {
+	return &MemoryFileStore{
+		config:  config,
+		closed:  map[string]*memoryFile{},
+		uploads: map[string]*memoryFile{},
+		events:  events,
+		logger:  logger,
+	}
+}
+
+func (m *MemoryFileStore) GetFileInfo(ctx context.Context, file string) (*FileInfo, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := &FileInfo{}
+
+	if f := m.current(memoryKey(user.Owner(), file)); f != nil {
+		info.Size = int64(len(f.data))
+	}
+
+	return info, nil
+}
+
+func (m *MemoryFileStore) AppendFile(ctx context.Context, file string, data io.ReadCloser) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return ErrNoUserCtx
+	}
+
+	// read outside of the lock so slow clients don't block each other
+	var buf bytes.Buffer
+
+	_, err := buf.ReadFrom(data)
+	if err != nil {
+		m.logger.Error("Error reading data", zap.Error(err), zap.String("file", file))
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey(user.Owner(), file)
+
+	if _, closed := m.closed[key]; closed && m.config.Collision != CollisionVersion {
+		return ErrConflict
+	}
+
+	f, exists := m.uploads[key]
+
+	if !exists {
+		f = &memoryFile{}
+		m.uploads[key] = f
+	}
+
+	f.data = append(f.data, buf.Bytes()...)
+	f.updated = time.Now()
+
+	if !exists {
+		m.events.Publish(Event{Type: EventUploadStarted, Username: user.Username, Project: user.Project, File: file})
+	}
+
+	return nil
+}
+
+func (m *MemoryFileStore) CloseFile(ctx context.Context, file string) (string, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return "", ErrNoUserCtx
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, exists := m.uploads[memoryKey(user.Owner(), file)]
+	if !exists {
+		if m.config.Collision == CollisionVersion {
+			// retried close refers to the version closed last
+			return lastVersionName(m.list(user.Owner()), file), nil
+		}
+
+		if _, closed := m.closed[memoryKey(user.Owner(), file)]; closed {
+			return file, nil
+		}
+
+		return "", nil
+	}
+
+	target := file
+
+	if m.config.Collision == CollisionVersion {
+		var err error
+
+		target, err = nextVersionName(file, func(name string) (bool, error) {
+			_, taken := m.closed[memoryKey(user.Owner(), name)]
+			return taken, nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	delete(m.uploads, memoryKey(user.Owner(), file))
+	m.closed[memoryKey(user.Owner(), target)] = f
+
+	m.events.Publish(Event{Type: EventFileClosed, Username: user.Username, Project: user.Project, File: target})
+
+	return target, nil
+}
+
+func (m *MemoryFileStore) DeleteFile(ctx context.Context, file string) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return ErrNoUserCtx
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey(user.Owner(), file)
+
+	if m.uploads[key] == nil {
+		return nil
+	}
+
+	delete(m.uploads, key)
+
+	m.events.Publish(Event{Type: EventFileDeleted, Username: user.Username, Project: user.Project, File: file})
+
+	return nil
+}
+
+func (m *MemoryFileStore) RemoveClosedFile(ctx context.Context, file string) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return ErrNoUserCtx
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memoryKey(user.Owner(), file)
+
+	if m.closed[key] == nil {
+		return ErrNotFound
+	}
+
+	delete(m.closed, key)
+
+	m.events.Publish(Event{Type: EventFileDeleted, Username: user.Username, Project: user.Project, File: file})
+
+	return nil
+}
+
+func (m *MemoryFileStore) OpenFile(ctx context.Context, file string) (io.ReadCloser, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, exists := m.closed[memoryKey(user.Owner(), file)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (m *MemoryFileStore) ListFiles(ctx context.Context) ([]FileInfo, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.list(user.Owner()), nil
+}
+
+// list returns files of the owner, the caller holds the lock.
+func (m *MemoryFileStore) list(owner string) []FileInfo {
+	prefix := memoryKey(owner, "")
+
+	var files []FileInfo
+
+	for closed, set := range map[bool]map[string]*memoryFile{true: m.closed, false: m.uploads} {
+		for key, f := range set {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+
+			files = append(files, FileInfo{
+				Name:    strings.TrimPrefix(key, prefix),
+				Size:    int64(len(f.data)),
+				Closed:  closed,
+				Updated: f.updated,
+			})
+		}
+	}
+
+	sortFileInfos(files)
+
+	return files
+}
+
+// current returns the file HEAD and PUT requests refer to.
+func (m *MemoryFileStore) current(key string) *memoryFile {
+	if f, ok := m.closed[key]; ok && m.config.Collision != CollisionVersion {
+		return f
+	}
+
+	return m.uploads[key]
+}
+
+func memoryKey(username, file string) string {
+	return username + "/" + file
+}
@@ -0,0 +1,93 @@
+package application
+
+// passphraseWordList are short common words GeneratePassphrase picks from,
+// unique so every word adds the same entropy.
+const passphraseWordList = `
+able acid acorn acre actor adapt admit adobe adult agent agile aglow agree ahead aisle alarm album
+alert algae alibi alien align alike alive alley allow alloy aloft alpha amber amble amend ample
+amuse angel anger angle ankle annex anvil apple apron arbor arena argue armor aroma array arrow
+aspen asset atlas atom attic audio audit avoid awake award axis bacon badge bagel baker balmy bamboo
+banjo barge baron basil basin batch beach beacon beard beast bench berry bingo birch bison blade
+blank blast blaze blend bliss block bloom blues blunt blush board boast bonus boost booth bound bowl
+brain brand brass brave bread brick bride brief brine brisk broad brook broom brush bucket buddy
+budget buggy bugle build bulb bunch bunny cabin cable cacao cactus camel cameo canal candy canoe
+canon canvas canyon cargo carol carpet carrot carve cedar cello chalk charm chart chase cheek cheer
+chess chest chief child chili chimp chirp choir chord cider cinema circle civic claim clamp clash
+clasp class clerk click cliff climb cloak clock cloth cloud clove clown coach coast cobalt cocoa
+comet comic coral cotton couch count court cover crane crate crater crawl crayon cream creek crest
+crisp crown crumb crust cubic cupid curly curve cycle dairy daisy dance dapper dash dawn decal decoy
+delta denim depot depth desert desk detox dial diary diesel digit diner dingo disco ditch diver dock
+dodge dolphin domain donor donut dove draft dragon drama drawer dream dress drift drill drink drive
+drum dune dusk duty eager eagle early earth easel echo edge eject elbow elder elect elite elm ember
+emery empty enjoy entry envoy epic equal erupt essay ethic event exact exile exist extra fable facet
+fairy faith falcon fancy fang farm favor feast fence ferry fever fiber field fifty final finch fiord
+first fjord flag flame flash fleet flint float flock flora flour fluid flute focus foggy forest
+forge fort forum fossil found frame fresh frost fruit fudge gable galaxy gallon gamma garden garlic
+gauge gecko gem genie giant ginger glade glass glide globe glove glow goat golden goose gorge grace
+grain grand grape graph grass gravel great green grill grin grove guard guava guest guide guild
+guitar gulf gusto habit hammer hamster handy harbor hardy harp haste hatch haven hawk hazel heart
+hedge helmet herb heron hiker hill hinge hippo hobby holly honey hoop horizon horn hotel hound house
+humid humor husky hybrid icicle icon idea igloo image inch index indigo inlet input iris iron island
+ivory jacket jaguar jasper jelly jewel jiffy jigsaw jockey jolly journal judge juice jumbo jungle
+juniper kayak kettle khaki kiosk kitten kiwi knack knee knight koala label ladder ladle lagoon lake
+lamp lance laser latch lava lawn layer leaf ledge lemon lens level lever liberty lilac lily limber
+linen lion liquid lobby lobster local locket lodge logic lotus lunar lyric macaw magnet mango manor
+maple marble march marina market marsh mason meadow medal melody melon mentor merit metal meteor
+method micro mild mimic mint mirror mist mixer mocha model modem molar monk moose morning mosaic
+moss motel motor mound mural museum music nacho nail napkin navy nectar needle nest nickel noble
+noodle north notch novel nudge nugget oasis oats ocean octave olive omega onion onset opal opera
+orbit orchid organ otter outer oval oxide oyster paddle pagoda palm panda panel panther paper parade
+parcel parka parrot pasta pastel patch pearl pebble pecan pedal pelican penny pepper perch petal
+piano pickle pilot pine pixel pizza plaid planet plank plaza plenty plum plush polar pony poppy
+porch potato pouch powder prairie prism prize proud pulse pumpkin puppy purple puzzle quail quartz
+quest quick quiet quill quilt quota rabbit racoon radar radio radish raft rain raisin ranch range
+rapid raven razor ready recipe reef relay relic remedy rhino rhythm ribbon rice ridge rifle ripple
+river roast robin robot rocket rodeo roof rose rover royal ruby rugby ruler rumble rustic saddle
+safari saga sail salad salmon salsa salt sample sandal satin sauce savvy scale scarf scene scone
+scout sedan seed senior sequel shadow shark shell shelf shield shine shore shrub sierra signal silk
+silver siren sketch skiff skill skunk slate sled slope smile smoke snack snail solar sonar sonic
+spade spark spice spiral spoon sport spring sprout squid stable stage stamp star steam steel stem
+stereo stone stool storm story stove straw stream sugar suite summit sunny surf swamp swan sweater
+swift syrup table tablet taco talent tango tapir target teapot temple tempo tender tennis thorn
+thumb ticket tiger timber toast token tomato topaz torch total tower track trail train trend tribe
+trophy trout truck tulip tuna tundra turbo turtle tuxedo twig ultra umbrella uncle union unity urban
+usher valley vapor velvet venue verse vessel video villa violet violin viper visor vista vital vivid
+vocal voice volcano voyage waffle wagon walnut walrus wander water wave wealth weaver wheat wheel
+whisk willow window winter wizard wolf wombat wonder woods world wreath yacht yarn yeast yodel
+yogurt young zebra zenith zephyr zero zinc zipper zone zoom acrobat admiral almond anchor antler
+apricot archer armada artist aster aurora avenue avocado badger ballad balloon banner barley barrel
+basket beagle beaver beetle bellow biscuit blanket blossom bobcat bonfire bouquet bracelet breeze
+bridge brownie buffalo bugler bumper bundle butter button buzzard cadet caliper camper candle
+captain caramel cardinal carnival cashew castle caterer cattle cavern celery cellar cement cereal
+chapel cheetah cherry chestnut chimney chorus cinder citrus clarinet clover cobbler coconut coffee
+collar compass condor cookie copper corner cottage cougar country coyote cradle cricket croquet
+crystal cupcake curtain cushion custard dagger damsel dancer dazzle debut decade deputy dessert
+diamond dinner doctor dollar domino donkey doorway dragonfly drizzle dumpling dynamo easter eclipse
+eggnog elastic elephant elevator emerald emperor engine enigma envelope episode eraser escort
+evening falafel fedora fennel ferret festival fiddle figure filter firefly fishbowl flamingo flannel
+flicker florist flower fluffy folder fondue football forecast fountain fox freckle freezer fridge
+frisbee frozen funnel furnace gadget gallery gambit garage gardener gazebo gazelle geyser ghost
+giraffe glacier glider goblin gondola gopher gorilla gospel gourmet granite gravy griffin grocer
+guitarist gumbo gutter hallway halo hamlet handle harvest hazelnut helium hermit hickory highway
+hilltop hockey homage hopper hornet hummus hunter hurdle iceberg impala inkwell insect isotope
+jackal jamboree jasmine javelin jellybean jetty jogger joyful jukebox junction kangaroo karate
+kernel keyboard kingdom kitchen knapsack lantern lapel lasagna lattice laundry lavender leather
+legend lentil leopard lettuce library lighthouse limerick lizard llama lobbyist locker locust
+lullaby lumber luster magpie mailbox mammoth mandolin mantis marathon marigold marmot mascot
+meadowlark meerkat mercury mermaid midnight migrant mileage minnow miracle mitten mobile mohair
+monarch monitor monsoon mortar mosquito muffin mulberry mustang mustard narwhal nebula neutron
+nightcap nomad nutmeg oatmeal octopus odyssey omelet orange orchard ostrich outpost paddock painter
+pajamas pancake papaya paprika parsley partner passport pastry peacock peanut pelt penguin
+peppermint pharaoh pheasant pianist picnic pigeon pillow pinecone pioneer pirate pistachio planter
+platinum pocket poet polka popcorn porcupine postcard potter prawn pretzel printer propeller pudding
+puffin pyramid quarry quasar quiche rainbow rampart raptor raspberry reactor recital reindeer
+reptile riddle rooster rosebud saffron sailor sandbox sapphire sardine satellite saxophone scallop
+scarecrow scholar scooter scorpion seagull seahorse seashell sentinel sesame shamrock sherbet
+shuttle sidewalk skillet skylark skyline sleigh slipper snowball snowflake soldier sonnet souffle
+sparrow spinach sponge squash squirrel stallion starfish stencil sticker stirrup strudel sunbeam
+sunflower sunrise sunset swimmer tadpole tangerine tapestry teacup telescope terrace thimble thistle
+thunder tinsel toaster toffee tornado tortoise toucan tractor trapeze treasure trellis trident
+trombone trumpet tugboat turnip twilight typhoon ukulele unicorn utensil vanilla vaquero veranda
+vinegar voyager walkway warbler wasabi watchman waterfall wetland whistle widget wildcat windmill
+wishbone woodland wrangler yearling zeppelin zucchini
+`
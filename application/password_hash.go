@@ -0,0 +1,197 @@
+package application
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Password hashing algorithms.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// Defaults of argon2id follow OWASP recommendation, every Basic auth request
+// verifies password so they are kept moderate.
+const (
+	DefaultArgon2Memory      = 19 * 1024
+	DefaultArgon2Iterations  = 2
+	DefaultArgon2Parallelism = 1
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var ErrPasswordHashNotValid = errors.New("password hash not valid")
+
+// PasswordHashConfig selects algorithm for new hashes, existing hashes are
+// verified by the algorithm and parameters stored with them.
+type PasswordHashConfig struct {
+	// Algorithm is HashBcrypt or HashArgon2id, defaults to HashBcrypt.
+	Algorithm string
+	// Cost of bcrypt, defaults to bcrypt.DefaultCost.
+	Cost int
+	// Memory of argon2id in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func DefaultPasswordHashConfig() PasswordHashConfig {
+	return PasswordHashConfig{
+		Algorithm:   HashBcrypt,
+		Cost:        bcrypt.DefaultCost,
+		Memory:      DefaultArgon2Memory,
+		Iterations:  DefaultArgon2Iterations,
+		Parallelism: DefaultArgon2Parallelism,
+	}
+}
+
+// PasswordHasher makes hashes which identify their algorithm and parameters,
+// ie. "$2a$10$..." for bcrypt or "$argon2id$v=19$m=19456,t=2,p=1$..." for
+// argon2id.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Outdated reports whether hash was made by other algorithm or with other
+	// parameters than the hasher uses.
+	Outdated(hash string) bool
+}
+
+func NewPasswordHasher(cfg PasswordHashConfig) (PasswordHasher, error) {
+	switch cfg.Algorithm {
+	case "", HashBcrypt:
+		if cfg.Cost < bcrypt.MinCost || cfg.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+
+		return &bcryptHasher{cost: cfg.Cost}, nil
+	case HashArgon2id:
+		if cfg.Memory < 8*uint32(cfg.Parallelism) || cfg.Iterations < 1 || cfg.Parallelism < 1 {
+			return nil, errors.New("argon2id needs positive iterations and parallelism, and memory of 8 KiB per thread")
+		}
+
+		return &argon2idHasher{
+			params: argon2Params{memory: cfg.Memory, iterations: cfg.Iterations, parallelism: cfg.Parallelism},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown password hash algorithm %q, use %s or %s", cfg.Algorithm, HashBcrypt, HashArgon2id)
+}
+
+// VerifyPasswordHash reports whether password matches hash of any supported
+// algorithm. Error means the hash itself is not valid.
+func VerifyPasswordHash(hash, password string) (bool, error) {
+	if strings.HasPrefix(hash, "$"+HashArgon2id+"$") {
+		return verifyArgon2id(hash, password)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+type argon2idHasher struct {
+	params argon2Params
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", HashArgon2id, argon2.Version,
+		p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Outdated(hash string) bool {
+	params, _, _, err := parseArgon2id(hash)
+	return err != nil || params != h.params
+}
+
+func verifyArgon2id(hash, password string) (bool, error) {
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// parseArgon2id parses "$argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>".
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	var version int
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return p, nil, nil, ErrPasswordHashNotValid
+	}
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return p, nil, nil, ErrPasswordHashNotValid
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism)
+	if err != nil || p.iterations < 1 || p.parallelism < 1 {
+		return p, nil, nil, ErrPasswordHashNotValid
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrPasswordHashNotValid
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrPasswordHashNotValid
+	}
+
+	return p, salt, key, nil
+}
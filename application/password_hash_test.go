@@ -0,0 +1,97 @@
+package application
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	cfg := DefaultPasswordHashConfig()
+	cfg.Cost = 4
+	cfg.Memory, cfg.Iterations = 64, 1
+
+	for _, algorithm := range []string{HashBcrypt, HashArgon2id} {
+		cfg.Algorithm = algorithm
+
+		hasher, err := NewPasswordHasher(cfg)
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		hash, err := hasher.Hash("plum-harbor-lantern")
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		if ok, err := VerifyPasswordHash(hash, "plum-harbor-lantern"); !ok || err != nil {
+			t.Errorf("%s: expected password verified, got %v", algorithm, err)
+		}
+
+		if ok, err := VerifyPasswordHash(hash, "wrong-password"); ok || err != nil {
+			t.Errorf("%s: expected wrong password rejected without error, got %v", algorithm, err)
+		}
+
+		if hasher.Outdated(hash) {
+			t.Errorf("%s: fresh hash %q outdated", algorithm, hash)
+		}
+	}
+
+	argon2, _ := NewPasswordHasher(cfg)
+	hash, _ := argon2.Hash("plum-harbor-lantern")
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("Unexpected argon2id hash %q", hash)
+	}
+
+	cfg.Iterations = 2
+	if stronger, _ := NewPasswordHasher(cfg); !stronger.Outdated(hash) {
+		t.Error("Expected hash with other parameters outdated")
+	}
+
+	if bcrypt, _ := NewPasswordHasher(DefaultPasswordHashConfig()); !bcrypt.Outdated(hash) {
+		t.Error("Expected hash of other algorithm outdated")
+	}
+
+	if _, err := VerifyPasswordHash("$argon2id$v=19$m=64,t=1,p=1$bad", "x"); err != ErrPasswordHashNotValid {
+		t.Errorf("Expected ErrPasswordHashNotValid, got %v", err)
+	}
+
+	for _, invalid := range []PasswordHashConfig{{Algorithm: "md5"}, {Algorithm: HashBcrypt, Cost: 99}, {Algorithm: HashArgon2id}} {
+		if _, err := NewPasswordHasher(invalid); err == nil {
+			t.Errorf("Expected %+v not valid", invalid)
+		}
+	}
+}
+
+func TestPasswordHashUpgradedOnLogin(t *testing.T) {
+	am := newTestAuthManager(t)
+
+	hasher, err := NewPasswordHasher(PasswordHashConfig{
+		Algorithm: HashArgon2id, Memory: 64, Iterations: 1, Parallelism: 1,
+	})
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	am.SetPasswordHasher(hasher)
+
+	if ok, err := am.CheckPassword("alice", "wrong-password"); ok || err != nil {
+		t.Error("Expected wrong password rejected, got", err)
+	}
+
+	if alice, _ := am.GetUserAuth("alice"); !strings.HasPrefix(alice.PasswordHash, "$2") {
+		t.Errorf("Expected hash kept on wrong password, got %q", alice.PasswordHash)
+	}
+
+	if ok, err := am.CheckPassword("alice", testPassword); !ok || err != nil {
+		t.Error("Expected bcrypt password accepted, got", err)
+	}
+
+	if alice, _ := am.GetUserAuth("alice"); !strings.HasPrefix(alice.PasswordHash, "$argon2id$") {
+		t.Errorf("Expected hash upgraded to argon2id, got %q", alice.PasswordHash)
+	}
+
+	if ok, err := am.CheckPassword("alice", testPassword); !ok || err != nil {
+		t.Error("Error while running test", err)
+	}
+}
@@ -0,0 +1,146 @@
+package application
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultPasswordMinLength fits a short passphrase, but not a single word.
+const DefaultPasswordMinLength = 10
+
+// passphraseEntropy is the minimal strength of generated passphrases, in bits.
+const passphraseEntropy = 72
+
+// PasswordPolicy is checked whenever password is set, existing passwords keep
+// working after the policy changes.
+type PasswordPolicy struct {
+	// MinLength in characters, empty passwords are always rejected.
+	MinLength int
+	// RejectCommon rejects passwords of the bundled list and Common.
+	RejectCommon bool
+	// Common are additional lowercase passwords rejected with the bundled
+	// ones, see LoadCommonPasswords.
+	Common map[string]bool
+}
+
+// PasswordPolicyError tells why password was rejected.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password not accepted: " + e.Reason
+}
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     map[string]bool
+)
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:    DefaultPasswordMinLength,
+		RejectCommon: true,
+	}
+}
+
+// Check returns *PasswordPolicyError if password of user is not accepted.
+func (p PasswordPolicy) Check(username, password string) error {
+	if password == "" {
+		return &PasswordPolicyError{Reason: "password is empty"}
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PasswordPolicyError{Reason: fmt.Sprintf("use at least %d characters", p.MinLength)}
+	}
+
+	lower := strings.ToLower(password)
+
+	if lower == strings.ToLower(username) {
+		return &PasswordPolicyError{Reason: "password equals username"}
+	}
+
+	if p.RejectCommon && (p.isCommon(lower) || p.isCommon(commonBase(lower))) {
+		return &PasswordPolicyError{Reason: "password is too common"}
+	}
+
+	return nil
+}
+
+func (p PasswordPolicy) isCommon(lower string) bool {
+	return lower != "" && (isCommonPassword(lower) || p.Common[lower])
+}
+
+// commonBase strips digits and symbols around a password, so common ones
+// padded to the minimal length, ie. "Password2020!", are rejected too.
+func commonBase(lower string) string {
+	return strings.TrimFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+func isCommonPassword(lower string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = map[string]bool{}
+
+		for _, password := range strings.Fields(commonPasswordList) {
+			commonPasswords[password] = true
+		}
+	})
+
+	return commonPasswords[lower]
+}
+
+// LoadCommonPasswords reads file with one password per line, like published
+// lists of leaked passwords.
+func LoadCommonPasswords(file string) (map[string]bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	passwords := map[string]bool{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			passwords[strings.ToLower(password)] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	return passwords, nil
+}
+
+// GeneratePassphrase returns random words joined by dashes, with at least
+// passphraseEntropy bits of entropy.
+func GeneratePassphrase() (string, error) {
+	words := strings.Fields(passphraseWordList)
+	count := int(math.Ceil(passphraseEntropy / math.Log2(float64(len(words)))))
+
+	picked := make([]string, count)
+
+	for i := range picked {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+		if err != nil {
+			return "", err
+		}
+
+		picked[i] = words[n.Int64()]
+	}
+
+	return strings.Join(picked, "-"), nil
+}
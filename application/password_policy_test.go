@@ -0,0 +1,67 @@
+package application
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+
+	for _, password := range []string{"", "short", "Alice-Reporter", "QWERTYUIOP", "password123",
+		"Password2020!", "2020sunshine", "1234567890"} {
+		if _, ok := policy.Check("alice-reporter", password).(*PasswordPolicyError); !ok {
+			t.Errorf("Expected %q rejected", password)
+		}
+	}
+
+	for _, password := range []string{"plum-harbor-lantern", "sunshine-harbor-7", "0123498765"} {
+		if err := policy.Check("alice", password); err != nil {
+			t.Error("Error while running test", err)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "direct-upload-policy")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "common.txt")
+	if err := ioutil.WriteFile(file, []byte("Plum-Harbor-Lantern\n\n"), 0600); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	policy.Common, err = LoadCommonPasswords(file)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := policy.Check("alice", "plum-harbor-lantern"); err == nil {
+		t.Error("Expected password from common file rejected")
+	}
+
+	policy.RejectCommon = false
+	if err := policy.Check("alice", "plum-harbor-lantern"); err != nil {
+		t.Error("Error while running test", err)
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	first, err := GeneratePassphrase()
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	second, _ := GeneratePassphrase()
+	if first == second {
+		t.Errorf("Expected different passphrases, got %q twice", first)
+	}
+
+	if err := DefaultPasswordPolicy().Check("alice", first); err != nil {
+		t.Errorf("Generated %q rejected: %v", first, err)
+	}
+}
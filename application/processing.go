@@ -0,0 +1,425 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+type ProcessingState string
+
+const (
+	ProcessingPending ProcessingState = "pending"
+	ProcessingRunning ProcessingState = "running"
+	ProcessingDone    ProcessingState = "done"
+	ProcessingFailed  ProcessingState = "failed"
+	ProcessingSkipped ProcessingState = "skipped"
+)
+
+// ErrSkipRemaining is returned by processors that handled the file and
+// don't want any further steps to run on it, like when it was quarantined.
+var ErrSkipRemaining = errors.New("skip remaining processing steps")
+
+// ErrProcessingQueueFull fails processing of files closed while all workers
+// are busy and the queue is full.
+var ErrProcessingQueueFull = errors.New("processing queue full")
+
+// ProcessingJob describes a closed file handed to processors. Path points to
+// the file on the local disk, either in the file store or to a temporary copy.
+type ProcessingJob struct {
+	Username string
+	File     string
+	Path     string
+	Size     int64
+	Digest   string
+}
+
+// Processor is a single step of the post-close pipeline. Output is stored in
+// the processing status of the file.
+type Processor interface {
+	Name() string
+	Process(ctx context.Context, job *ProcessingJob) (output string, err error)
+}
+
+type ProcessingStep struct {
+	Name     string
+	State    ProcessingState
+	Attempts int
+	Output   string
+	Error    string
+}
+
+type ProcessingStatus struct {
+	Username string
+	File     string
+	Digest   string
+	State    ProcessingState
+	Steps    []ProcessingStep
+	// Error tells why processing failed outside of the steps.
+	Error   string
+	Updated time.Time
+}
+
+type ProcessingRepository interface {
+	Save(status *ProcessingStatus) error
+	Read(username, file string) (*ProcessingStatus, error)
+	List() <-chan ProcessingStatus
+}
+
+type ProcessingConfig struct {
+	Workers    int
+	Retries    int
+	RetryDelay time.Duration
+	QueueSize  int
+}
+
+// localPather is implemented by file stores keeping closed files on the
+// local disk, so processors can use them without making a copy.
+type localPather interface {
+	LocalPath(ctx context.Context, file string) (string, error)
+}
+
+type processingTask struct {
+	username string
+	file     string
+}
+
+// ProcessingPipeline runs processors on every closed file using a bounded
+// pool of workers. Status is persisted, so files still waiting when the
+// server stops are processed after restart.
+type ProcessingPipeline struct {
+	config     ProcessingConfig
+	mu         sync.RWMutex
+	processors []Processor
+	store      FileStore
+	repo       ProcessingRepository
+	queue      chan processingTask
+	logger     *zap.Logger
+}
+
+func NewProcessingPipeline(config ProcessingConfig, processors []Processor, store FileStore,
+	repo ProcessingRepository, logger *zap.Logger) *ProcessingPipeline {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+
+	if config.Retries < 0 {
+		config.Retries = 0
+	}
+
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 5 * time.Second
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+
+	return &ProcessingPipeline{
+		config:     config,
+		processors: processors,
+		store:      store,
+		repo:       repo,
+		queue:      make(chan processingTask, config.QueueSize),
+		logger:     logger,
+	}
+}
+
+// SetRetryPolicy changes retries of failing steps, including steps already
+// being retried.
+func (p *ProcessingPipeline) SetRetryPolicy(retries int, retryDelay time.Duration) {
+	if retries < 0 {
+		retries = 0
+	}
+
+	if retryDelay <= 0 {
+		retryDelay = 5 * time.Second
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.config.Retries = retries
+	p.config.RetryDelay = retryDelay
+}
+
+func (p *ProcessingPipeline) retryPolicy() (int, time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.config.Retries, p.config.RetryDelay
+}
+
+func (p *ProcessingPipeline) Handle(e Event) {
+	if e.Type != EventFileClosed || len(p.processors) == 0 {
+		return
+	}
+
+	// files in project folders are processed as owned by the project
+	status := p.newStatus(e.Owner(), e.File)
+
+	err := p.repo.Save(status)
+	if err != nil {
+		p.logger.Error("Error saving processing status",
+			zap.String("username", e.Owner()), zap.String("file", e.File), zap.Error(err))
+	}
+
+	// bounded queue pushes back, the file is failed rather than piling up
+	// goroutines waiting for workers
+	select {
+	case p.queue <- processingTask{username: e.Owner(), file: e.File}:
+	default:
+		p.logger.Error("Error queueing file for processing",
+			zap.String("username", e.Owner()), zap.String("file", e.File), zap.Error(ErrProcessingQueueFull))
+		status.State = ProcessingFailed
+		status.Error = ErrProcessingQueueFull.Error()
+		p.save(status)
+	}
+}
+
+// Start starts workers and queues files left unprocessed by previous run.
+func (p *ProcessingPipeline) Start() {
+	for i := 0; i < p.config.Workers; i++ {
+		go p.work()
+	}
+
+	for status := range p.repo.List() {
+		if status.State == ProcessingPending || status.State == ProcessingRunning {
+			p.enqueue(processingTask{username: status.Username, file: status.File})
+		}
+	}
+}
+
+func (p *ProcessingPipeline) Status(username, file string) (*ProcessingStatus, error) {
+	status, err := p.repo.Read(username, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == nil {
+		return nil, ErrNotFound
+	}
+
+	return status, nil
+}
+
+func (p *ProcessingPipeline) List(state ProcessingState) ([]ProcessingStatus, error) {
+	var statuses []ProcessingStatus
+
+	for status := range p.repo.List() {
+		if state == "" || status.State == state {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+func (p *ProcessingPipeline) enqueue(task processingTask) {
+	p.queue <- task
+}
+
+func (p *ProcessingPipeline) work() {
+	for task := range p.queue {
+		p.process(task)
+	}
+}
+
+func (p *ProcessingPipeline) process(task processingTask) {
+	logger := p.logger.With(zap.String("username", task.username), zap.String("file", task.file))
+
+	status, err := p.repo.Read(task.username, task.file)
+	if err != nil {
+		logger.Error("Error reading processing status", zap.Error(err))
+		return
+	}
+
+	if status == nil || !status.matches(p.processors) {
+		status = p.newStatus(task.username, task.file)
+	}
+
+	ctx := NewContext(context.Background(), &User{Username: task.username})
+
+	job, cleanup, err := p.prepare(ctx, task)
+	if err != nil {
+		logger.Error("Error preparing file for processing", zap.Error(err))
+		status.State = ProcessingFailed
+		status.Error = err.Error()
+		p.save(status)
+		return
+	}
+	defer cleanup()
+
+	status.Digest = job.Digest
+	status.State = ProcessingRunning
+	status.Error = ""
+	p.save(status)
+
+	for i, processor := range p.processors {
+		step := &status.Steps[i]
+
+		if step.State == ProcessingDone {
+			continue
+		}
+
+		skip := p.runStep(ctx, processor, job, step, logger)
+		p.save(status)
+
+		if step.State == ProcessingFailed {
+			status.State = ProcessingFailed
+			p.save(status)
+			return
+		}
+
+		if skip {
+			for j := i + 1; j < len(status.Steps); j++ {
+				status.Steps[j].State = ProcessingSkipped
+			}
+
+			break
+		}
+	}
+
+	status.State = ProcessingDone
+	p.save(status)
+
+	logger.Info("File processed")
+}
+
+// runStep runs processor until it succeeds or runs out of retries, reporting
+// whether the remaining steps should be skipped.
+func (p *ProcessingPipeline) runStep(ctx context.Context, processor Processor, job *ProcessingJob,
+	step *ProcessingStep, logger *zap.Logger) bool {
+	for {
+		step.Attempts++
+
+		output, err := processor.Process(ctx, job)
+		step.Output = output
+
+		if err == nil || err == ErrSkipRemaining {
+			step.State = ProcessingDone
+			step.Error = ""
+			return err == ErrSkipRemaining
+		}
+
+		step.Error = err.Error()
+
+		logger.Warn("Processing step failed",
+			zap.String("step", step.Name), zap.Int("attempts", step.Attempts), zap.Error(err))
+
+		retries, retryDelay := p.retryPolicy()
+
+		if step.Attempts > retries {
+			step.State = ProcessingFailed
+			return false
+		}
+
+		time.Sleep(retryDelay * time.Duration(step.Attempts))
+	}
+}
+
+// prepare computes the file digest and makes sure the file is available on
+// the local disk.
+func (p *ProcessingPipeline) prepare(ctx context.Context, task processingTask) (*ProcessingJob, func(), error) {
+	job := &ProcessingJob{
+		Username: task.username,
+		File:     task.file,
+	}
+
+	cleanup := func() {}
+
+	r, err := p.store.OpenFile(ctx, task.file)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer r.Close()
+
+	hash := sha256.New()
+	var w io.Writer = hash
+
+	if local, ok := p.store.(localPather); ok {
+		job.Path, err = local.LocalPath(ctx, task.file)
+		if err != nil && err != ErrStoredCompressed {
+			return nil, cleanup, err
+		}
+	}
+
+	// processors get uncompressed copy of files not readable in place
+	if job.Path == "" {
+		tmp, err := ioutil.TempFile("", "direct-upload-")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		//noinspection GoUnhandledErrorResult
+		defer tmp.Close()
+
+		job.Path = tmp.Name()
+		cleanup = func() {
+			_ = os.Remove(job.Path)
+		}
+
+		w = io.MultiWriter(hash, tmp)
+	}
+
+	job.Size, err = io.Copy(w, r)
+	if err != nil {
+		cleanup()
+		return nil, func() {}, err
+	}
+
+	job.Digest = hex.EncodeToString(hash.Sum(nil))
+
+	return job, cleanup, nil
+}
+
+func (p *ProcessingPipeline) newStatus(username, file string) *ProcessingStatus {
+	status := &ProcessingStatus{
+		Username: username,
+		File:     file,
+		State:    ProcessingPending,
+		Updated:  time.Now(),
+	}
+
+	for _, processor := range p.processors {
+		status.Steps = append(status.Steps, ProcessingStep{
+			Name:  processor.Name(),
+			State: ProcessingPending,
+		})
+	}
+
+	return status
+}
+
+func (p *ProcessingPipeline) save(status *ProcessingStatus) {
+	status.Updated = time.Now()
+
+	err := p.repo.Save(status)
+	if err != nil {
+		p.logger.Error("Error saving processing status",
+			zap.String("username", status.Username), zap.String("file", status.File), zap.Error(err))
+	}
+}
+
+// matches reports whether status steps were created for the processors,
+// they differ when the pipeline config changes between restarts.
+func (s *ProcessingStatus) matches(processors []Processor) bool {
+	if len(s.Steps) != len(processors) {
+		return false
+	}
+
+	for i, processor := range processors {
+		if s.Steps[i].Name != processor.Name() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,163 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap/zaptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memProcessingRepo struct {
+	mu       sync.Mutex
+	statuses map[string]ProcessingStatus
+}
+
+func (r *memProcessingRepo) Save(s *ProcessingStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s.Steps = append([]ProcessingStep(nil), s.Steps...)
+	r.statuses[s.Username+"/"+s.File] = *s
+	return nil
+}
+
+func (r *memProcessingRepo) Read(username, file string) (*ProcessingStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.statuses[username+"/"+file]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (r *memProcessingRepo) List() <-chan ProcessingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(chan ProcessingStatus, len(r.statuses))
+	for _, s := range r.statuses {
+		out <- s
+	}
+	close(out)
+	return out
+}
+
+type flakyProcessor struct {
+	failures int
+	calls    int
+}
+
+func (p *flakyProcessor) Name() string {
+	return "flaky"
+}
+
+func (p *flakyProcessor) Process(_ context.Context, _ *ProcessingJob) (string, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return "", errors.New("temporary failure")
+	}
+	return "ok", nil
+}
+
+func TestProcessingPipeline_Process(t *testing.T) {
+	store := NewMemoryFileStore(MemoryFileStoreConfig{}, nil, zaptest.NewLogger(t))
+	repo := &memProcessingRepo{statuses: map[string]ProcessingStatus{}}
+
+	command, err := NewCommandProcessor("env", []string{"sh", "-c",
+		"test -f \"$DIRECT_UPLOAD_PATH\" && echo {file} $DIRECT_UPLOAD_USERNAME $DIRECT_UPLOAD_SHA256"}, time.Minute)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	flaky := &flakyProcessor{failures: 2}
+
+	pipeline := NewProcessingPipeline(ProcessingConfig{
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+	}, []Processor{flaky, command}, store, repo, zaptest.NewLogger(t))
+
+	err = store.AppendFile(newCtx(), "file", newNopCloser(t, 100))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	_, err = store.CloseFile(newCtx(), "file")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	pipeline.Handle(Event{Type: EventFileClosed, Username: UsernameTest, File: "file"})
+	pipeline.process(<-pipeline.queue)
+
+	status, err := pipeline.Status(UsernameTest, "file")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if status.State != ProcessingDone {
+		t.Errorf("Expected state %s, got %s", ProcessingDone, status.State)
+	}
+
+	if status.Steps[0].Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", status.Steps[0].Attempts)
+	}
+
+	expected := "file " + UsernameTest + " " + status.Digest
+	if len(status.Digest) != 64 || strings.TrimSpace(status.Steps[1].Output) != expected {
+		t.Errorf("Bad command output: expected %q, got %q", expected, status.Steps[1].Output)
+	}
+}
+
+func TestProcessingPipeline_Fail(t *testing.T) {
+	store := NewMemoryFileStore(MemoryFileStoreConfig{}, nil, zaptest.NewLogger(t))
+	repo := &memProcessingRepo{statuses: map[string]ProcessingStatus{}}
+
+	pipeline := NewProcessingPipeline(ProcessingConfig{
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+	}, []Processor{&flakyProcessor{failures: 5}}, store, repo, zaptest.NewLogger(t))
+
+	_ = store.AppendFile(newCtx(), "file", newNopCloser(t, 10))
+	_, _ = store.CloseFile(newCtx(), "file")
+
+	pipeline.Handle(Event{Type: EventFileClosed, Username: UsernameTest, File: "file"})
+	pipeline.process(<-pipeline.queue)
+
+	failed, _ := pipeline.List(ProcessingFailed)
+	if len(failed) != 1 || failed[0].Steps[0].Attempts != 2 {
+		t.Errorf("Expected one failed file after 2 attempts, got %+v", failed)
+	}
+}
+
+func TestProcessingPipeline_QueueFull(t *testing.T) {
+	store := NewMemoryFileStore(MemoryFileStoreConfig{}, nil, zaptest.NewLogger(t))
+	repo := &memProcessingRepo{statuses: map[string]ProcessingStatus{}}
+
+	pipeline := NewProcessingPipeline(ProcessingConfig{QueueSize: 1}, []Processor{&flakyProcessor{}}, store, repo,
+		zaptest.NewLogger(t))
+
+	// no workers are running, so the second file finds the queue full
+	for _, file := range []string{"first", "second"} {
+		_ = store.AppendFile(newCtx(), file, newNopCloser(t, 10))
+		_, _ = store.CloseFile(newCtx(), file)
+
+		pipeline.Handle(Event{Type: EventFileClosed, Username: UsernameTest, File: file})
+	}
+
+	if first, _ := pipeline.Status(UsernameTest, "first"); first.State != ProcessingPending {
+		t.Errorf("Expected queued file pending, got %+v", first)
+	}
+
+	second, _ := pipeline.Status(UsernameTest, "second")
+	if second.State != ProcessingFailed || second.Error != ErrProcessingQueueFull.Error() {
+		t.Errorf("Expected file failed on full queue, got %+v", second)
+	}
+
+	pipeline.process(<-pipeline.queue)
+
+	if first, _ := pipeline.Status(UsernameTest, "first"); first.State != ProcessingDone || first.Error != "" {
+		t.Errorf("Expected queued file processed, got %+v", first)
+	}
+}
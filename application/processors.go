@@ -0,0 +1,184 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxProcessorOutput limits output kept in processing status.
+const maxProcessorOutput = 4096
+
+// CommandProcessor runs an external command for every closed file. Arguments
+// can use {path}, {username}, {file}, {size} and {sha256} placeholders, same
+// values are passed in DIRECT_UPLOAD_* environment variables.
+type CommandProcessor struct {
+	name    string
+	command []string
+	timeout time.Duration
+}
+
+func NewCommandProcessor(name string, command []string, timeout time.Duration) (*CommandProcessor, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("processor %s: empty command", name)
+	}
+
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+
+	return &CommandProcessor{
+		name:    name,
+		command: command,
+		timeout: timeout,
+	}, nil
+}
+
+func (p *CommandProcessor) Name() string {
+	return p.name
+}
+
+func (p *CommandProcessor) Process(ctx context.Context, job *ProcessingJob) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	replacer := strings.NewReplacer(
+		"{path}", job.Path,
+		"{username}", job.Username,
+		"{file}", job.File,
+		"{size}", strconv.FormatInt(job.Size, 10),
+		"{sha256}", job.Digest,
+	)
+
+	args := make([]string, len(p.command))
+	for i, arg := range p.command {
+		args[i] = replacer.Replace(arg)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"DIRECT_UPLOAD_PATH="+job.Path,
+		"DIRECT_UPLOAD_USERNAME="+job.Username,
+		"DIRECT_UPLOAD_FILE="+job.File,
+		"DIRECT_UPLOAD_SIZE="+strconv.FormatInt(job.Size, 10),
+		"DIRECT_UPLOAD_SHA256="+job.Digest,
+	)
+
+	output, err := cmd.CombinedOutput()
+
+	return truncateOutput(string(output)), err
+}
+
+// CopyProcessor copies closed files to archival storage, keeping the
+// <username>/<file> layout and on-disk file names of LocalFileStore.
+type CopyProcessor struct {
+	path string
+}
+
+func NewCopyProcessor(path string) (*CopyProcessor, error) {
+	if path == "" {
+		return nil, fmt.Errorf("processor copy: path not set")
+	}
+
+	return &CopyProcessor{
+		path: path,
+	}, nil
+}
+
+func (p *CopyProcessor) Name() string {
+	return "copy"
+}
+
+func (p *CopyProcessor) Process(_ context.Context, job *ProcessingJob) (string, error) {
+	dir := filepath.Join(p.path, job.Username)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(dir, StorageFileName(job.File))
+
+	err = copyFile(job.Path, target)
+	if err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+// MetadataProcessor records detected content type and size of closed files.
+type MetadataProcessor struct{}
+
+func (p *MetadataProcessor) Name() string {
+	return "metadata"
+}
+
+func (p *MetadataProcessor) Process(_ context.Context, job *ProcessingJob) (string, error) {
+	f, err := os.Open(job.Path)
+	if err != nil {
+		return "", err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	head := make([]byte, 512)
+
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return fmt.Sprintf("content-type=%s size=%d sha256=%s",
+		http.DetectContentType(head[:n]), job.Size, job.Digest), nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer in.Close()
+
+	tmp := to + ".tmp"
+
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, to)
+}
+
+func truncateOutput(output string) string {
+	output = strings.TrimSpace(output)
+
+	if len(output) > maxProcessorOutput {
+		return output[len(output)-maxProcessorOutput:]
+	}
+
+	return output
+}
@@ -0,0 +1,231 @@
+package application
+
+import (
+	"errors"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrProjectNotValid    = errors.New("project name not valid")
+	ErrProjectExists      = errors.New("project already exists")
+	ErrProjectNotFound    = errors.New("project not found")
+	ErrMemberRoleNotValid = errors.New("project role not valid, use uploader or reviewer")
+	ErrNotProjectMember   = errors.New("user is not a project member")
+)
+
+// Project is a folder shared by a team. Members upload into it, members with
+// reviewer role also read everything in it.
+type Project struct {
+	Name    string
+	Created time.Time
+	// Members maps usernames to RoleUploader or RoleReviewer.
+	Members map[string]string
+}
+
+// IsMember reports whether the user uploads to the project.
+func (p *Project) IsMember(username string) bool {
+	_, ok := p.Members[username]
+	return ok
+}
+
+// IsReviewer reports whether the user reads files of the project.
+func (p *Project) IsReviewer(username string) bool {
+	return p.Members[username] == RoleReviewer
+}
+
+// Usernames returns sorted usernames of members.
+func (p *Project) Usernames() []string {
+	var usernames []string
+
+	for username := range p.Members {
+		usernames = append(usernames, username)
+	}
+
+	sort.Strings(usernames)
+
+	return usernames
+}
+
+type ProjectRepository interface {
+	Save(project *Project) error
+	Read(name string) (*Project, error)
+	Delete(name string) error
+	List() <-chan Project
+}
+
+type ProjectManager struct {
+	// mu serializes read-modify-write of projects
+	mu          sync.Mutex
+	repo        ProjectRepository
+	authManager *AuthManager
+	logger      *zap.Logger
+}
+
+func NewProjectManager(repo ProjectRepository, am *AuthManager, logger *zap.Logger) *ProjectManager {
+	return &ProjectManager{
+		repo:        repo,
+		authManager: am,
+		logger:      logger,
+	}
+}
+
+// ValidProjectName accepts the same names as usernames.
+func ValidProjectName(name string) bool {
+	return usernameRegexp.MatchString(name)
+}
+
+func (m *ProjectManager) Create(name string) error {
+	if !ValidProjectName(name) {
+		return ErrProjectNotValid
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, err := m.repo.Read(name)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		return ErrProjectExists
+	}
+
+	m.logger.Info("Project created", zap.String("project", name))
+
+	return m.repo.Save(&Project{
+		Name:    name,
+		Created: time.Now().UTC(),
+		Members: map[string]string{},
+	})
+}
+
+// Delete removes the project and its membership, uploaded files are kept.
+func (m *ProjectManager) Delete(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.read(name); err != nil {
+		return err
+	}
+
+	m.logger.Info("Project deleted", zap.String("project", name))
+
+	return m.repo.Delete(name)
+}
+
+// Get returns the project, nil if it doesn't exist.
+func (m *ProjectManager) Get(name string) (*Project, error) {
+	if !ValidProjectName(name) {
+		return nil, ErrProjectNotValid
+	}
+
+	return m.repo.Read(name)
+}
+
+// List returns projects sorted by name.
+func (m *ProjectManager) List() []Project {
+	var projects []Project
+
+	for project := range m.repo.List() {
+		projects = append(projects, project)
+	}
+
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].Name < projects[j].Name
+	})
+
+	return projects
+}
+
+// AddMember adds existing user to the project, or changes role of a member.
+func (m *ProjectManager) AddMember(name, username, role string) error {
+	if role != RoleUploader && role != RoleReviewer {
+		return ErrMemberRoleNotValid
+	}
+
+	exists, err := m.authManager.HasUsername(username)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrUsernameNotFound
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	project, err := m.read(name)
+	if err != nil {
+		return err
+	}
+
+	project.Members[username] = role
+
+	m.logger.Info("Project member added",
+		zap.String("project", name), zap.String("username", username), zap.String("role", role))
+
+	return m.repo.Save(project)
+}
+
+func (m *ProjectManager) RemoveMember(name, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	project, err := m.read(name)
+	if err != nil {
+		return err
+	}
+
+	if !project.IsMember(username) {
+		return ErrNotProjectMember
+	}
+
+	delete(project.Members, username)
+
+	m.logger.Info("Project member removed", zap.String("project", name), zap.String("username", username))
+
+	return m.repo.Save(project)
+}
+
+// Handle removes deleted users from projects, so a new user with the same
+// name doesn't inherit access.
+func (m *ProjectManager) Handle(e Event) {
+	if e.Type != EventUserDeleted {
+		return
+	}
+
+	for _, project := range m.List() {
+		if !project.IsMember(e.Username) {
+			continue
+		}
+
+		err := m.RemoveMember(project.Name, e.Username)
+		if err != nil && err != ErrNotProjectMember {
+			m.logger.Error("Error removing deleted user from project",
+				zap.String("project", project.Name), zap.String("username", e.Username), zap.Error(err))
+		}
+	}
+}
+
+// read returns existing project, caller holds mu.
+func (m *ProjectManager) read(name string) (*Project, error) {
+	project, err := m.repo.Read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if project == nil {
+		return nil, ErrProjectNotFound
+	}
+
+	if project.Members == nil {
+		project.Members = map[string]string{}
+	}
+
+	return project, nil
+}
@@ -0,0 +1,274 @@
+package application
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// receiptVersion is signed with receipts, so the signed fields can change
+// without making existing receipts ambiguous.
+const receiptVersion = 1
+
+var ErrReceiptNotValid = errors.New("receipt signature not valid")
+var ErrReceiptsDisabled = errors.New("upload receipts not enabled")
+
+// Receipt proves the server received file of given size and SHA-256 digest
+// from the user at Time.
+type Receipt struct {
+	Version  int    `json:"version"`
+	Username string `json:"username"`
+	// Project is set for files uploaded to project folders.
+	Project string    `json:"project,omitempty"`
+	File    string    `json:"file"`
+	Size    int64     `json:"size"`
+	SHA256  string    `json:"sha256"`
+	Time    time.Time `json:"time"`
+	// KeyID is hex encoded start of SHA-256 of the public key, it tells which
+	// key signed the receipt when the server key is replaced.
+	KeyID string `json:"key_id"`
+	// Signature is base64 encoded Ed25519 signature of all other fields.
+	Signature string `json:"signature"`
+}
+
+type ReceiptRepository interface {
+	// Save stores receipt of the file, replacing an older one.
+	Save(receipt *Receipt) error
+	// Read returns receipt of owner's file, nil if there is none.
+	Read(owner, file string) (*Receipt, error)
+}
+
+// Owner of the receipted file.
+func (r *Receipt) Owner() string {
+	if r.Project != "" {
+		return ProjectOwner(r.Project)
+	}
+
+	return r.Username
+}
+
+// signedData returns the signed fields JSON encoded, so their boundaries are
+// unambiguous.
+func (r *Receipt) signedData() []byte {
+	data, _ := json.Marshal([]interface{}{
+		"direct-upload receipt",
+		r.Version,
+		r.Username,
+		r.Project,
+		r.File,
+		r.Size,
+		r.SHA256,
+		r.Time.UTC().Format(time.RFC3339Nano),
+		r.KeyID,
+	})
+
+	return data
+}
+
+// Verify checks receipt was signed by key, returning ErrReceiptNotValid if
+// not.
+func (r *Receipt) Verify(key ed25519.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil {
+		return ErrReceiptNotValid
+	}
+
+	if r.Version != receiptVersion || r.KeyID != receiptKeyID(key) ||
+		!ed25519.Verify(key, r.signedData(), signature) {
+		return ErrReceiptNotValid
+	}
+
+	return nil
+}
+
+func receiptKeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// LoadReceiptKey reads PEM encoded Ed25519 private key, creating it on first
+// start.
+func LoadReceiptKey(file string) (ed25519.PrivateKey, error) {
+	keyPEM, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return createReceiptKey(file)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("receipt key %s not valid", file)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("receipt key %s is not Ed25519 key", file)
+	}
+
+	return privateKey, nil
+}
+
+func createReceiptKey(file string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeFileAtomic(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// MarshalReceiptPublicKey returns PEM encoded public key, which is published
+// so receipts can be verified offline.
+func MarshalReceiptPublicKey(key ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// ParseReceiptPublicKey parses public key returned by MarshalReceiptPublicKey.
+func ParseReceiptPublicKey(keyPEM []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not Ed25519 key")
+	}
+
+	return publicKey, nil
+}
+
+// ReceiptIssuer signs receipts of closed files and keeps them with the files.
+type ReceiptIssuer struct {
+	key    ed25519.PrivateKey
+	store  FileStore
+	repo   ReceiptRepository
+	logger *zap.Logger
+}
+
+func NewReceiptIssuer(key ed25519.PrivateKey, store FileStore, repo ReceiptRepository, logger *zap.Logger) *ReceiptIssuer {
+	return &ReceiptIssuer{
+		key:    key,
+		store:  store,
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+func (i *ReceiptIssuer) PublicKey() ed25519.PublicKey {
+	return i.key.Public().(ed25519.PublicKey)
+}
+
+// Issue returns receipt of user's closed file. Stored receipt is returned
+// while it matches the file, so clients retrying close get the same one.
+func (i *ReceiptIssuer) Issue(ctx context.Context, file string) (*Receipt, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	r, err := i.store.OpenFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer r.Close()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	stored, err := i.repo.Read(user.Owner(), file)
+	if err != nil {
+		return nil, err
+	}
+
+	if stored != nil && stored.Size == size && stored.SHA256 == digest && stored.Username == user.Username &&
+		stored.KeyID == receiptKeyID(i.PublicKey()) {
+		return stored, nil
+	}
+
+	receipt := &Receipt{
+		Version:  receiptVersion,
+		Username: user.Username,
+		Project:  user.Project,
+		File:     file,
+		Size:     size,
+		SHA256:   digest,
+		Time:     time.Now().UTC(),
+		KeyID:    receiptKeyID(i.PublicKey()),
+	}
+
+	receipt.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(i.key, receipt.signedData()))
+
+	err = i.repo.Save(receipt)
+	if err != nil {
+		return nil, err
+	}
+
+	i.logger.Info("Receipt issued",
+		zap.String("owner", receipt.Owner()), zap.String("file", file), zap.String("sha256", digest))
+
+	return receipt, nil
+}
+
+// Read returns stored receipt of owner's file.
+func (i *ReceiptIssuer) Read(owner, file string) (*Receipt, error) {
+	receipt, err := i.repo.Read(owner, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if receipt == nil {
+		return nil, ErrNotFound
+	}
+
+	return receipt, nil
+}
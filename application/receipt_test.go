@@ -0,0 +1,94 @@
+package application
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type memReceiptRepo map[string]Receipt
+
+func (r memReceiptRepo) Save(receipt *Receipt) error {
+	r[receipt.Owner()+"/"+receipt.File] = *receipt
+	return nil
+}
+
+func (r memReceiptRepo) Read(owner, file string) (*Receipt, error) {
+	receipt, ok := r[owner+"/"+file]
+	if !ok {
+		return nil, nil
+	}
+
+	return &receipt, nil
+}
+
+func TestReceipts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "receipt")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := LoadReceiptKey(filepath.Join(dir, "receipt-key.pem"))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	// key is created once and read on next start
+	if loaded, err := LoadReceiptKey(filepath.Join(dir, "receipt-key.pem")); err != nil || !key.Equal(loaded) {
+		t.Fatal("Expected the same key loaded", err)
+	}
+
+	logger := zaptest.NewLogger(t)
+	store := NewMemoryFileStore(MemoryFileStoreConfig{}, NewEventBus(logger), logger)
+	issuer := NewReceiptIssuer(key, store, memReceiptRepo{}, logger)
+	ctx := newCtx()
+
+	_ = store.AppendFile(ctx, "statement.txt", ioutil.NopCloser(bytes.NewReader([]byte("evidence"))))
+	_, _ = store.CloseFile(ctx, "statement.txt")
+
+	receipt, err := issuer.Issue(ctx, "statement.txt")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	digest := sha256.Sum256([]byte("evidence"))
+
+	if receipt.Username != UsernameTest || receipt.Size != 8 || receipt.SHA256 != hex.EncodeToString(digest[:]) {
+		t.Errorf("Unexpected receipt %+v", receipt)
+	}
+
+	publicKeyPEM, _ := MarshalReceiptPublicKey(issuer.PublicKey())
+
+	publicKey, err := ParseReceiptPublicKey(publicKeyPEM)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := receipt.Verify(publicKey); err != nil {
+		t.Error("Expected receipt valid, got", err)
+	}
+
+	again, _ := issuer.Issue(ctx, "statement.txt")
+	if again.Signature != receipt.Signature {
+		t.Error("Expected the same receipt issued again for unchanged file")
+	}
+
+	tampered := *receipt
+	tampered.Size++
+
+	if err := tampered.Verify(publicKey); err != ErrReceiptNotValid {
+		t.Error("Expected changed receipt not valid, got", err)
+	}
+
+	otherKey, _ := LoadReceiptKey(filepath.Join(dir, "other-key.pem"))
+	if err := receipt.Verify(otherKey.Public().(ed25519.PublicKey)); err != ErrReceiptNotValid {
+		t.Error("Expected receipt not valid for other key, got", err)
+	}
+}
@@ -0,0 +1,617 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// MinPartSize is the smallest part S3 accepts for any part but the last one.
+const MinPartSize = 5 * 1024 * 1024
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStorage is the subset of the S3 API used by S3FileStore.
+type ObjectStorage interface {
+	HeadObject(key string) (size int64, exists bool, err error)
+	GetObject(key string) (io.ReadCloser, error)
+	PutObject(key string, data []byte) error
+	DeleteObject(key string) error
+	CreateMultipartUpload(key string) (uploadID string, err error)
+	UploadPart(key, uploadID string, number int, data []byte) (etag string, err error)
+	CompleteMultipartUpload(key, uploadID string, parts []ObjectPart) error
+	AbortMultipartUpload(key, uploadID string) error
+	// ListObjects returns all objects with keys starting with prefix.
+	ListObjects(prefix string) ([]ObjectInfo, error)
+}
+
+type ObjectInfo struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+type ObjectPart struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// S3FileStore keeps uploads in S3-compatible object storage, so several
+// server replicas can share it. Every append is mapped to multipart upload
+// parts; data short of a full part is kept in a buffer object until more data
+// arrives or the file is closed. Upload state lives next to the data, so no
+// replica keeps anything locally.
+type S3FileStore struct {
+	config  S3FileStoreConfig
+	storage ObjectStorage
+	events  *EventBus
+	logger  *zap.Logger
+}
+
+type S3FileStoreConfig struct {
+	Prefix    string
+	PartSize  int64
+	Collision CollisionPolicy
+}
+
+type s3Upload struct {
+	UploadID string
+	Parts    []ObjectPart
+	// Version is the name the file is closed under, multipart upload is bound
+	// to its key from the start. Empty means the uploaded name.
+	Version string
+}
+
+// usernames can't start with a dot, so upload state never clashes with files
+const s3UploadsDir = ".uploads"
+
+func NewS3FileStore(config S3FileStoreConfig, storage ObjectStorage, events *EventBus, logger *zap.Logger) (*S3FileStore, error) {
+	if config.PartSize < MinPartSize {
+		config.PartSize = MinPartSize
+	}
+
+	return &S3FileStore{
+		config:  config,
+		storage: storage,
+		events:  events,
+		logger:  logger,
+	}, nil
+}
+
+func (m *S3FileStore) GetFileInfo(ctx context.Context, file string) (*FileInfo, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	closed, size, err := m.closedObject(user.Owner(), file)
+	if err != nil {
+		m.logger.Error("Error getting object",
+			zap.String("owner", user.Owner()), zap.String("file", file), zap.Error(err))
+		return nil, err
+	}
+
+	if !closed {
+		size, err = m.uploadSize(user.Owner(), file)
+		if err != nil {
+			m.logger.Error("Error getting upload state",
+				zap.String("owner", user.Owner()), zap.String("file", file), zap.Error(err))
+			return nil, err
+		}
+	}
+
+	m.logger.Info("Returning file info", zap.String("file", file), zap.Int64("size", size))
+
+	return &FileInfo{
+		Size: size,
+	}, nil
+}
+
+func (m *S3FileStore) AppendFile(ctx context.Context, file string, data io.ReadCloser) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return ErrNoUserCtx
+	}
+
+	closed, _, err := m.closedObject(user.Owner(), file)
+	if err != nil {
+		m.logger.Error("Error getting object",
+			zap.String("owner", user.Owner()), zap.String("file", file), zap.Error(err))
+		return err
+	}
+
+	if closed {
+		m.logger.Error("Appending on closed file", zap.String("file", file))
+		return ErrConflict
+	}
+
+	upload, err := m.readUpload(user.Owner(), file)
+	if err != nil {
+		return err
+	}
+
+	started := upload == nil
+
+	if started {
+		upload = &s3Upload{}
+
+		if m.config.Collision == CollisionVersion {
+			upload.Version, err = m.nextVersion(user.Owner(), file)
+			if err != nil {
+				m.logger.Error("Error choosing version name", zap.String("file", file), zap.Error(err))
+				return err
+			}
+		}
+
+		upload.UploadID, err = m.storage.CreateMultipartUpload(m.uploadKey(user.Owner(), file, upload))
+		if err != nil {
+			m.logger.Error("Error creating multipart upload", zap.String("file", file), zap.Error(err))
+			return err
+		}
+
+		err = m.writeUpload(user.Owner(), file, upload)
+		if err != nil {
+			return err
+		}
+	}
+
+	buffer, err := m.readBuffer(user.Owner(), file)
+	if err != nil {
+		return err
+	}
+
+	written, err := m.appendParts(user.Owner(), file, upload, buffer, data)
+	if err != nil {
+		m.logger.Error("Error writing to file", zap.Error(err), zap.String("file", file))
+		return err
+	}
+
+	m.logger.Info("Appending file", zap.String("file", file), zap.Int64("written", written))
+
+	if started {
+		m.events.Publish(Event{Type: EventUploadStarted, Username: user.Username, Project: user.Project, File: file})
+	}
+
+	return nil
+}
+
+func (m *S3FileStore) CloseFile(ctx context.Context, file string) (string, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return "", ErrNoUserCtx
+	}
+
+	closed, _, err := m.closedObject(user.Owner(), file)
+	if err != nil {
+		return "", err
+	}
+
+	if closed {
+		m.logger.Info("Closing already closed file", zap.String("file", file))
+		return file, nil
+	}
+
+	upload, err := m.readUpload(user.Owner(), file)
+	if err != nil {
+		return "", err
+	}
+
+	if upload == nil && m.config.Collision == CollisionVersion {
+		files, err := m.ListFiles(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		// retried close refers to the version closed last
+		if last := lastVersionName(files, file); last != "" {
+			m.logger.Info("Closing already closed file", zap.String("file", file), zap.String("version", last))
+			return last, nil
+		}
+	}
+
+	if upload == nil {
+		m.logger.Warn("Closing non-existent file", zap.String("file", file))
+		return "", nil
+	}
+
+	key := m.uploadKey(user.Owner(), file, upload)
+
+	buffer, err := m.readBuffer(user.Owner(), file)
+	if err != nil {
+		return "", err
+	}
+
+	// last part is allowed to be smaller than minimal part size, and
+	// completing needs at least one part
+	if len(buffer) > 0 || len(upload.Parts) == 0 {
+		err = m.uploadPart(key, upload, buffer)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = m.storage.CompleteMultipartUpload(key, upload.UploadID, upload.Parts)
+	if err != nil {
+		m.logger.Error("Error completing multipart upload", zap.Error(err), zap.String("file", file))
+		return "", err
+	}
+
+	m.removeUpload(user.Owner(), file)
+
+	version := file
+	if upload.Version != "" {
+		version = upload.Version
+	}
+
+	m.logger.Info("Closing file", zap.String("file", file), zap.String("version", version))
+
+	m.events.Publish(Event{Type: EventFileClosed, Username: user.Username, Project: user.Project, File: version})
+
+	return version, nil
+}
+
+func (m *S3FileStore) DeleteFile(ctx context.Context, file string) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return ErrNoUserCtx
+	}
+
+	upload, err := m.readUpload(user.Owner(), file)
+	if err != nil {
+		return err
+	}
+
+	if upload == nil {
+		m.logger.Warn("Deleting non-existent upload", zap.String("file", file))
+		return nil
+	}
+
+	err = m.storage.AbortMultipartUpload(m.uploadKey(user.Owner(), file, upload), upload.UploadID)
+	if err != nil {
+		m.logger.Error("Error aborting multipart upload", zap.Error(err), zap.String("file", file))
+		return err
+	}
+
+	m.removeUpload(user.Owner(), file)
+
+	m.logger.Info("Deleting upload", zap.String("file", file))
+
+	m.events.Publish(Event{Type: EventFileDeleted, Username: user.Username, Project: user.Project, File: file})
+
+	return nil
+}
+
+func (m *S3FileStore) RemoveClosedFile(ctx context.Context, file string) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return ErrNoUserCtx
+	}
+
+	key := m.objectKey(user.Owner(), file)
+
+	_, exists, err := m.storage.HeadObject(key)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrNotFound
+	}
+
+	err = m.storage.DeleteObject(key)
+	if err != nil {
+		m.logger.Error("Error removing file", zap.Error(err), zap.String("file", file))
+		return err
+	}
+
+	m.logger.Info("Removing closed file", zap.String("file", file))
+
+	m.events.Publish(Event{Type: EventFileDeleted, Username: user.Username, Project: user.Project, File: file})
+
+	return nil
+}
+
+func (m *S3FileStore) OpenFile(ctx context.Context, file string) (io.ReadCloser, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	r, err := m.storage.GetObject(m.objectKey(user.Owner(), file))
+	if err == ErrObjectNotFound {
+		return nil, ErrNotFound
+	}
+
+	return r, err
+}
+
+// ListFiles returns closed files, including all versions, and uploads in
+// progress of the user in context.
+func (m *S3FileStore) ListFiles(ctx context.Context) ([]FileInfo, error) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return nil, ErrNoUserCtx
+	}
+
+	var files []FileInfo
+
+	prefix := m.userPrefix(user.Owner())
+
+	objects, err := m.storage.ListObjects(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range objects {
+		files = append(files, FileInfo{
+			Name:    strings.TrimPrefix(object.Key, prefix),
+			Size:    object.Size,
+			Closed:  true,
+			Updated: object.Modified,
+		})
+	}
+
+	prefix = m.uploadsPrefix(user.Owner())
+
+	states, err := m.storage.ListObjects(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, state := range states {
+		if !strings.HasSuffix(state.Key, ".json") {
+			continue
+		}
+
+		file := strings.TrimSuffix(strings.TrimPrefix(state.Key, prefix), ".json")
+
+		size, err := m.uploadSize(user.Owner(), file)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, FileInfo{
+			Name:    file,
+			Size:    size,
+			Updated: state.Modified,
+		})
+	}
+
+	sortFileInfos(files)
+
+	return files, nil
+}
+
+// closedObject reports the closed file HEAD and PUT requests refer to, which
+// is none when uploading it again starts a new version.
+func (m *S3FileStore) closedObject(username, file string) (bool, int64, error) {
+	if m.config.Collision == CollisionVersion {
+		return false, 0, nil
+	}
+
+	size, closed, err := m.storage.HeadObject(m.objectKey(username, file))
+
+	return closed, size, err
+}
+
+// nextVersion returns the first version name neither closed nor reserved by
+// another upload.
+func (m *S3FileStore) nextVersion(username, file string) (string, error) {
+	reserved := map[string]bool{}
+
+	objects, err := m.storage.ListObjects(m.uploadsPrefix(username))
+	if err != nil {
+		return "", err
+	}
+
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, ".json") {
+			continue
+		}
+
+		upload, err := m.readUpload(username, strings.TrimSuffix(path.Base(object.Key), ".json"))
+		if err != nil {
+			return "", err
+		}
+
+		if upload != nil && upload.Version != "" {
+			reserved[upload.Version] = true
+		}
+	}
+
+	return nextVersionName(file, func(name string) (bool, error) {
+		if reserved[name] {
+			return true, nil
+		}
+
+		_, exists, err := m.storage.HeadObject(m.objectKey(username, name))
+
+		return exists, err
+	})
+}
+
+// appendParts reads data into the buffer, uploading a part every time the
+// buffer fills up. Stored buffer is dropped before the state recording the
+// new part is saved, so an interrupted append can only under-report the size
+// and the client resends the missing data.
+func (m *S3FileStore) appendParts(username, file string, upload *s3Upload, buffer []byte, data io.Reader) (int64, error) {
+	key := m.uploadKey(username, file, upload)
+	chunk := make([]byte, m.config.PartSize)
+	buffered := len(buffer) > 0
+
+	var written int64
+
+	for {
+		if int64(len(buffer)) >= m.config.PartSize {
+			err := m.uploadPart(key, upload, buffer)
+			if err != nil {
+				return written, err
+			}
+
+			if buffered {
+				err = m.storage.DeleteObject(m.bufferKey(username, file))
+				if err != nil {
+					return written, err
+				}
+
+				buffered = false
+			}
+
+			err = m.writeUpload(username, file, upload)
+			if err != nil {
+				return written, err
+			}
+
+			buffer = buffer[:0]
+		}
+
+		n, err := io.ReadFull(data, chunk[:m.config.PartSize-int64(len(buffer))])
+		buffer = append(buffer, chunk[:n]...)
+		written += int64(n)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return written, err
+		}
+	}
+
+	if len(buffer) > 0 {
+		err := m.storage.PutObject(m.bufferKey(username, file), buffer)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+func (m *S3FileStore) uploadPart(key string, upload *s3Upload, data []byte) error {
+	number := len(upload.Parts) + 1
+
+	etag, err := m.storage.UploadPart(key, upload.UploadID, number, data)
+	if err != nil {
+		m.logger.Error("Error uploading part", zap.String("key", key), zap.Int("part", number), zap.Error(err))
+		return err
+	}
+
+	upload.Parts = append(upload.Parts, ObjectPart{Number: number, ETag: etag, Size: int64(len(data))})
+
+	return nil
+}
+
+func (m *S3FileStore) uploadSize(username, file string) (int64, error) {
+	upload, err := m.readUpload(username, file)
+	if err != nil || upload == nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, part := range upload.Parts {
+		size += part.Size
+	}
+
+	bufferSize, _, err := m.storage.HeadObject(m.bufferKey(username, file))
+	if err != nil {
+		return 0, err
+	}
+
+	return size + bufferSize, nil
+}
+
+func (m *S3FileStore) readUpload(username, file string) (*s3Upload, error) {
+	r, err := m.storage.GetObject(m.stateKey(username, file))
+	if err == ErrObjectNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer r.Close()
+
+	var upload s3Upload
+
+	err = json.NewDecoder(r).Decode(&upload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+func (m *S3FileStore) writeUpload(username, file string, upload *s3Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	return m.storage.PutObject(m.stateKey(username, file), data)
+}
+
+func (m *S3FileStore) readBuffer(username, file string) ([]byte, error) {
+	r, err := m.storage.GetObject(m.bufferKey(username, file))
+	if err == ErrObjectNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer r.Close()
+
+	var buf bytes.Buffer
+
+	_, err = buf.ReadFrom(r)
+
+	return buf.Bytes(), err
+}
+
+func (m *S3FileStore) removeUpload(username, file string) {
+	for _, key := range []string{m.bufferKey(username, file), m.stateKey(username, file)} {
+		err := m.storage.DeleteObject(key)
+		if err != nil {
+			m.logger.Warn("Error removing upload state", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+func (m *S3FileStore) objectKey(username, file string) string {
+	return path.Join(m.config.Prefix, username, file)
+}
+
+// uploadKey returns key of the object the upload completes into.
+func (m *S3FileStore) uploadKey(username, file string, upload *s3Upload) string {
+	if upload.Version != "" {
+		return m.objectKey(username, upload.Version)
+	}
+
+	return m.objectKey(username, file)
+}
+
+func (m *S3FileStore) userPrefix(username string) string {
+	return path.Join(m.config.Prefix, username) + "/"
+}
+
+func (m *S3FileStore) uploadsPrefix(username string) string {
+	return path.Join(m.config.Prefix, s3UploadsDir, username) + "/"
+}
+
+func (m *S3FileStore) stateKey(username, file string) string {
+	return path.Join(m.config.Prefix, s3UploadsDir, username, file+".json")
+}
+
+func (m *S3FileStore) bufferKey(username, file string) string {
+	return path.Join(m.config.Prefix, s3UploadsDir, username, file+".buffer")
+}
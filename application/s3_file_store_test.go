@@ -0,0 +1,56 @@
+package application_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/horizontal-org/direct-upload/application/filestoretest"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"testing"
+)
+
+func TestS3FileStore_PartBuffering(t *testing.T) {
+	storage := filestoretest.NewObjectStorage()
+	store, _ := application.NewS3FileStore(application.S3FileStoreConfig{Prefix: "files"}, storage, nil, zaptest.NewLogger(t))
+
+	ctx := application.NewContext(context.Background(), &application.User{Username: "reporter"})
+
+	var expected []byte
+
+	// small chunks are buffered until they make a full part
+	for _, size := range []int{1024, application.MinPartSize - 1000, application.MinPartSize + 3000, 10} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(len(expected) + i)
+		}
+		expected = append(expected, data...)
+
+		err := store.AppendFile(ctx, "file.bin", ioutil.NopCloser(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		info, err := store.GetFileInfo(ctx, "file.bin")
+		if err != nil {
+			t.Fatal("Error while running test", err)
+		}
+		if info.Size != int64(len(expected)) {
+			t.Errorf("Bad size: expected %d, got %d", len(expected), info.Size)
+		}
+	}
+
+	_, err := store.CloseFile(ctx, "file.bin")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	data, _ := storage.Object("files/reporter/file.bin")
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Stored object differs from uploaded data")
+	}
+
+	if keys := storage.Keys(); len(keys) != 1 {
+		t.Errorf("Upload state left after close: %v", keys)
+	}
+}
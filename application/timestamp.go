@@ -0,0 +1,539 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	timestampQueryType = "application/timestamp-query"
+	timestampReplyType = "application/timestamp-reply"
+
+	// maxTimestampReply limits TSA response read into memory.
+	maxTimestampReply = 1024 * 1024
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+var ErrTimestampsDisabled = errors.New("trusted timestamps not enabled")
+var ErrTimestampMissing = errors.New("file has no timestamp")
+
+// TimestampError tells why timestamp token was not issued or is not valid.
+type TimestampError struct {
+	Reason string
+}
+
+func (e *TimestampError) Error() string {
+	return "timestamp not valid: " + e.Reason
+}
+
+// TimestampToken is RFC 3161 timestamp of a file digest, Token is the DER
+// encoded token as issued by the TSA.
+type TimestampToken struct {
+	TSA    string
+	Time   time.Time
+	Serial string
+	// Signer is subject of the TSA certificate.
+	Signer string
+	Token  []byte
+}
+
+type TimestampConfig struct {
+	// URL of the TSA.
+	URL string
+	// Roots verify TSA certificates, system roots are used when nil.
+	Roots   *x509.CertPool
+	Timeout time.Duration
+}
+
+// Timestamper requests RFC 3161 timestamps of SHA-256 digests from a TSA
+// and verifies them.
+type Timestamper struct {
+	config TimestampConfig
+	client *http.Client
+}
+
+func NewTimestamper(config TimestampConfig) (*Timestamper, error) {
+	if config.URL == "" {
+		return nil, errors.New("timestamp: TSA URL not set")
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	if config.Roots == nil {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+
+		config.Roots = roots
+	}
+
+	return &Timestamper{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// contentInfo and the types below are the parts of CMS SignedData (RFC 5652)
+// used by timestamp tokens. Tagged fields are kept raw, so they encode back
+// the same.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// Stamp requests timestamp of SHA-256 digest, the token is verified before
+// it's returned.
+func (t *Timestamper) Stamp(ctx context.Context, digest []byte) (*TimestampToken, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.config.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("content-type", timestampQueryType)
+
+	res, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("timestamp: TSA responded with %s", res.Status)
+	}
+
+	if contentType := res.Header.Get("content-type"); !strings.HasPrefix(contentType, timestampReplyType) {
+		return nil, fmt.Errorf("timestamp: unexpected TSA response of type %q", contentType)
+	}
+
+	reply, err := ioutil.ReadAll(io.LimitReader(res.Body, maxTimestampReply))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp timeStampResp
+
+	_, err = asn1.Unmarshal(reply, &resp)
+	if err != nil {
+		return nil, &TimestampError{Reason: "response not valid: " + err.Error()}
+	}
+
+	// granted, or granted with modifications
+	if resp.Status.Status > 1 || len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, &TimestampError{Reason: fmt.Sprintf("TSA refused with status %d %s",
+			resp.Status.Status, strings.Join(resp.Status.StatusString, " "))}
+	}
+
+	token, info, err := t.verify(resp.TimeStampToken.FullBytes, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, &TimestampError{Reason: "nonce doesn't match the request"}
+	}
+
+	token.TSA = t.config.URL
+
+	return token, nil
+}
+
+// Verify checks token is a timestamp of SHA-256 digest signed by a trusted
+// TSA.
+func (t *Timestamper) Verify(token, digest []byte) (*TimestampToken, error) {
+	verified, _, err := t.verify(token, digest)
+
+	return verified, err
+}
+
+func (t *Timestamper) verify(token, digest []byte) (*TimestampToken, *tstInfo, error) {
+	invalid := func(reason string, err error) (*TimestampToken, *tstInfo, error) {
+		if err != nil {
+			reason += ": " + err.Error()
+		}
+
+		return nil, nil, &TimestampError{Reason: reason}
+	}
+
+	var ci contentInfo
+
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil || len(rest) > 0 || !ci.ContentType.Equal(oidSignedData) {
+		return invalid("token is not CMS signed data", err)
+	}
+
+	var sd signedData
+
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return invalid("signed data not valid", err)
+	}
+
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) || len(sd.SignerInfos) != 1 {
+		return invalid("token doesn't hold timestamp of a single signer", nil)
+	}
+
+	var content []byte
+
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &content); err != nil {
+		return invalid("timestamp content not valid", err)
+	}
+
+	var info tstInfo
+
+	if _, err := asn1.Unmarshal(content, &info); err != nil {
+		return invalid("timestamp info not valid", err)
+	}
+
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) ||
+		!bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return invalid("timestamp is of other digest than the file's", nil)
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil || len(certs) == 0 {
+		return invalid("token has no TSA certificate", err)
+	}
+
+	signer := sd.SignerInfos[0]
+
+	cert := findSignerCertificate(certs, signer.SID)
+	if cert == nil {
+		return invalid("TSA certificate of signer not found", nil)
+	}
+
+	err = verifySignerInfo(cert, signer, content)
+	if err != nil {
+		return invalid("signature not valid", err)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         t.config.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return invalid("TSA certificate not trusted", err)
+	}
+
+	return &TimestampToken{
+		Time:   info.GenTime,
+		Serial: hex.EncodeToString(info.SerialNumber.Bytes()),
+		Signer: cert.Subject.String(),
+		Token:  token,
+	}, &info, nil
+}
+
+// findSignerCertificate finds certificate by issuer and serial number, or by
+// subject key identifier.
+func findSignerCertificate(certs []*x509.Certificate, sid asn1.RawValue) *x509.Certificate {
+	var ias issuerAndSerialNumber
+
+	byIssuer := sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence
+	if byIssuer {
+		if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+			return nil
+		}
+	}
+
+	for _, cert := range certs {
+		if byIssuer && bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.Serial) == 0 {
+			return cert
+		}
+
+		if !byIssuer && sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 &&
+			bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+			return cert
+		}
+	}
+
+	return nil
+}
+
+// verifySignerInfo checks signed attributes hold digest of content, and
+// their signature by cert.
+func verifySignerInfo(cert *x509.Certificate, signer signerInfo, content []byte) error {
+	hash, ok := digestHash(signer.DigestAlgorithm.Algorithm)
+	if !ok {
+		return fmt.Errorf("unsupported digest algorithm %v", signer.DigestAlgorithm.Algorithm)
+	}
+
+	if len(signer.SignedAttrs.FullBytes) == 0 {
+		return errors.New("no signed attributes")
+	}
+
+	// attributes are signed as SET, not with their implicit tag
+	signed := append([]byte{0x31}, signer.SignedAttrs.FullBytes[1:]...)
+
+	var attrs []attribute
+
+	if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		return err
+	}
+
+	var contentType asn1.ObjectIdentifier
+	var messageDigest []byte
+
+	for _, attr := range attrs {
+		if len(attr.Values) != 1 {
+			continue
+		}
+
+		switch {
+		case attr.Type.Equal(oidContentType):
+			_, _ = asn1.Unmarshal(attr.Values[0].FullBytes, &contentType)
+		case attr.Type.Equal(oidMessageDigest):
+			_, _ = asn1.Unmarshal(attr.Values[0].FullBytes, &messageDigest)
+		}
+	}
+
+	h := hash.New()
+	h.Write(content)
+
+	if !contentType.Equal(oidTSTInfo) || !bytes.Equal(messageDigest, h.Sum(nil)) {
+		return errors.New("signed attributes don't match the timestamp")
+	}
+
+	algorithm, ok := signatureAlgorithm(cert, hash)
+	if !ok {
+		return errors.New("unsupported signature algorithm")
+	}
+
+	return cert.CheckSignature(algorithm, signed, signer.Signature)
+}
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+
+	return 0, false
+}
+
+func signatureAlgorithm(cert *x509.Certificate, hash crypto.Hash) (x509.SignatureAlgorithm, bool) {
+	algorithms := map[crypto.Hash][2]x509.SignatureAlgorithm{
+		crypto.SHA256: {x509.SHA256WithRSA, x509.ECDSAWithSHA256},
+		crypto.SHA384: {x509.SHA384WithRSA, x509.ECDSAWithSHA384},
+		crypto.SHA512: {x509.SHA512WithRSA, x509.ECDSAWithSHA512},
+	}
+
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return algorithms[hash][0], true
+	case *ecdsa.PublicKey:
+		return algorithms[hash][1], true
+	}
+
+	return x509.UnknownSignatureAlgorithm, false
+}
+
+// VerifyFile checks timestamp stored with file metadata against the current
+// content of the file.
+func (t *Timestamper) VerifyFile(ctx context.Context, store FileStore, meta *FileMetadata) (*TimestampToken, error) {
+	if meta.Timestamp == nil {
+		return nil, ErrTimestampMissing
+	}
+
+	r, err := store.OpenFile(ctx, meta.File)
+	if err != nil {
+		return nil, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer r.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, r)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := t.Verify(meta.Timestamp.Token, hash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	token.TSA = meta.Timestamp.TSA
+
+	return token, nil
+}
+
+// TimestampProcessor requests trusted timestamp of closed file digest and
+// stores the token with the file metadata.
+type TimestampProcessor struct {
+	timestamper *Timestamper
+	metadata    FileMetadataRepository
+}
+
+func NewTimestampProcessor(timestamper *Timestamper, metadata FileMetadataRepository) *TimestampProcessor {
+	return &TimestampProcessor{
+		timestamper: timestamper,
+		metadata:    metadata,
+	}
+}
+
+func (p *TimestampProcessor) Name() string {
+	return "timestamp"
+}
+
+func (p *TimestampProcessor) Process(ctx context.Context, job *ProcessingJob) (string, error) {
+	digest, err := hex.DecodeString(job.Digest)
+	if err != nil || len(digest) != sha256.Size {
+		return "", fmt.Errorf("processor timestamp: digest %q not valid", job.Digest)
+	}
+
+	token, err := p.timestamper.Stamp(ctx, digest)
+	if err != nil {
+		return "", err
+	}
+
+	meta, err := readOrNewMetadata(p.metadata, job.Username, job.File)
+	if err != nil {
+		return "", err
+	}
+
+	meta.Size = job.Size
+	meta.Digest = job.Digest
+	meta.Timestamp = token
+	meta.Updated = time.Now()
+
+	err = p.metadata.Save(meta)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("timestamped at %s by %s", token.Time.Format(time.RFC3339), token.Signer), nil
+}
@@ -0,0 +1,246 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testTSA is an in-process stand-in for RFC 3161 time stamping authority.
+type testTSA struct {
+	root   *x509.Certificate
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	status int
+	serial int64
+	// nonce overrides nonce of the request when set.
+	nonce *big.Int
+}
+
+func newTestTSA(t *testing.T) *testTSA {
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	root, _ := x509.ParseCertificate(rootDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	cert, _ := x509.ParseCertificate(certDER)
+
+	return &testTSA{root: root, cert: cert, key: key}
+}
+
+func (tsa *testTSA) roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(tsa.root)
+
+	return roots
+}
+
+func (tsa *testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	var req timeStampReq
+
+	if _, err := asn1.Unmarshal(body, &req); err != nil || r.Header.Get("content-type") != timestampQueryType {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	resp := timeStampResp{Status: pkiStatusInfo{Status: tsa.status}}
+
+	if tsa.status == 0 {
+		nonce := req.Nonce
+		if tsa.nonce != nil {
+			nonce = tsa.nonce
+		}
+
+		tsa.serial++
+		resp.TimeStampToken = asn1.RawValue{FullBytes: tsa.sign(req.MessageImprint, nonce)}
+	} else {
+		resp.Status.StatusString = []string{"refused"}
+	}
+
+	reply, _ := asn1.Marshal(resp)
+
+	w.Header().Set("content-type", timestampReplyType)
+	_, _ = w.Write(reply)
+}
+
+func (tsa *testTSA) sign(imprint messageImprint, nonce *big.Int) []byte {
+	content, _ := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: imprint,
+		SerialNumber:   big.NewInt(tsa.serial),
+		GenTime:        time.Now().UTC().Truncate(time.Second),
+		Nonce:          nonce,
+	})
+
+	contentType, _ := asn1.Marshal(oidTSTInfo)
+	contentDigest := sha256.Sum256(content)
+	messageDigest, _ := asn1.Marshal(contentDigest[:])
+
+	signedAttrs, _ := asn1.MarshalWithParams([]attribute{
+		{Type: oidContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: oidMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+	}, "set")
+
+	signedDigest := sha256.Sum256(signedAttrs)
+	signature, _ := tsa.key.Sign(rand.Reader, signedDigest[:], crypto.SHA256)
+
+	sid, _ := asn1.Marshal(issuerAndSerialNumber{
+		Issuer: asn1.RawValue{FullBytes: tsa.cert.RawIssuer},
+		Serial: tsa.cert.SerialNumber,
+	})
+
+	eContent, _ := asn1.Marshal(content)
+
+	sd, _ := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: oidTSTInfo,
+			EContent:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: eContent},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{FullBytes: append([]byte{0xa0}, signedAttrs[1:]...)},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          signature,
+		}},
+	})
+
+	token, _ := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+
+	return token
+}
+
+func TestTimestamps(t *testing.T) {
+	tsa := newTestTSA(t)
+
+	server := httptest.NewServer(tsa)
+	defer server.Close()
+
+	timestamper, err := NewTimestamper(TimestampConfig{URL: server.URL, Roots: tsa.roots()})
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	logger := zaptest.NewLogger(t)
+	store := NewMemoryFileStore(MemoryFileStoreConfig{}, NewEventBus(logger), logger)
+	metadata := &memFileMetadataRepo{metadata: map[string]FileMetadata{}}
+	ctx := newCtx()
+
+	_ = store.AppendFile(ctx, "statement.txt", ioutil.NopCloser(bytes.NewReader([]byte("evidence"))))
+	_, _ = store.CloseFile(ctx, "statement.txt")
+
+	digest := sha256.Sum256([]byte("evidence"))
+
+	processor := NewTimestampProcessor(timestamper, metadata)
+
+	_, err = processor.Process(context.Background(), &ProcessingJob{
+		Username: UsernameTest,
+		File:     "statement.txt",
+		Size:     8,
+		Digest:   hex.EncodeToString(digest[:]),
+	})
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	meta, _ := metadata.Read(UsernameTest, "statement.txt")
+	if meta == nil || meta.Timestamp == nil || meta.Timestamp.TSA != server.URL || meta.Timestamp.Signer != "CN=Test TSA" {
+		t.Fatalf("Expected timestamp stored with metadata, got %+v", meta)
+	}
+
+	token, err := timestamper.VerifyFile(ctx, store, meta)
+	if err != nil {
+		t.Fatal("Expected timestamp valid, got", err)
+	}
+
+	if !token.Time.Equal(meta.Timestamp.Time) || token.Serial != "01" {
+		t.Errorf("Unexpected verified timestamp %+v", token)
+	}
+
+	if _, err := timestamper.Verify(meta.Timestamp.Token, make([]byte, sha256.Size)); err == nil {
+		t.Error("Expected timestamp not valid for other digest")
+	}
+
+	// timestamp doesn't match content of other file
+	_ = store.AppendFile(ctx, "other.txt", ioutil.NopCloser(bytes.NewReader([]byte("tampered"))))
+	_, _ = store.CloseFile(ctx, "other.txt")
+
+	other := *meta
+	other.File = "other.txt"
+
+	if _, err := timestamper.VerifyFile(ctx, store, &other); err == nil {
+		t.Error("Expected timestamp not valid for other file")
+	}
+
+	untrusted, _ := NewTimestamper(TimestampConfig{URL: server.URL, Roots: newTestTSA(t).roots()})
+	if _, err := untrusted.Verify(meta.Timestamp.Token, digest[:]); err == nil {
+		t.Error("Expected timestamp of untrusted TSA not valid")
+	}
+
+	if _, err := untrusted.Stamp(context.Background(), digest[:]); err == nil {
+		t.Error("Expected timestamp of untrusted TSA refused")
+	}
+
+	tsa.nonce = big.NewInt(42)
+	if _, err := timestamper.Stamp(context.Background(), digest[:]); err == nil {
+		t.Error("Expected replayed timestamp refused")
+	}
+
+	tsa.status = 2
+	if _, err := timestamper.Stamp(context.Background(), digest[:]); err == nil {
+		t.Error("Expected refusal of TSA reported")
+	}
+}
@@ -2,19 +2,57 @@ package application
 
 import (
 	"context"
+	"errors"
 	"regexp"
 )
 
 type User struct {
 	Username string
+	Role     string
+	// Project is set when user works in a shared project folder instead of
+	// their own one.
+	Project string
 }
 
+// projectOwnerPrefix marks storage owners that are projects, usernames can't
+// start with it.
+const projectOwnerPrefix = "@"
+
+// ProjectOwner returns storage owner of the project folder.
+func ProjectOwner(project string) string {
+	return projectOwnerPrefix + project
+}
+
+// Owner returns whose folder file stores use, the project or the user.
+func (u *User) Owner() string {
+	if u.Project != "" {
+		return ProjectOwner(u.Project)
+	}
+
+	return u.Username
+}
+
+// Roles of users. Everyone uploads to their own directory, reviewers also
+// read closed files of other users and admins also manage users.
+const (
+	RoleUploader = "uploader"
+	RoleReviewer = "reviewer"
+	RoleAdmin    = "admin"
+)
+
 type key int
 
 const (
 	userKey key = iota
 )
 
+var (
+	ErrUsernameNotValid = errors.New("username not valid")
+	ErrUsernameExists   = errors.New("username already exists")
+	ErrUsernameNotFound = errors.New("username not found")
+	ErrRoleNotValid     = errors.New("role not valid, use uploader, reviewer or admin")
+)
+
 var usernameRegexp = regexp.MustCompile("^[a-zA-Z0-9_][a-zA-Z0-9@_.\\-]*$")
 
 func NewContext(ctx context.Context, user *User) context.Context {
@@ -29,3 +67,12 @@ func UserFromContext(ctx context.Context) (*User, bool) {
 func ValidUsername(str string) bool {
 	return usernameRegexp.MatchString(str)
 }
+
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUploader, RoleReviewer, RoleAdmin:
+		return true
+	}
+
+	return false
+}
@@ -1,6 +1,27 @@
 package application
 
+import "time"
+
 type UserAuth struct {
-	Username     string
+	Username string
+	// PasswordHash starts with identifier of its algorithm and parameters,
+	// see PasswordHasher.
 	PasswordHash string
+	// Role is empty for users created before roles, they are uploaders.
+	Role string
+	// Disabled accounts keep their files and history, but can't log in.
+	Disabled bool
+	// Expires is zero for accounts that never expire.
+	Expires time.Time
+	// UploadWindows limit when user may use the server, any time when empty.
+	UploadWindows []UploadWindow
+}
+
+// UserRole returns role of the user, RoleUploader for users without one.
+func (u *UserAuth) UserRole() string {
+	if u.Role == "" {
+		return RoleUploader
+	}
+
+	return u.Role
 }
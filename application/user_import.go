@@ -0,0 +1,129 @@
+package application
+
+import "go.uber.org/zap"
+
+// ImportUser is a user to create by ImportUsers. Optional fields keep
+// defaults when empty, Expires is parsed by ParseExpiry and UploadWindows by
+// ParseUploadWindow.
+type ImportUser struct {
+	// Row identifies the user in errors, ie. line of the imported file.
+	Row           int
+	Username      string
+	Password      string
+	Role          string
+	Disabled      bool
+	Expires       string
+	UploadWindows []string
+}
+
+// ImportRowError is why a user can't be imported.
+type ImportRowError struct {
+	Row      int
+	Username string
+	Error    string
+}
+
+// ImportUsers creates all users at once, or none of them when any row is not
+// valid. All rows are checked, so every error can be fixed in one go. Dry run
+// only checks the rows.
+func (m *AuthManager) ImportUsers(users []ImportUser, dryRun bool) ([]ImportRowError, error) {
+	var rowErrors []ImportRowError
+	var created []*UserAuth
+
+	policy := m.passwordPolicy()
+	seen := map[string]bool{}
+
+	for _, user := range users {
+		userAuth, err := m.importUser(user, policy, seen, dryRun)
+		if err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: user.Row, Username: user.Username, Error: err.Error()})
+			continue
+		}
+
+		created = append(created, userAuth)
+	}
+
+	if len(rowErrors) > 0 || dryRun {
+		return rowErrors, nil
+	}
+
+	err := m.authRepo.CreateAll(created)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Info("Users imported", zap.Int("count", len(created)))
+
+	for _, userAuth := range created {
+		m.events.Publish(Event{Type: EventUserCreated, Username: userAuth.Username})
+	}
+
+	return nil, nil
+}
+
+// importUser returns valid user record, without password hash on dry run.
+func (m *AuthManager) importUser(user ImportUser, policy PasswordPolicy, seen map[string]bool,
+	dryRun bool) (*UserAuth, error) {
+	if !ValidUsername(user.Username) {
+		return nil, ErrUsernameNotValid
+	}
+
+	if seen[user.Username] {
+		return nil, ErrUsernameExists
+	}
+
+	seen[user.Username] = true
+
+	exists, err := m.HasUsername(user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, ErrUsernameExists
+	}
+
+	err = policy.Check(user.Username, user.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	userAuth := &UserAuth{
+		Username: user.Username,
+		Role:     RoleUploader,
+		Disabled: user.Disabled,
+	}
+
+	if user.Role != "" {
+		if !ValidRole(user.Role) {
+			return nil, ErrRoleNotValid
+		}
+
+		userAuth.Role = user.Role
+	}
+
+	if user.Expires != "" {
+		userAuth.Expires, err = ParseExpiry(user.Expires)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, spec := range user.UploadWindows {
+		window, err := ParseUploadWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		userAuth.UploadWindows = append(userAuth.UploadWindows, window)
+	}
+
+	if !dryRun {
+		userAuth.PasswordHash, err = m.hashPassword(user.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return userAuth, nil
+}
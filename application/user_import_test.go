@@ -0,0 +1,121 @@
+package application
+
+import (
+	"go.uber.org/zap/zaptest"
+	"testing"
+)
+
+// testPassword is accepted by the default password policy.
+const testPassword = "plum-harbor-lantern"
+
+// newTestAuthManager manages alice (uploader) with testPassword.
+func newTestAuthManager(t *testing.T) *AuthManager {
+	logger := zaptest.NewLogger(t)
+
+	am := NewAuthManager(logger, &memAuthRepo{users: map[string]UserAuth{}}, NewEventBus(logger))
+
+	if err := am.AddUser("alice", testPassword); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	return am
+}
+
+func TestImportUsers(t *testing.T) {
+	am := newTestAuthManager(t)
+
+	users := []ImportUser{
+		{Row: 2, Username: "dave", Password: testPassword, Role: RoleReviewer, Expires: "2030-01-31"},
+		{Row: 3, Username: "erin", Password: testPassword, UploadWindows: []string{"mon-fri 08:00-18:00"}},
+		{Row: 4, Username: "alice", Password: testPassword},
+		{Row: 5, Username: "frank", Password: "frank"},
+		{Row: 6, Username: "dave", Password: testPassword},
+	}
+
+	rowErrors, err := am.ImportUsers(users, false)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if len(rowErrors) != 3 || rowErrors[0].Row != 4 || rowErrors[1].Row != 5 || rowErrors[2].Row != 6 {
+		t.Errorf("Unexpected row errors %+v", rowErrors)
+	}
+
+	if exists, _ := am.HasUsername("dave"); exists {
+		t.Error("Expected no users imported when a row is not valid")
+	}
+
+	users = users[:2]
+
+	if rowErrors, err := am.ImportUsers(users, true); err != nil || len(rowErrors) != 0 {
+		t.Fatal("Error while running test", rowErrors, err)
+	}
+
+	if exists, _ := am.HasUsername("dave"); exists {
+		t.Error("Expected no users imported on dry run")
+	}
+
+	if rowErrors, err := am.ImportUsers(users, false); err != nil || len(rowErrors) != 0 {
+		t.Fatal("Error while running test", rowErrors, err)
+	}
+
+	dave, _ := am.GetUserAuth("dave")
+	if dave == nil || dave.Role != RoleReviewer || dave.Expires.IsZero() {
+		t.Errorf("Unexpected imported user %+v", dave)
+	}
+
+	if erin, _ := am.GetUserAuth("erin"); erin == nil || len(erin.UploadWindows) != 1 {
+		t.Errorf("Unexpected imported user %+v", erin)
+	}
+
+	if ok, _ := am.CheckPassword("erin", testPassword); !ok {
+		t.Error("Expected imported user to log in")
+	}
+}
+
+type memAuthRepo struct {
+	users map[string]UserAuth
+}
+
+func (r *memAuthRepo) Create(u *UserAuth) error {
+	return r.Update(u)
+}
+
+func (r *memAuthRepo) CreateAll(users []*UserAuth) error {
+	for _, u := range users {
+		if _, ok := r.users[u.Username]; ok {
+			return ErrUsernameExists
+		}
+	}
+	for _, u := range users {
+		r.users[u.Username] = *u
+	}
+	return nil
+}
+
+func (r *memAuthRepo) Read(username string) (*UserAuth, error) {
+	u, ok := r.users[username]
+	if !ok {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func (r *memAuthRepo) Update(u *UserAuth) error {
+	r.users[u.Username] = *u
+	return nil
+}
+
+func (r *memAuthRepo) Delete(username string) error {
+	delete(r.users, username)
+	return nil
+}
+
+func (r *memAuthRepo) List() <-chan UserAuth {
+	out := make(chan UserAuth, len(r.users))
+	for _, u := range r.users {
+		out <- u
+	}
+	close(out)
+	return out
+}
@@ -0,0 +1,107 @@
+package application
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CollisionPolicy decides what happens when a client uploads a file under
+// the name of an already closed file.
+type CollisionPolicy string
+
+const (
+	// CollisionReject denies appending to closed files with ErrConflict.
+	CollisionReject CollisionPolicy = "reject"
+	// CollisionVersion starts a new version of the file, ie. "statement (2).mp4".
+	// Closed versions are retained.
+	CollisionVersion CollisionPolicy = "version"
+)
+
+// maxVersions guards against endless search for a free version name.
+const maxVersions = 10000
+
+func ParseCollisionPolicy(policy string) (CollisionPolicy, error) {
+	switch CollisionPolicy(policy) {
+	case "", CollisionReject:
+		return CollisionReject, nil
+	case CollisionVersion:
+		return CollisionVersion, nil
+	}
+
+	return "", fmt.Errorf("unknown collision policy %q", policy)
+}
+
+// VersionName returns name of the n-th version of the file, first version
+// keeps the original name.
+func VersionName(file string, n int) string {
+	if n <= 1 {
+		return file
+	}
+
+	ext := filepath.Ext(file)
+
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(file, ext), n, ext)
+}
+
+// nextVersionName returns the first version name not taken.
+func nextVersionName(file string, taken func(name string) (bool, error)) (string, error) {
+	for n := 1; n <= maxVersions; n++ {
+		name := VersionName(file, n)
+
+		exists, err := taken(name)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			return name, nil
+		}
+	}
+
+	return "", ErrConflict
+}
+
+// versionNumber returns which version of file name is, 0 if it is none.
+func versionNumber(file, name string) int {
+	if name == file {
+		return 1
+	}
+
+	ext := filepath.Ext(file)
+	number := strings.TrimPrefix(strings.TrimSuffix(name, ")"+ext), strings.TrimSuffix(file, ext)+" (")
+
+	n, err := strconv.Atoi(number)
+	if err != nil || VersionName(file, n) != name {
+		return 0
+	}
+
+	return n
+}
+
+// lastVersionName returns the closed version of file updated last, the
+// higher one on equal times. It is empty when no version is closed.
+func lastVersionName(files []FileInfo, file string) string {
+	var last *FileInfo
+
+	lastNumber := 0
+
+	for i := range files {
+		n := versionNumber(file, files[i].Name)
+		if n == 0 || !files[i].Closed {
+			continue
+		}
+
+		if last == nil || files[i].Updated.After(last.Updated) ||
+			files[i].Updated.Equal(last.Updated) && n > lastNumber {
+			last, lastNumber = &files[i], n
+		}
+	}
+
+	if last == nil {
+		return ""
+	}
+
+	return last.Name
+}
@@ -0,0 +1,322 @@
+package application
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	WebhookSignatureHeader = "X-Direct-Upload-Signature"
+	WebhookEventHeader     = "X-Direct-Upload-Event"
+	WebhookDeliveryHeader  = "X-Direct-Upload-Delivery"
+)
+
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+type WebhookConfig struct {
+	URL    string      `mapstructure:"url"`
+	Secret string      `mapstructure:"secret"`
+	Events []EventType `mapstructure:"events"`
+}
+
+type WebhookDispatcherConfig struct {
+	Webhooks     []WebhookConfig
+	MaxAttempts  int
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+// WebhookDelivery is a single event payload queued for a single webhook URL.
+// Secrets are never persisted, they are looked up from the config by URL when
+// the delivery is attempted.
+type WebhookDelivery struct {
+	ID          string
+	EventType   EventType
+	URL         string
+	Payload     []byte
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	Failed      bool
+	Created     time.Time
+}
+
+type WebhookRepository interface {
+	Save(d *WebhookDelivery) error
+	Read(id string) (*WebhookDelivery, error)
+	Delete(id string) error
+	List() <-chan WebhookDelivery
+}
+
+type WebhookDispatcher struct {
+	config WebhookDispatcherConfig
+	mu     sync.RWMutex
+	repo   WebhookRepository
+	client *http.Client
+	wake   chan struct{}
+	logger *zap.Logger
+}
+
+func NewWebhookDispatcher(config WebhookDispatcherConfig, repo WebhookRepository, logger *zap.Logger) *WebhookDispatcher {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	return &WebhookDispatcher{
+		config: config,
+		repo:   repo,
+		client: &http.Client{Timeout: config.Timeout},
+		wake:   make(chan struct{}, 1),
+		logger: logger,
+	}
+}
+
+// Handle queues the event for every webhook subscribed to its type.
+func (d *WebhookDispatcher) Handle(e Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		d.logger.Error("Error encoding event", zap.String("event", e.ID), zap.Error(err))
+		return
+	}
+
+	for _, hook := range d.webhooks() {
+		if !hook.subscribed(e.Type) {
+			continue
+		}
+
+		delivery := &WebhookDelivery{
+			ID:          uuid.New().String(),
+			EventType:   e.Type,
+			URL:         hook.URL,
+			Payload:     payload,
+			NextAttempt: time.Now(),
+			Created:     time.Now(),
+		}
+
+		err = d.repo.Save(delivery)
+		if err != nil {
+			d.logger.Error("Error queueing webhook delivery",
+				zap.String("url", hook.URL), zap.String("event", e.ID), zap.Error(err))
+		}
+	}
+
+	d.notify()
+}
+
+// Start delivers queued webhooks until the process exits.
+func (d *WebhookDispatcher) Start() {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue()
+
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *WebhookDispatcher) ListFailed() ([]WebhookDelivery, error) {
+	var failed []WebhookDelivery
+
+	for delivery := range d.repo.List() {
+		if delivery.Failed {
+			failed = append(failed, delivery)
+		}
+	}
+
+	return failed, nil
+}
+
+// Replay resets a delivery so it is attempted again right away.
+func (d *WebhookDispatcher) Replay(id string) error {
+	delivery, err := d.repo.Read(id)
+	if err != nil {
+		return err
+	}
+
+	if delivery == nil {
+		return ErrDeliveryNotFound
+	}
+
+	delivery.Failed = false
+	delivery.Attempts = 0
+	delivery.NextAttempt = time.Now()
+
+	err = d.repo.Save(delivery)
+	if err != nil {
+		return err
+	}
+
+	d.notify()
+
+	return nil
+}
+
+func (d *WebhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *WebhookDispatcher) deliverDue() {
+	var due []WebhookDelivery
+
+	now := time.Now()
+
+	for delivery := range d.repo.List() {
+		if !delivery.Failed && !delivery.NextAttempt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+
+	for i := range due {
+		d.attempt(&due[i])
+	}
+}
+
+func (d *WebhookDispatcher) attempt(delivery *WebhookDelivery) {
+	err := d.send(delivery)
+	if err == nil {
+		d.logger.Info("Webhook delivered",
+			zap.String("url", delivery.URL), zap.String("delivery", delivery.ID))
+
+		err = d.repo.Delete(delivery.ID)
+		if err != nil {
+			d.logger.Error("Error removing webhook delivery", zap.String("delivery", delivery.ID), zap.Error(err))
+		}
+
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	delivery.NextAttempt = time.Now().Add(backoff(delivery.Attempts))
+
+	if delivery.Attempts >= d.config.MaxAttempts {
+		delivery.Failed = true
+	}
+
+	d.logger.Warn("Webhook delivery failed",
+		zap.String("url", delivery.URL), zap.String("delivery", delivery.ID),
+		zap.Int("attempts", delivery.Attempts), zap.Bool("failed", delivery.Failed), zap.Error(err))
+
+	err = d.repo.Save(delivery)
+	if err != nil {
+		d.logger.Error("Error saving webhook delivery", zap.String("delivery", delivery.ID), zap.Error(err))
+	}
+}
+
+func (d *WebhookDispatcher) send(delivery *WebhookDelivery) error {
+	hook, ok := d.webhook(delivery.URL)
+	if !ok {
+		return errors.New("webhook no longer configured")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(delivery.EventType))
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(hook.Secret, delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// SetWebhooks replaces configured webhooks. Queued deliveries to removed
+// webhooks fail on their next attempt.
+func (d *WebhookDispatcher) SetWebhooks(webhooks []WebhookConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.config.Webhooks = webhooks
+}
+
+func (d *WebhookDispatcher) webhooks() []WebhookConfig {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.config.Webhooks
+}
+
+func (d *WebhookDispatcher) webhook(url string) (WebhookConfig, bool) {
+	for _, hook := range d.webhooks() {
+		if hook.URL == url {
+			return hook, true
+		}
+	}
+
+	return WebhookConfig{}, false
+}
+
+// SignWebhookPayload returns the signature header value, "sha256=" followed
+// by the hex encoded HMAC-SHA256 of the payload.
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c WebhookConfig) subscribed(t EventType) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+
+	for _, e := range c.Events {
+		if e == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func backoff(attempts int) time.Duration {
+	wait := 30 * time.Second
+
+	for i := 1; i < attempts && wait < time.Hour; i++ {
+		wait *= 2
+	}
+
+	if wait > time.Hour {
+		wait = time.Hour
+	}
+
+	return wait
+}
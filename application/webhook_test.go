@@ -0,0 +1,130 @@
+package application
+
+import (
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type memWebhookRepo struct {
+	mu         sync.Mutex
+	deliveries map[string]WebhookDelivery
+}
+
+func newMemWebhookRepo() *memWebhookRepo {
+	return &memWebhookRepo{deliveries: map[string]WebhookDelivery{}}
+}
+
+func (r *memWebhookRepo) Save(d *WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries[d.ID] = *d
+	return nil
+}
+
+func (r *memWebhookRepo) Read(id string) (*WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.deliveries[id]
+	if !ok {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+func (r *memWebhookRepo) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.deliveries, id)
+	return nil
+}
+
+func (r *memWebhookRepo) List() <-chan WebhookDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(chan WebhookDelivery, len(r.deliveries))
+	for _, d := range r.deliveries {
+		out <- d
+	}
+	close(out)
+	return out
+}
+
+func TestWebhookDispatcher_Deliver(t *testing.T) {
+	var signature string
+	var body []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(WebhookSignatureHeader)
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	repo := newMemWebhookRepo()
+	dispatcher := NewWebhookDispatcher(WebhookDispatcherConfig{
+		Webhooks: []WebhookConfig{{URL: srv.URL, Secret: "secret", Events: []EventType{EventFileClosed}}},
+	}, repo, zaptest.NewLogger(t))
+
+	bus := NewEventBus(zaptest.NewLogger(t))
+	bus.Subscribe(dispatcher.Handle)
+
+	// not subscribed
+	bus.Publish(Event{Type: EventUserCreated, Username: UsernameTest})
+	if len(repo.deliveries) != 0 {
+		t.Errorf("Unexpected delivery queued for unsubscribed event")
+	}
+
+	bus.Publish(Event{Type: EventFileClosed, Username: UsernameTest, File: "file"})
+	dispatcher.deliverDue()
+
+	if len(repo.deliveries) != 0 {
+		t.Errorf("Delivered webhook not removed from queue")
+	}
+
+	if signature != SignWebhookPayload("secret", body) {
+		t.Errorf("Bad signature: got %s", signature)
+	}
+}
+
+func TestWebhookDispatcher_FailAndReplay(t *testing.T) {
+	status := http.StatusInternalServerError
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	repo := newMemWebhookRepo()
+	dispatcher := NewWebhookDispatcher(WebhookDispatcherConfig{
+		Webhooks:    []WebhookConfig{{URL: srv.URL, Secret: "secret"}},
+		MaxAttempts: 1,
+	}, repo, zaptest.NewLogger(t))
+
+	dispatcher.Handle(Event{ID: "event", Type: EventFileDeleted, Username: UsernameTest})
+	dispatcher.deliverDue()
+
+	failed, _ := dispatcher.ListFailed()
+	if len(failed) != 1 {
+		t.Fatalf("Expected 1 failed delivery, got %d", len(failed))
+	}
+
+	status = http.StatusOK
+
+	err := dispatcher.Replay(failed[0].ID)
+	if err != nil {
+		t.Error("Error while running test", err)
+	}
+
+	dispatcher.deliverDue()
+
+	if len(repo.deliveries) != 0 {
+		t.Errorf("Replayed webhook not delivered")
+	}
+
+	if err := dispatcher.Replay("missing"); err != ErrDeliveryNotFound {
+		t.Errorf("Expected ErrDeliveryNotFound, got %v", err)
+	}
+}
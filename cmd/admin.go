@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/horizontal-org/direct-upload/server/http"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"strings"
+)
+
+// adminConfig returns config of admin REST API, tokens are read from
+// admin.tokens and admin.token-file, one token per line.
+func adminConfig() (http.AdminConfig, error) {
+	config := http.AdminConfig{
+		Address:        viper.GetString("admin.address"),
+		CertFile:       viper.GetString("admin.cert"),
+		PrivateKeyFile: viper.GetString("admin.key"),
+		Tokens:         viper.GetStringSlice("admin.tokens"),
+	}
+
+	if file := viper.GetString("admin.token-file"); file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return config, err
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if token := strings.TrimSpace(line); token != "" {
+				config.Tokens = append(config.Tokens, token)
+			}
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io"
+	"net/rpc"
+	"os"
+	"time"
+)
+
+const (
+	lastFlagName = "last"
+	fileFlagName = "file"
+	headFlagName = "head"
+
+	// auditExportPage limits entries fetched by a single call.
+	auditExportPage = 1000
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect and verify the tamper-evident audit log.",
+}
+
+var auditListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List audit log entries.",
+	Args:  cobra.ExactArgs(0),
+	RunE:  auditListCmdFunc,
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify audit log chain was not edited and print its head.",
+	Long: "Verify audit log chain was not edited and print its head.\n\n" +
+		"Keep the printed head hash outside of the server, later verification with --head proves no\n" +
+		"entry up to it was changed or removed. With --file, exported log is verified offline.",
+	Args: cobra.ExactArgs(0),
+	RunE: auditVerifyCmdFunc,
+}
+
+var auditExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the whole audit log as JSON lines, which can be verified offline.",
+	Args:  cobra.ExactArgs(0),
+	RunE:  auditExportCmdFunc,
+}
+
+func init() {
+	auditListCmd.Flags().Int(lastFlagName, 20, "number of the last entries, 0 for all")
+	auditVerifyCmd.Flags().String(fileFlagName, "", "verify exported log instead of the server's, \"-\" for stdin")
+	auditVerifyCmd.Flags().String(headFlagName, "", "hash of previously verified head which must be in the chain")
+
+	auditCmd.AddCommand(auditListCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+	auditCmd.AddCommand(auditExportCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+//noinspection GoUnusedParameter
+func auditListCmdFunc(cmd *cobra.Command, args []string) error {
+	last, _ := cmd.Flags().GetInt(lastFlagName)
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		listRequest := &rpcSrv.AuditListRequest{From: 1, Last: last}
+
+		var reply []application.AuditEntry
+
+		logger.Debug("Calling RpcServer.ListAudit", zap.Int("last", last))
+
+		err := client.Call("RpcServer.ListAudit", listRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range reply {
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\n",
+				e.Seq, e.Time.Local().Format(time.RFC3339), e.Actor, e.Action, e.Subject, e.Detail)
+		}
+
+		return nil
+	})
+}
+
+//noinspection GoUnusedParameter
+func auditVerifyCmdFunc(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString(fileFlagName)
+	head, _ := cmd.Flags().GetString(headFlagName)
+
+	if file != "" {
+		return verifyAuditFile(file, head)
+	}
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply rpcSrv.AuditVerifyReply
+
+		logger.Debug("Calling RpcServer.VerifyAudit")
+
+		err := client.Call("RpcServer.VerifyAudit", &rpcSrv.Request{}, &reply)
+		if err != nil {
+			return err
+		}
+
+		if reply.Error != "" {
+			return fmt.Errorf("audit log chain broken: %s", reply.Error)
+		}
+
+		if head != "" {
+			// entries up to the chain head were verified, the anchored one
+			// must be among them
+			found := false
+
+			err := eachAuditEntry(logger, client, func(e application.AuditEntry) error {
+				found = found || e.Hash == head
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if !found {
+				return fmt.Errorf("audit log chain broken: head %s not found", head)
+			}
+		}
+
+		printAuditHead(reply.Head)
+
+		return nil
+	})
+}
+
+// verifyAuditFile verifies audit log exported to file, "-" for stdin.
+func verifyAuditFile(path, head string) error {
+	var in io.Reader = os.Stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		//noinspection GoUnhandledErrorResult
+		defer f.Close()
+
+		in = f
+	}
+
+	var chain application.AuditChain
+	found := false
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var entry application.AuditEntry
+
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return fmt.Errorf("%s: line %d: %v", path, line, err)
+		}
+
+		err = chain.Append(entry)
+		if err != nil {
+			return fmt.Errorf("audit log chain broken: %v", err)
+		}
+
+		found = found || entry.Hash == head
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if head != "" && !found {
+		return fmt.Errorf("audit log chain broken: head %s not found", head)
+	}
+
+	printAuditHead(chain.Head)
+
+	return nil
+}
+
+func printAuditHead(head *application.AuditEntry) {
+	if head == nil {
+		fmt.Println("audit log is empty")
+		return
+	}
+
+	fmt.Printf("verified: %d entries\n", head.Seq)
+	fmt.Printf("head:     %s\n", head.Hash)
+	fmt.Printf("time:     %s\n", head.Time.Local().Format(time.RFC3339))
+}
+
+//noinspection GoUnusedParameter
+func auditExportCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		out := bufio.NewWriter(os.Stdout)
+		encoder := json.NewEncoder(out)
+
+		err := eachAuditEntry(logger, client, func(e application.AuditEntry) error {
+			return encoder.Encode(e)
+		})
+		if err != nil {
+			return err
+		}
+
+		return out.Flush()
+	})
+}
+
+// eachAuditEntry calls fn for all entries in order, fetching them in pages.
+func eachAuditEntry(logger *zap.Logger, client *rpc.Client, fn func(e application.AuditEntry) error) error {
+	from := uint64(1)
+
+	for {
+		var reply []application.AuditEntry
+
+		logger.Debug("Calling RpcServer.ListAudit", zap.Uint64("from", from))
+
+		err := client.Call("RpcServer.ListAudit", &rpcSrv.AuditListRequest{From: from, Limit: auditExportPage}, &reply)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range reply {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+
+		if len(reply) < auditExportPage {
+			return nil
+		}
+
+		from = reply[len(reply)-1].Seq + 1
+	}
+}
@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"github.com/horizontal-org/direct-upload/application"
 	logger2 "github.com/horizontal-org/direct-upload/logger"
 	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"io/ioutil"
+	"math"
 	"net/rpc"
+	"os"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
 type consumer func(logger *zap.Logger, client *rpc.Client) error
@@ -22,7 +31,7 @@ var authCmd = &cobra.Command{
 
 var authAddCmd = &cobra.Command{
 	Use:   "add <username>",
-	Short: "Add user authentication if doesn't already exists. Will prompt for password.",
+	Short: "Add user authentication if doesn't already exists. Will prompt for password unless generated or read from stdin or file.",
 	Args:  cobra.ExactArgs(1),
 	RunE:  authAddCmdFunc,
 }
@@ -36,11 +45,53 @@ var authDelCmd = &cobra.Command{
 
 var authChangePassCmd = &cobra.Command{
 	Use:   "passwd <username>",
-	Short: "Change user authentication. Will prompt for password.",
+	Short: "Change user authentication. Will prompt for password unless generated or read from stdin or file.",
 	Args:  cobra.ExactArgs(1),
 	RunE:  authPasswdCmdFunc,
 }
 
+var authRoleCmd = &cobra.Command{
+	Use:   "role <username> <role>",
+	Short: "Change user role: uploader, reviewer or admin.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  authRoleCmdFunc,
+}
+
+var authDisableCmd = &cobra.Command{
+	Use:   "disable <username>",
+	Short: "Suspend user account, its files are kept.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  authDisableCmdFunc,
+}
+
+var authEnableCmd = &cobra.Command{
+	Use:   "enable <username>",
+	Short: "Restore suspended user account.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  authEnableCmdFunc,
+}
+
+var authExpireCmd = &cobra.Command{
+	Use:   "expire <username> <YYYY-MM-DD|RFC 3339 time|never>",
+	Short: "Set when user account expires, a date is the last day of access.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  authExpireCmdFunc,
+}
+
+var authWindowCmd = &cobra.Command{
+	Use:   "window <username> [\"[<days>] HH:MM-HH:MM\"...]",
+	Short: "Limit when user may upload, ie. \"mon-fri 08:00-18:00\". Without windows any time is allowed.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  authWindowCmdFunc,
+}
+
+var authShowCmd = &cobra.Command{
+	Use:   "show <username>",
+	Short: "Show user role and account restrictions.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  authShowCmdFunc,
+}
+
 var authListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List usernames.",
@@ -57,12 +108,34 @@ var authBackupCmd = &cobra.Command{
 
 var errUsernameNotValid = errors.New("username not valid")
 var errUsernameExists = errors.New("username exists")
+var errPasswordEmpty = errors.New("password is empty")
+var errPasswordSources = errors.New("use only one of --generate, --password-stdin and --password-file")
+
+const (
+	generateFlagName      = "generate"
+	passwordStdinFlagName = "password-stdin"
+	passwordFileFlagName  = "password-file"
+	passwordPolicyKey     = "password-policy"
+	passwordHashKey       = "password-hash"
+)
 
 //noinspection GoUnhandledErrorResult
 func init() {
+	for _, c := range []*cobra.Command{authAddCmd, authChangePassCmd} {
+		c.Flags().Bool(generateFlagName, false, "generate strong passphrase and print it once instead of prompting")
+		c.Flags().Bool(passwordStdinFlagName, false, "read password from the first line of stdin")
+		c.Flags().String(passwordFileFlagName, "", "read password from the first line of file")
+	}
+
 	authCmd.AddCommand(authAddCmd)
 	authCmd.AddCommand(authDelCmd)
 	authCmd.AddCommand(authChangePassCmd)
+	authCmd.AddCommand(authRoleCmd)
+	authCmd.AddCommand(authDisableCmd)
+	authCmd.AddCommand(authEnableCmd)
+	authCmd.AddCommand(authExpireCmd)
+	authCmd.AddCommand(authWindowCmd)
+	authCmd.AddCommand(authShowCmd)
 	authCmd.AddCommand(authListCmd)
 	authCmd.AddCommand(authBackupCmd)
 	rootCmd.AddCommand(authCmd)
@@ -94,15 +167,11 @@ func authAddCmdFunc(cmd *cobra.Command, args []string) error {
 			return errUsernameExists
 		}
 
-		password, err := readPassword()
+		password, generated, err := newPassword(cmd)
 		if err != nil {
 			return err
 		}
 
-		if password == "" {
-			return nil
-		}
-
 		addRequest := &rpcSrv.AddAuthRequest{
 			Username: username,
 			Password: password,
@@ -118,6 +187,10 @@ func authAddCmdFunc(cmd *cobra.Command, args []string) error {
 			return nil
 		}
 
+		if err == nil && generated {
+			printGeneratedPassword(username, password)
+		}
+
 		return err
 	})
 }
@@ -152,15 +225,11 @@ func authPasswdCmdFunc(cmd *cobra.Command, args []string) error {
 			return errUsernameNotValid
 		}
 
-		password, err := readPassword()
+		password, generated, err := newPassword(cmd)
 		if err != nil {
 			return err
 		}
 
-		if password == "" {
-			return nil
-		}
-
 		setRequest := &rpcSrv.SetAuthRequest{
 			Username: username,
 			Password: password,
@@ -170,7 +239,135 @@ func authPasswdCmdFunc(cmd *cobra.Command, args []string) error {
 
 		logger.Debug("Calling RpcServer.SetAuth", zap.String("username", setRequest.Username))
 
-		return client.Call("RpcServer.SetAuth", setRequest, &reply)
+		err = client.Call("RpcServer.SetAuth", setRequest, &reply)
+		if err == nil && generated {
+			printGeneratedPassword(username, password)
+		}
+
+		return err
+	})
+}
+
+//noinspection GoUnusedParameter
+func authRoleCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		username, role := args[0], args[1]
+
+		if !application.ValidUsername(username) {
+			return errUsernameNotValid
+		}
+
+		if !application.ValidRole(role) {
+			return application.ErrRoleNotValid
+		}
+
+		roleRequest := &rpcSrv.RoleRequest{
+			Username: username,
+			Role:     role,
+		}
+
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.SetRole", zap.String("username", roleRequest.Username))
+
+		return client.Call("RpcServer.SetRole", roleRequest, &reply)
+	})
+}
+
+//noinspection GoUnusedParameter
+func authDisableCmdFunc(cmd *cobra.Command, args []string) error {
+	return setDisabled(cmd, args[0], true)
+}
+
+//noinspection GoUnusedParameter
+func authEnableCmdFunc(cmd *cobra.Command, args []string) error {
+	return setDisabled(cmd, args[0], false)
+}
+
+func setDisabled(cmd *cobra.Command, username string, disabled bool) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		if !application.ValidUsername(username) {
+			return errUsernameNotValid
+		}
+
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.SetDisabled", zap.String("username", username), zap.Bool("disabled", disabled))
+
+		return client.Call("RpcServer.SetDisabled", &rpcSrv.DisabledRequest{Username: username, Disabled: disabled}, &reply)
+	})
+}
+
+//noinspection GoUnusedParameter
+func authExpireCmdFunc(cmd *cobra.Command, args []string) error {
+	expires, err := application.ParseExpiry(args[1])
+	if err != nil {
+		return err
+	}
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		if !application.ValidUsername(args[0]) {
+			return errUsernameNotValid
+		}
+
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.SetExpiry", zap.String("username", args[0]), zap.Time("expires", expires))
+
+		return client.Call("RpcServer.SetExpiry", &rpcSrv.ExpiryRequest{Username: args[0], Expires: expires}, &reply)
+	})
+}
+
+//noinspection GoUnusedParameter
+func authWindowCmdFunc(cmd *cobra.Command, args []string) error {
+	windows := args[1:]
+
+	for _, window := range windows {
+		if _, err := application.ParseUploadWindow(window); err != nil {
+			return err
+		}
+	}
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		if !application.ValidUsername(args[0]) {
+			return errUsernameNotValid
+		}
+
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.SetUploadWindows", zap.String("username", args[0]), zap.Strings("windows", windows))
+
+		return client.Call("RpcServer.SetUploadWindows",
+			&rpcSrv.UploadWindowsRequest{Username: args[0], Windows: windows}, &reply)
+	})
+}
+
+//noinspection GoUnusedParameter
+func authShowCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply rpcSrv.UserInfo
+
+		logger.Debug("Calling RpcServer.GetUser", zap.String("username", args[0]))
+
+		err := client.Call("RpcServer.GetUser", &rpcSrv.UsernameRequest{Username: args[0]}, &reply)
+		if err != nil {
+			return err
+		}
+
+		expires := "never"
+		if !reply.Expires.IsZero() {
+			expires = reply.Expires.Local().Format(time.RFC3339)
+		}
+
+		windows := "any time"
+		if len(reply.UploadWindows) > 0 {
+			windows = strings.Join(reply.UploadWindows, ", ")
+		}
+
+		fmt.Printf("username: %s\nrole: %s\ndisabled: %t\nexpires: %s\nupload windows: %s\n",
+			reply.Username, reply.Role, reply.Disabled, expires, windows)
+
+		return nil
 	})
 }
 
@@ -216,14 +413,14 @@ func with(cmd *cobra.Command, fn consumer) error {
 	//goland:noinspection GoUnhandledErrorResult
 	defer logger.Sync()
 
-	rpcAddress, err := cmd.Flags().GetString(rpcFlagName)
+	config, err := rpcConfig()
 	if err != nil {
 		return err
 	}
 
-	logger.Debug("Connecting to rpc server", zap.String("address", rpcAddress))
+	logger.Debug("Connecting to rpc server", zap.String("address", config.Path))
 
-	rcpClient, err := rpc.Dial("tcp", rpcAddress)
+	rcpClient, err := rpcSrv.Dial(config)
 	if err != nil {
 		logger.Fatal("Unable to create rpc client", zap.Error(err))
 	}
@@ -231,6 +428,109 @@ func with(cmd *cobra.Command, fn consumer) error {
 	return fn(logger, rcpClient)
 }
 
+// rpcConfig returns rpc transport settings shared by the server and CLI
+// commands, which read the same config file.
+func rpcConfig() (rpcSrv.Config, error) {
+	config := rpcSrv.Config{
+		Path:   viper.GetString(rpcFlagName),
+		Secret: viper.GetString("rpc-auth.secret"),
+		TLS: &rpcSrv.TLSConfig{
+			CertFile:       viper.GetString("rpc-auth.cert"),
+			KeyFile:        viper.GetString("rpc-auth.key"),
+			ClientCAFile:   viper.GetString("rpc-auth.client-ca"),
+			CAFile:         viper.GetString("rpc-auth.ca"),
+			ClientCertFile: viper.GetString("rpc-auth.client-cert"),
+			ClientKeyFile:  viper.GetString("rpc-auth.client-key"),
+			ServerName:     viper.GetString("rpc-auth.server-name"),
+		},
+	}
+
+	if file := viper.GetString("rpc-auth.secret-file"); file != "" {
+		secret, err := ioutil.ReadFile(file)
+		if err != nil {
+			return config, err
+		}
+
+		config.Secret = strings.TrimSpace(string(secret))
+	}
+
+	if mode := viper.GetString("rpc-socket-mode"); mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || perm > 0777 {
+			return config, fmt.Errorf("rpc-socket-mode: %q is not octal file mode", mode)
+		}
+
+		config.SocketMode = os.FileMode(perm)
+	}
+
+	return config, nil
+}
+
+// newPassword generates passphrase when asked to, reads password from stdin
+// or file, or prompts for it.
+func newPassword(cmd *cobra.Command) (password string, generated bool, err error) {
+	generate, _ := cmd.Flags().GetBool(generateFlagName)
+	fromStdin, _ := cmd.Flags().GetBool(passwordStdinFlagName)
+	file, _ := cmd.Flags().GetString(passwordFileFlagName)
+
+	sources := 0
+	for _, set := range []bool{generate, fromStdin, file != ""} {
+		if set {
+			sources++
+		}
+	}
+
+	if sources > 1 {
+		return "", false, errPasswordSources
+	}
+
+	switch {
+	case generate:
+		password, err = application.GeneratePassphrase()
+		return password, true, err
+	case fromStdin:
+		password, err = readPasswordLine(os.Stdin)
+	case file != "":
+		password, err = readPasswordFile(file)
+	default:
+		password, err = readPassword()
+	}
+
+	if err == nil && password == "" {
+		err = errPasswordEmpty
+	}
+
+	return password, false, err
+}
+
+// readPasswordLine returns the first line, so passwords can be piped from
+// secret managers.
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readPasswordFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	return readPasswordLine(f)
+}
+
+// printGeneratedPassword shows generated passphrase, it's not stored anywhere
+// else so it can't be shown again.
+func printGeneratedPassword(username, password string) {
+	fmt.Printf("Generated password for %s, hand it over now, it won't be shown again:\n%s\n", username, password)
+}
+
 func readPassword() (string, error) {
 	fmt.Print("Password: ")
 
@@ -243,3 +543,73 @@ func readPassword() (string, error) {
 
 	return string(bytes), nil
 }
+
+// passwordPolicy reads password-policy settings, unset ones keep defaults.
+func passwordPolicy(v *viper.Viper) (application.PasswordPolicy, error) {
+	policy := application.DefaultPasswordPolicy()
+
+	if v.IsSet(passwordPolicyKey + ".min-length") {
+		policy.MinLength = v.GetInt(passwordPolicyKey + ".min-length")
+	}
+
+	if v.IsSet(passwordPolicyKey + ".reject-common") {
+		policy.RejectCommon = v.GetBool(passwordPolicyKey + ".reject-common")
+	}
+
+	if policy.MinLength < 1 {
+		return policy, fmt.Errorf("%s.min-length: must be at least 1", passwordPolicyKey)
+	}
+
+	if file := v.GetString(passwordPolicyKey + ".common-file"); file != "" {
+		common, err := application.LoadCommonPasswords(file)
+		if err != nil {
+			return policy, fmt.Errorf("%s.common-file: %v", passwordPolicyKey, err)
+		}
+
+		policy.Common = common
+	}
+
+	return policy, nil
+}
+
+// passwordHasher reads password-hash settings, unset ones keep defaults.
+func passwordHasher(v *viper.Viper) (application.PasswordHasher, error) {
+	cfg := application.DefaultPasswordHashConfig()
+
+	if v.IsSet(passwordHashKey + ".algorithm") {
+		cfg.Algorithm = v.GetString(passwordHashKey + ".algorithm")
+	}
+
+	if v.IsSet(passwordHashKey + ".cost") {
+		cfg.Cost = v.GetInt(passwordHashKey + ".cost")
+	}
+
+	for _, param := range []string{"memory", "iterations", "parallelism"} {
+		if value := v.GetInt(passwordHashKey + "." + param); value < 0 || int64(value) > math.MaxUint32 {
+			return nil, fmt.Errorf("%s.%s: %d is out of range", passwordHashKey, param, value)
+		}
+	}
+
+	if v.IsSet(passwordHashKey + ".memory") {
+		cfg.Memory = uint32(v.GetInt(passwordHashKey + ".memory"))
+	}
+
+	if v.IsSet(passwordHashKey + ".iterations") {
+		cfg.Iterations = uint32(v.GetInt(passwordHashKey + ".iterations"))
+	}
+
+	if v.IsSet(passwordHashKey + ".parallelism") {
+		if v.GetInt(passwordHashKey+".parallelism") > math.MaxUint8 {
+			return nil, fmt.Errorf("%s.parallelism: at most %d", passwordHashKey, math.MaxUint8)
+		}
+
+		cfg.Parallelism = uint8(v.GetInt(passwordHashKey + ".parallelism"))
+	}
+
+	hasher, err := application.NewPasswordHasher(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", passwordHashKey, err)
+	}
+
+	return hasher, nil
+}
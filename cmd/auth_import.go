@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io"
+	"net/rpc"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dryRunFlagName        = "dry-run"
+	includeHashesFlagName = "include-hashes"
+
+	// uploadWindowsSeparator joins upload windows in a CSV column.
+	uploadWindowsSeparator = ";"
+)
+
+// Columns of imported and exported CSV files.
+const (
+	columnUsername      = "username"
+	columnPassword      = "password"
+	columnRole          = "role"
+	columnDisabled      = "disabled"
+	columnExpires       = "expires"
+	columnUploadWindows = "upload_windows"
+	columnPasswordHash  = "password_hash"
+)
+
+var importColumns = []string{
+	columnUsername, columnPassword, columnRole, columnDisabled, columnExpires, columnUploadWindows,
+}
+
+var authImportCmd = &cobra.Command{
+	Use:   "import <csv file|->",
+	Short: "Create users from CSV file with header, all of them or none if any row is not valid.",
+	Long: "Create users from CSV file with header, all of them or none if any row is not valid.\n\n" +
+		"Columns are username, password, role, disabled, expires and upload_windows, only username is\n" +
+		"required. Multiple upload windows are separated by \";\".",
+	Args: cobra.ExactArgs(1),
+	RunE: authImportCmdFunc,
+}
+
+var authExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print users and their restrictions as CSV, which can be imported again.",
+	Args:  cobra.ExactArgs(0),
+	RunE:  authExportCmdFunc,
+}
+
+func init() {
+	authImportCmd.Flags().Bool(dryRunFlagName, false, "only check rows, create no users")
+	authImportCmd.Flags().Bool(generateFlagName, false,
+		"generate passphrases for rows without password and print them once")
+	authExportCmd.Flags().Bool(includeHashesFlagName, false, "include password hashes, keep the output secret")
+
+	authCmd.AddCommand(authImportCmd)
+	authCmd.AddCommand(authExportCmd)
+}
+
+//noinspection GoUnusedParameter
+func authImportCmdFunc(cmd *cobra.Command, args []string) error {
+	dryRun, _ := cmd.Flags().GetBool(dryRunFlagName)
+	generate, _ := cmd.Flags().GetBool(generateFlagName)
+
+	users, err := readImportFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	generated := map[string]bool{}
+
+	if generate {
+		for i := range users {
+			if users[i].Password != "" {
+				continue
+			}
+
+			users[i].Password, err = application.GeneratePassphrase()
+			if err != nil {
+				return err
+			}
+
+			generated[users[i].Username] = true
+		}
+	}
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply rpcSrv.ImportUsersReply
+
+		logger.Debug("Calling RpcServer.ImportUsers", zap.Int("users", len(users)), zap.Bool("dry_run", dryRun))
+
+		err := client.Call("RpcServer.ImportUsers", &rpcSrv.ImportUsersRequest{Users: users, DryRun: dryRun}, &reply)
+		if err != nil {
+			return err
+		}
+
+		printRowErrors(os.Stderr, reply.Errors)
+
+		if len(reply.Errors) > 0 {
+			return fmt.Errorf("%d of %d rows not valid, no users imported", len(reply.Errors), len(users))
+		}
+
+		if dryRun {
+			fmt.Printf("%d users can be imported\n", len(users))
+			return nil
+		}
+
+		if len(generated) > 0 {
+			w := csv.NewWriter(os.Stdout)
+			_ = w.Write([]string{columnUsername, columnPassword})
+
+			for _, user := range users {
+				if generated[user.Username] {
+					_ = w.Write([]string{user.Username, user.Password})
+				}
+			}
+
+			w.Flush()
+
+			if err := w.Error(); err != nil {
+				return err
+			}
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "%d users imported\n", len(users))
+
+		return nil
+	})
+}
+
+// readImportFile reads users from CSV file, "-" for stdin. Rows are numbered
+// by their line in the file.
+func readImportFile(path string) ([]application.ImportUser, error) {
+	var in io.Reader = os.Stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		//noinspection GoUnhandledErrorResult
+		defer f.Close()
+
+		in = f
+	}
+
+	reader := csv.NewReader(in)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: can't read header: %v", path, err)
+	}
+
+	columns := map[string]int{}
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !contains(importColumns, name) {
+			return nil, fmt.Errorf("%s: unknown column %q, use %s", path, name, strings.Join(importColumns, ", "))
+		}
+
+		columns[name] = i
+	}
+
+	if _, ok := columns[columnUsername]; !ok {
+		return nil, fmt.Errorf("%s: %s column is required", path, columnUsername)
+	}
+
+	var users []application.ImportUser
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+
+			return ""
+		}
+
+		user := application.ImportUser{
+			Row:      line,
+			Username: value(columnUsername),
+			Role:     value(columnRole),
+			Expires:  value(columnExpires),
+		}
+
+		// passwords are taken as they are, spaces included
+		if i, ok := columns[columnPassword]; ok {
+			user.Password = record[i]
+		}
+
+		if disabled := value(columnDisabled); disabled != "" {
+			user.Disabled, err = strconv.ParseBool(disabled)
+			if err != nil {
+				return nil, fmt.Errorf("%s: line %d: %s %q is not true or false", path, line, columnDisabled, disabled)
+			}
+		}
+
+		for _, window := range strings.Split(value(columnUploadWindows), uploadWindowsSeparator) {
+			if window = strings.TrimSpace(window); window != "" {
+				user.UploadWindows = append(user.UploadWindows, window)
+			}
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// printRowErrors reports rows not valid by their line in the imported file.
+func printRowErrors(w io.Writer, rowErrors []application.ImportRowError) {
+	for _, rowError := range rowErrors {
+		_, _ = fmt.Fprintf(w, "line %d (%s): %s\n", rowError.Row, rowError.Username, rowError.Error)
+	}
+}
+
+//noinspection GoUnusedParameter
+func authExportCmdFunc(cmd *cobra.Command, args []string) error {
+	includeHashes, _ := cmd.Flags().GetBool(includeHashesFlagName)
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply []rpcSrv.UserInfo
+
+		logger.Debug("Calling RpcServer.ExportUsers", zap.Bool("include_hashes", includeHashes))
+
+		err := client.Call("RpcServer.ExportUsers", &rpcSrv.ExportUsersRequest{IncludeHashes: includeHashes}, &reply)
+		if err != nil {
+			return err
+		}
+
+		header := []string{columnUsername, columnRole, columnDisabled, columnExpires, columnUploadWindows}
+		if includeHashes {
+			header = append(header, columnPasswordHash)
+		}
+
+		w := csv.NewWriter(os.Stdout)
+		_ = w.Write(header)
+
+		for _, user := range reply {
+			expires := ""
+			if !user.Expires.IsZero() {
+				expires = user.Expires.Local().Format(time.RFC3339)
+			}
+
+			record := []string{
+				user.Username,
+				user.Role,
+				strconv.FormatBool(user.Disabled),
+				expires,
+				strings.Join(user.UploadWindows, uploadWindowsSeparator),
+			}
+
+			if includeHashes {
+				record = append(record, user.PasswordHash)
+			}
+
+			_ = w.Write(record)
+		}
+
+		w.Flush()
+
+		return w.Error()
+	})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
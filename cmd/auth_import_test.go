@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"github.com/horizontal-org/direct-upload/application"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeImportFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "direct-upload-import")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "users.csv")
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	return path
+}
+
+func TestReadImportFile(t *testing.T) {
+	path := writeImportFile(t, ""+
+		" Username ,password,role,disabled,expires,upload_windows\n"+
+		"dave, secret with spaces ,reviewer,true,2030-01-31,mon-fri 08:00-18:00; sat 10:00-12:00\n"+
+		"\"erin\",\"multi\nline\",,,,\n"+
+		"frank,,,,,\n")
+
+	users, err := readImportFile(path)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	expected := []application.ImportUser{
+		{
+			Row: 2, Username: "dave", Password: " secret with spaces ", Role: "reviewer", Disabled: true,
+			Expires: "2030-01-31", UploadWindows: []string{"mon-fri 08:00-18:00", "sat 10:00-12:00"},
+		},
+		{Row: 3, Username: "erin", Password: "multi\nline"},
+		// rows are numbered by line, erin spans two of them
+		{Row: 5, Username: "frank"},
+	}
+
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, users)
+	}
+}
+
+func TestReadImportFileNotValid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown column":   "username,email\ndave,dave@example.org\n",
+		"missing username": "password\nsecret\n",
+		"disabled":         "username,disabled\ndave,maybe\n",
+		"empty":            "",
+	} {
+		if _, err := readImportFile(writeImportFile(t, content)); err == nil {
+			t.Errorf("Expected %s refused", name)
+		}
+	}
+}
+
+func TestPrintRowErrors(t *testing.T) {
+	var out bytes.Buffer
+
+	printRowErrors(&out, []application.ImportRowError{
+		{Row: 4, Username: "alice", Error: application.ErrUsernameExists.Error()},
+		{Row: 5, Username: "frank", Error: "password too short"},
+	})
+
+	expected := "line 4 (alice): " + application.ErrUsernameExists.Error() + "\n" +
+		"line 5 (frank): password too short\n"
+
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
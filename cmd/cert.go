@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/horizontal-org/direct-upload/db"
+	"github.com/horizontal-org/direct-upload/repository"
+	"github.com/horizontal-org/direct-upload/server/http"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	daysFlagName = "days"
+	outFlagName  = "out"
+)
+
+var certCmd = &cobra.Command{
+	Use:   "cert",
+	Short: "Manage device client certificates.",
+}
+
+var certIssueCmd = &cobra.Command{
+	Use:   "issue <username> <device>",
+	Short: "Issue client certificate for user's device, writes <username>-<device>.crt and .key files.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  certIssueCmdFunc,
+}
+
+var certListCmd = &cobra.Command{
+	Use:   "list [username]",
+	Short: "List issued device certificates.",
+	Args:  cobra.RangeArgs(0, 1),
+	RunE:  certListCmdFunc,
+}
+
+var certRevokeCmd = &cobra.Command{
+	Use:   "revoke <serial>",
+	Short: "Revoke device certificate, it is rejected on the next connection.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  certRevokeCmdFunc,
+}
+
+func init() {
+	certIssueCmd.Flags().Int(daysFlagName, 0, "days of validity, defaults to mtls.days")
+	certIssueCmd.Flags().String(outFlagName, ".", "directory to write certificate and key to")
+
+	certCmd.AddCommand(certIssueCmd)
+	certCmd.AddCommand(certListCmd)
+	certCmd.AddCommand(certRevokeCmd)
+	rootCmd.AddCommand(certCmd)
+}
+
+//noinspection GoUnusedParameter
+func certIssueCmdFunc(cmd *cobra.Command, args []string) error {
+	days, _ := cmd.Flags().GetInt(daysFlagName)
+	out, _ := cmd.Flags().GetString(outFlagName)
+
+	base := filepath.Join(out, args[0]+"-"+args[1])
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		issueRequest := &rpcSrv.IssueCertificateRequest{
+			Username: args[0],
+			Device:   args[1],
+			Days:     days,
+		}
+
+		var reply application.IssuedCertificate
+
+		logger.Debug("Calling RpcServer.IssueCertificate")
+
+		err := client.Call("RpcServer.IssueCertificate", issueRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		err = writeNewFile(base+".key", reply.KeyPEM, 0600)
+		if err != nil {
+			return err
+		}
+
+		err = writeNewFile(base+".crt", reply.CertPEM, 0644)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("serial:  %s\n", reply.Serial)
+		fmt.Printf("expires: %s\n", reply.NotAfter.Format(time.RFC3339))
+		fmt.Printf("written: %s.crt, %s.key\n", base, base)
+
+		return nil
+	})
+}
+
+// writeNewFile doesn't overwrite existing files, like keys of other devices.
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+//noinspection GoUnusedParameter
+func certListCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		listRequest := &rpcSrv.UsernameRequest{}
+		if len(args) == 1 {
+			listRequest.Username = args[0]
+		}
+
+		var reply []application.DeviceCertificate
+
+		logger.Debug("Calling RpcServer.ListCertificates")
+
+		err := client.Call("RpcServer.ListCertificates", listRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		for _, cert := range reply {
+			state := "valid"
+			if !cert.Revoked.IsZero() {
+				state = "revoked " + cert.Revoked.Format(time.RFC3339)
+			} else if cert.NotAfter.Before(time.Now()) {
+				state = "expired"
+			}
+
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+				cert.Serial, cert.Username, cert.Device, cert.NotAfter.Format(time.RFC3339), state)
+		}
+
+		return w.Flush()
+	})
+}
+
+//noinspection GoUnusedParameter
+func certRevokeCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		revokeRequest := &rpcSrv.SerialRequest{
+			Serial: args[0],
+		}
+
+		var reply application.DeviceCertificate
+
+		logger.Debug("Calling RpcServer.RevokeCertificate")
+
+		err := client.Call("RpcServer.RevokeCertificate", revokeRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("revoked: %s (%s, %s)\n", reply.Serial, reply.Username, reply.Device)
+
+		return nil
+	})
+}
+
+// newClientAuth returns client certificate config, with device CA managed by
+// the server trusted in addition to configured CAs. Device CA is nil when
+// client certificates are disabled.
+func newClientAuth(conn *db.BoltConnection, logger *zap.Logger) (*http.ClientAuthConfig, *application.DeviceCA, error) {
+	clientAuth := &http.ClientAuthConfig{
+		Mode:         viper.GetString("mtls.mode"),
+		UsernameFrom: viper.GetString("mtls.username"),
+	}
+
+	err := clientAuth.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if clientAuth.Mode == "" || clientAuth.Mode == http.ClientAuthOff {
+		return clientAuth, nil, nil
+	}
+
+	repo, err := repository.NewDeviceCertRepo(repository.DeviceCertRepoConfig{
+		DB: conn.GetDB(),
+	}, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deviceCA, err := application.NewDeviceCA(application.DeviceCAConfig{
+		Dir:      viper.GetString("mtls.ca"),
+		Validity: time.Duration(viper.GetInt("mtls.days")) * 24 * time.Hour,
+	}, repo, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientAuth.CAFiles = append([]string{deviceCA.CertFile()}, viper.GetStringSlice("mtls.client-ca")...)
+	clientAuth.CRLFiles = append([]string{deviceCA.CRLFile()}, viper.GetStringSlice("mtls.crl")...)
+
+	return clientAuth, deviceCA, nil
+}
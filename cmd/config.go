@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	logger2 "github.com/horizontal-org/direct-upload/logger"
+	"github.com/horizontal-org/direct-upload/server/http"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"net/rpc"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// liveSettings are applied by config reload.
+var liveSettings = []string{
+	verboseFlagName, certFlagName, keyFlagName, webhooksKey, "processing.retries", "processing.retry-delay",
+	passwordPolicyKey, passwordHashKey,
+}
+
+// restartSettings are read once on start, changing them needs restart.
+var restartSettings = []string{
+	addressFlagName, databaseFlagName, filesFlagName, rpcFlagName, storageFlagName,
+	"s3", collisionKey, dedupeKey, "compression", "processing.workers", "processing.queue-size", "processing.hooks",
+	"antivirus", "timestamp", "acme", "mtls", "rpc-auth", "rpc-socket-mode", "admin",
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage configuration of running server.",
+}
+
+var configReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload config.yaml, same as sending SIGHUP to the server.",
+	Args:  cobra.NoArgs,
+	RunE:  configReloadCmdFunc,
+}
+
+func init() {
+	configCmd.AddCommand(configReloadCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+//noinspection GoUnusedParameter
+func configReloadCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply rpcSrv.ReloadReport
+
+		logger.Debug("Calling RpcServer.ReloadConfig")
+
+		err := client.Call("RpcServer.ReloadConfig", &rpcSrv.Request{}, &reply)
+		if err != nil {
+			return err
+		}
+
+		if len(reply.Applied) == 0 {
+			fmt.Println("applied:          nothing changed")
+		} else {
+			fmt.Printf("applied:          %s\n", strings.Join(reply.Applied, ", "))
+		}
+
+		if len(reply.RestartRequired) > 0 {
+			fmt.Printf("restart required: %s\n", strings.Join(reply.RestartRequired, ", "))
+		}
+
+		return nil
+	})
+}
+
+// configReloader re-reads config file of the running server. Settings are
+// validated before anything is applied, so an invalid config changes nothing.
+type configReloader struct {
+	cmd        *cobra.Command
+	level      zap.AtomicLevel
+	httpServer *http.HttpServer
+	webhooks   *application.WebhookDispatcher
+	pipeline   *application.ProcessingPipeline
+	auth       *application.AuthManager
+	running    map[string]string
+	mu         sync.Mutex
+	logger     *zap.Logger
+}
+
+func newConfigReloader(cmd *cobra.Command, level zap.AtomicLevel, httpServer *http.HttpServer,
+	webhooks *application.WebhookDispatcher, pipeline *application.ProcessingPipeline, auth *application.AuthManager,
+	logger *zap.Logger) *configReloader {
+	r := &configReloader{
+		cmd:        cmd,
+		level:      level,
+		httpServer: httpServer,
+		webhooks:   webhooks,
+		pipeline:   pipeline,
+		auth:       auth,
+		logger:     logger,
+	}
+
+	r.running = r.settings(viper.GetViper())
+
+	return r
+}
+
+// watchSignals reloads config on every SIGHUP.
+func (r *configReloader) watchSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		r.logger.Info("SIGHUP received, reloading config")
+
+		_, err := r.Reload()
+		if err != nil {
+			r.logger.Error("Config not reloaded", zap.Error(err))
+		}
+	}
+}
+
+func (r *configReloader) Reload() (*rpcSrv.ReloadReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v := viper.New()
+	v.SetConfigFile(viper.ConfigFileUsed())
+
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, fmt.Errorf("can't read config: %v", err)
+	}
+
+	err = validateConfig(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+
+	policy, err := passwordPolicy(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+
+	hasher, err := passwordHasher(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+
+	settings := r.settings(v)
+
+	certFile, keyFile := settings[certFlagName], settings[keyFlagName]
+	tlsEnabled := certFile != "" && keyFile != ""
+
+	if tlsEnabled && r.httpServer.TLSEnabled() {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return nil, fmt.Errorf("invalid config: certificate: %v", err)
+		}
+	}
+
+	var webhooks []application.WebhookConfig
+
+	// validated above
+	_ = v.UnmarshalKey(webhooksKey, &webhooks)
+
+	report := &rpcSrv.ReloadReport{}
+
+	changed := func(key string) bool {
+		return settings[key] != r.running[key]
+	}
+
+	if changed(verboseFlagName) {
+		r.level.SetLevel(logger2.Level(settings[verboseFlagName] == "true"))
+		report.Applied = append(report.Applied, verboseFlagName)
+	}
+
+	// certificate files are reloaded even if unchanged, they are usually
+	// renewed in place
+	if tlsEnabled && r.httpServer.TLSEnabled() {
+		// validated above
+		_ = r.httpServer.LoadCertificate(certFile, keyFile)
+		report.Applied = append(report.Applied, certFlagName, keyFlagName)
+	} else if changed(certFlagName) || changed(keyFlagName) {
+		report.RestartRequired = append(report.RestartRequired, certFlagName, keyFlagName)
+	}
+
+	if changed(webhooksKey) {
+		r.webhooks.SetWebhooks(webhooks)
+		report.Applied = append(report.Applied, webhooksKey)
+	}
+
+	if changed("processing.retries") || changed("processing.retry-delay") {
+		r.pipeline.SetRetryPolicy(v.GetInt("processing.retries"), v.GetDuration("processing.retry-delay"))
+		report.Applied = append(report.Applied, "processing.retries", "processing.retry-delay")
+	}
+
+	// common passwords file is read again even if unchanged, lists are
+	// updated in place
+	if changed(passwordPolicyKey) || v.GetString(passwordPolicyKey+".common-file") != "" {
+		r.auth.SetPasswordPolicy(policy)
+		report.Applied = append(report.Applied, passwordPolicyKey)
+	}
+
+	if changed(passwordHashKey) {
+		r.auth.SetPasswordHasher(hasher)
+		report.Applied = append(report.Applied, passwordHashKey)
+	}
+
+	// restart settings keep values the server started with
+	for _, key := range restartSettings {
+		if changed(key) {
+			report.RestartRequired = append(report.RestartRequired, key)
+		}
+	}
+
+	for _, key := range liveSettings {
+		r.running[key] = settings[key]
+	}
+
+	r.logger.Info("Config reloaded",
+		zap.Strings("applied", report.Applied), zap.Strings("restart_required", report.RestartRequired))
+
+	return report, nil
+}
+
+// settings returns comparable values of all reloadable and restart settings,
+// command line flags take precedence over the config file.
+func (r *configReloader) settings(v *viper.Viper) map[string]string {
+	settings := map[string]string{}
+
+	for _, key := range append(liveSettings, restartSettings...) {
+		if flag := r.cmd.Flags().Lookup(key); flag != nil && (flag.Changed || !v.IsSet(key)) {
+			settings[key] = flag.Value.String()
+			continue
+		}
+
+		settings[key] = fmt.Sprint(v.Get(key))
+	}
+
+	if verbose, _ := r.cmd.Flags().GetBool(verboseFlagName); verbose || v.GetBool(verboseFlagName) {
+		settings[verboseFlagName] = "true"
+	} else {
+		settings[verboseFlagName] = "false"
+	}
+
+	return settings
+}
+
+// validateConfig checks settings which would otherwise silently fall back
+// to defaults or fail only on restart.
+func validateConfig(v *viper.Viper) error {
+	var webhooks []application.WebhookConfig
+
+	err := v.UnmarshalKey(webhooksKey, &webhooks)
+	if err != nil {
+		return fmt.Errorf("webhooks: %v", err)
+	}
+
+	for _, hook := range webhooks {
+		u, err := url.Parse(hook.URL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("webhooks: invalid url %q", hook.URL)
+		}
+	}
+
+	var hooks []hookConfig
+
+	err = v.UnmarshalKey("processing.hooks", &hooks)
+	if err != nil {
+		return fmt.Errorf("processing.hooks: %v", err)
+	}
+
+	for _, key := range []string{"processing.retry-delay", "antivirus.timeout"} {
+		if value, ok := v.Get(key).(string); ok {
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("%s: %v", key, err)
+			}
+		}
+	}
+
+	if v.GetInt("processing.retries") < 0 {
+		return fmt.Errorf("processing.retries: must not be negative")
+	}
+
+	switch v.GetString(storageFlagName) {
+	case "", storageLocal, storageS3:
+	default:
+		return fmt.Errorf("%s: unknown storage %q", storageFlagName, v.GetString(storageFlagName))
+	}
+
+	_, err = application.ParseCollisionPolicy(v.GetString(collisionKey))
+	if err != nil {
+		return fmt.Errorf("%s: %v", collisionKey, err)
+	}
+
+	err = application.CompressionConfig{Level: v.GetString("compression.level")}.Validate()
+	if err != nil {
+		return fmt.Errorf("compression: %v", err)
+	}
+
+	err = (&http.ClientAuthConfig{
+		Mode:         v.GetString("mtls.mode"),
+		UsernameFrom: v.GetString("mtls.username"),
+	}).Validate()
+	if err != nil {
+		return fmt.Errorf("mtls: %v", err)
+	}
+
+	return nil
+}
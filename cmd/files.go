@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var filesCmd = &cobra.Command{
+	Use:   "files",
+	Short: "Inspect uploaded files.",
+}
+
+var filesInfoCmd = &cobra.Command{
+	Use:   "info <username> <file>",
+	Short: "Show metadata of uploaded file.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  filesInfoCmdFunc,
+}
+
+var filesListCmd = &cobra.Command{
+	Use:   "list <username>",
+	Short: "List files of user, including all versions and uploads in progress.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  filesListCmdFunc,
+}
+
+var filesGetCmd = &cobra.Command{
+	Use:   "get <username> <file> [output]",
+	Short: "Download closed file or version, to file of the same name by default.",
+	Args:  cobra.RangeArgs(2, 3),
+	RunE:  filesGetCmdFunc,
+}
+
+var filesDedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Replace duplicate closed files with links to a single stored copy.",
+	Args:  cobra.NoArgs,
+	RunE:  filesDedupeCmdFunc,
+}
+
+var filesTimestampCmd = &cobra.Command{
+	Use:   "timestamp <username> <file>",
+	Short: "Verify trusted timestamp of closed file against its current content.",
+	Long: "Verify trusted timestamp of closed file against its current content.\n\n" +
+		"With --out, the RFC 3161 token is saved for verification by other tools, ie. openssl ts -verify.",
+	Args: cobra.ExactArgs(2),
+	RunE: filesTimestampCmdFunc,
+}
+
+func init() {
+	filesTimestampCmd.Flags().String(outFlagName, "", "file to save DER encoded timestamp token to")
+
+	filesCmd.AddCommand(filesInfoCmd)
+	filesCmd.AddCommand(filesListCmd)
+	filesCmd.AddCommand(filesGetCmd)
+	filesCmd.AddCommand(filesDedupeCmd)
+	filesCmd.AddCommand(filesTimestampCmd)
+	rootCmd.AddCommand(filesCmd)
+}
+
+//noinspection GoUnusedParameter
+func filesInfoCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		infoRequest := &rpcSrv.FileRequest{
+			Username: args[0],
+			File:     args[1],
+		}
+
+		var reply application.FileMetadata
+
+		logger.Debug("Calling RpcServer.FileMetadata")
+
+		err := client.Call("RpcServer.FileMetadata", infoRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("file:     %s/%s\n", reply.Username, reply.File)
+		fmt.Printf("size:     %d\n", reply.Size)
+		fmt.Printf("sha256:   %s\n", reply.Digest)
+		fmt.Printf("updated:  %s\n", reply.Updated.Format(time.RFC3339))
+
+		if reply.Scan != nil {
+			verdict := "clean"
+			if reply.Scan.Infected {
+				verdict = "infected: " + reply.Scan.Signature
+			}
+
+			fmt.Printf("scan:     %s (%s, %s)\n", verdict, reply.Scan.Scanner, reply.Scan.Time.Format(time.RFC3339))
+		}
+
+		if reply.Timestamp != nil {
+			fmt.Printf("stamped:  %s (%s)\n", reply.Timestamp.Time.Format(time.RFC3339), reply.Timestamp.Signer)
+		}
+
+		return nil
+	})
+}
+
+//noinspection GoUnusedParameter
+func filesListCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		listRequest := &rpcSrv.UsernameRequest{
+			Username: args[0],
+		}
+
+		var reply []application.FileInfo
+
+		logger.Debug("Calling RpcServer.ListFiles")
+
+		err := client.Call("RpcServer.ListFiles", listRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		for _, file := range reply {
+			state := "closed"
+			if !file.Closed {
+				state = "uploading"
+			}
+
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", file.Name, file.Size, state, file.Updated.Format(time.RFC3339))
+		}
+
+		return w.Flush()
+	})
+}
+
+//noinspection GoUnusedParameter
+func filesGetCmdFunc(cmd *cobra.Command, args []string) error {
+	output := args[1]
+	if len(args) == 3 {
+		output = args[2]
+	}
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		out, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		//noinspection GoUnhandledErrorResult
+		defer out.Close()
+
+		readRequest := &rpcSrv.ReadFileRequest{
+			Username: args[0],
+			File:     args[1],
+			Length:   rpcSrv.MaxReadLength,
+		}
+
+		logger.Debug("Calling RpcServer.ReadFile")
+
+		for {
+			var reply []byte
+
+			err = client.Call("RpcServer.ReadFile", readRequest, &reply)
+			if err != nil {
+				_ = os.Remove(output)
+				return err
+			}
+
+			_, err = out.Write(reply)
+			if err != nil {
+				return err
+			}
+
+			readRequest.Offset += int64(len(reply))
+
+			if len(reply) < readRequest.Length {
+				break
+			}
+		}
+
+		fmt.Printf("%s: %d bytes\n", output, readRequest.Offset)
+
+		return out.Sync()
+	})
+}
+
+//noinspection GoUnusedParameter
+func filesDedupeCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply application.DedupeStats
+
+		logger.Debug("Calling RpcServer.DedupeFiles")
+
+		err := client.Call("RpcServer.DedupeFiles", &rpcSrv.Request{}, &reply)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("files:    %d\n", reply.Files)
+		fmt.Printf("linked:   %d\n", reply.Linked)
+		fmt.Printf("saved:    %d bytes\n", reply.Saved)
+		fmt.Printf("removed:  %d unreferenced copies\n", reply.Removed)
+
+		return nil
+	})
+}
+
+//noinspection GoUnusedParameter
+func filesTimestampCmdFunc(cmd *cobra.Command, args []string) error {
+	out, _ := cmd.Flags().GetString(outFlagName)
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		timestampRequest := &rpcSrv.FileRequest{
+			Username: args[0],
+			File:     args[1],
+		}
+
+		var reply application.TimestampToken
+
+		logger.Debug("Calling RpcServer.VerifyTimestamp")
+
+		err := client.Call("RpcServer.VerifyTimestamp", timestampRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("valid:    timestamp matches the file")
+		fmt.Printf("time:     %s\n", reply.Time.Format(time.RFC3339))
+		fmt.Printf("tsa:      %s\n", reply.TSA)
+		fmt.Printf("signer:   %s\n", reply.Signer)
+		fmt.Printf("serial:   %s\n", reply.Serial)
+
+		if out != "" {
+			return ioutil.WriteFile(out, reply.Token, 0644)
+		}
+
+		return nil
+	})
+}
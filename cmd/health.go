@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/horizontal-org/direct-upload/server/http"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net/rpc"
+	"strings"
+	"time"
+)
+
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check health of running server, fails if certificate has expired.",
+	Args:  cobra.NoArgs,
+	RunE:  healthCmdFunc,
+}
+
+func init() {
+	rootCmd.AddCommand(healthCmd)
+}
+
+//noinspection GoUnusedParameter
+func healthCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply rpcSrv.HealthReport
+
+		logger.Debug("Calling RpcServer.Health")
+
+		err := client.Call("RpcServer.Health", &rpcSrv.Request{}, &reply)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("tls:         %s\n", reply.TLS)
+
+		cert := reply.Certificate
+		if cert == nil {
+			return nil
+		}
+
+		fmt.Printf("certificate: %s\n", cert.File)
+		fmt.Printf("names:       %s\n", strings.Join(cert.Names, ", "))
+		fmt.Printf("expires:     %s (%d days)\n", cert.NotAfter.Format(time.RFC3339), cert.DaysLeft)
+
+		if time.Now().After(cert.NotAfter) {
+			return fmt.Errorf("certificate expired")
+		}
+
+		return nil
+	})
+}
+
+// serverHealth reports health of the http server.
+type serverHealth struct {
+	httpServer *http.HttpServer
+}
+
+func (h serverHealth) Health() *rpcSrv.HealthReport {
+	report := &rpcSrv.HealthReport{TLS: h.httpServer.TLSMode()}
+
+	if status := h.httpServer.CertificateStatus(); status != nil {
+		report.Certificate = &rpcSrv.CertificateHealth{
+			File:     status.File,
+			Names:    status.Names,
+			NotAfter: status.NotAfter,
+			DaysLeft: status.DaysLeft,
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/rpc"
+	"time"
+)
+
+const stateFlagName = "state"
+
+type hookConfig struct {
+	Name      string        `mapstructure:"name"`
+	Processor string        `mapstructure:"processor"`
+	Command   []string      `mapstructure:"command"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	Path      string        `mapstructure:"path"`
+}
+
+var processingCmd = &cobra.Command{
+	Use:   "processing",
+	Short: "Inspect post-close file processing.",
+}
+
+var processingStatusCmd = &cobra.Command{
+	Use:   "status <username> <file>",
+	Short: "Show processing status of a file.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  processingStatusCmdFunc,
+}
+
+var processingListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List processing status of files.",
+	Args:  cobra.ExactArgs(0),
+	RunE:  processingListCmdFunc,
+}
+
+func init() {
+	processingListCmd.Flags().String(stateFlagName, "",
+		"only list files in state, one of pending, running, done or failed")
+
+	processingCmd.AddCommand(processingStatusCmd)
+	processingCmd.AddCommand(processingListCmd)
+	rootCmd.AddCommand(processingCmd)
+}
+
+//noinspection GoUnusedParameter
+func processingStatusCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		statusRequest := &rpcSrv.FileRequest{
+			Username: args[0],
+			File:     args[1],
+		}
+
+		var reply application.ProcessingStatus
+
+		logger.Debug("Calling RpcServer.ProcessingStatus")
+
+		err := client.Call("RpcServer.ProcessingStatus", statusRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s/%s\t%s\t%s\t%s\n",
+			reply.Username, reply.File, reply.State, reply.Updated.Format(time.RFC3339), reply.Digest)
+
+		if reply.Error != "" {
+			fmt.Printf("  %s\n", reply.Error)
+		}
+
+		for _, step := range reply.Steps {
+			fmt.Printf("  %s\t%s\tattempts=%d\t%s\n", step.Name, step.State, step.Attempts, step.Error)
+
+			if step.Output != "" {
+				fmt.Printf("    %s\n", step.Output)
+			}
+		}
+
+		return nil
+	})
+}
+
+//noinspection GoUnusedParameter
+func processingListCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		state, err := cmd.Flags().GetString(stateFlagName)
+		if err != nil {
+			return err
+		}
+
+		listRequest := &rpcSrv.ProcessingListRequest{
+			State: application.ProcessingState(state),
+		}
+
+		var reply []application.ProcessingStatus
+
+		logger.Debug("Calling RpcServer.ListProcessing")
+
+		err = client.Call("RpcServer.ListProcessing", listRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range reply {
+			fmt.Printf("%s/%s\t%s\t%s\n",
+				status.Username, status.File, status.State, status.Updated.Format(time.RFC3339))
+		}
+
+		return nil
+	})
+}
+
+// newTimestamper returns nil unless trusted timestamps are configured.
+func newTimestamper() (*application.Timestamper, error) {
+	if viper.GetString("timestamp.url") == "" {
+		return nil, nil
+	}
+
+	var roots *x509.CertPool
+
+	if caFile := viper.GetString("timestamp.ca"); caFile != "" {
+		caPEM, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("%s: no certificates found", caFile)
+		}
+	}
+
+	return application.NewTimestamper(application.TimestampConfig{
+		URL:     viper.GetString("timestamp.url"),
+		Roots:   roots,
+		Timeout: viper.GetDuration("timestamp.timeout"),
+	})
+}
+
+// newProcessors builds post-close processors from processing.hooks config,
+// trusted timestamp is requested first when configured, followed by
+// antivirus scanning and deduplication so infected files are never stored.
+func newProcessors(store application.FileStore, metadata application.FileMetadataRepository,
+	timestamper *application.Timestamper) ([]application.Processor, error) {
+	var hooks []hookConfig
+
+	err := viper.UnmarshalKey("processing.hooks", &hooks)
+	if err != nil {
+		return nil, err
+	}
+
+	var processors []application.Processor
+
+	if timestamper != nil {
+		processors = append(processors, application.NewTimestampProcessor(timestamper, metadata))
+	}
+
+	if viper.GetString("antivirus.clamd") != "" {
+		client, err := application.NewClamdClient(viper.GetString("antivirus.clamd"), viper.GetDuration("antivirus.timeout"))
+		if err != nil {
+			return nil, err
+		}
+
+		antivirus, err := application.NewAntivirusProcessor(client, viper.GetString("antivirus.quarantine"), store, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		processors = append(processors, antivirus)
+	}
+
+	if viper.GetBool(dedupeKey) {
+		dedupe, err := application.NewDedupeProcessor(store)
+		if err != nil {
+			return nil, err
+		}
+
+		processors = append(processors, dedupe)
+	}
+
+	for _, hook := range hooks {
+		var processor application.Processor
+
+		switch hook.Processor {
+		case "", "command":
+			processor, err = application.NewCommandProcessor(hook.Name, hook.Command, hook.Timeout)
+		case "copy":
+			processor, err = application.NewCopyProcessor(hook.Path)
+		case "metadata":
+			processor = &application.MetadataProcessor{}
+		default:
+			err = fmt.Errorf("unknown processor %q", hook.Processor)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		processors = append(processors, processor)
+	}
+
+	return processors, nil
+}
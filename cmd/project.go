@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net/rpc"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const reviewerFlagName = "reviewer"
+
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Manage shared project folders and their members.",
+}
+
+var projectCreateCmd = &cobra.Command{
+	Use:   "create <project>",
+	Short: "Create project.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  projectCreateCmdFunc,
+}
+
+var projectDeleteCmd = &cobra.Command{
+	Use:   "delete <project>",
+	Short: "Delete project and its members, uploaded files are kept.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  projectDeleteCmdFunc,
+}
+
+var projectListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List projects and their members.",
+	Args:  cobra.ExactArgs(0),
+	RunE:  projectListCmdFunc,
+}
+
+var projectAddCmd = &cobra.Command{
+	Use:   "add <project> <username>",
+	Short: "Add user to project, or change role of a member.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  projectAddCmdFunc,
+}
+
+var projectRemoveCmd = &cobra.Command{
+	Use:   "remove <project> <username>",
+	Short: "Remove user from project.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  projectRemoveCmdFunc,
+}
+
+func init() {
+	projectAddCmd.Flags().Bool(reviewerFlagName, false, "member also reads all files of the project")
+
+	projectCmd.AddCommand(projectCreateCmd)
+	projectCmd.AddCommand(projectDeleteCmd)
+	projectCmd.AddCommand(projectListCmd)
+	projectCmd.AddCommand(projectAddCmd)
+	projectCmd.AddCommand(projectRemoveCmd)
+	rootCmd.AddCommand(projectCmd)
+}
+
+//noinspection GoUnusedParameter
+func projectCreateCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		if !application.ValidProjectName(args[0]) {
+			return application.ErrProjectNotValid
+		}
+
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.CreateProject", zap.String("project", args[0]))
+
+		return client.Call("RpcServer.CreateProject", &rpcSrv.ProjectRequest{Project: args[0]}, &reply)
+	})
+}
+
+//noinspection GoUnusedParameter
+func projectDeleteCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.DeleteProject", zap.String("project", args[0]))
+
+		return client.Call("RpcServer.DeleteProject", &rpcSrv.ProjectRequest{Project: args[0]}, &reply)
+	})
+}
+
+//noinspection GoUnusedParameter
+func projectListCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply []application.Project
+
+		logger.Debug("Calling RpcServer.ListProjects")
+
+		err := client.Call("RpcServer.ListProjects", &rpcSrv.Request{}, &reply)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		for _, project := range reply {
+			var members []string
+			for _, username := range project.Usernames() {
+				members = append(members, username+" ("+project.Members[username]+")")
+			}
+
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", project.Name, strings.Join(members, ", "))
+		}
+
+		return w.Flush()
+	})
+}
+
+//noinspection GoUnusedParameter
+func projectAddCmdFunc(cmd *cobra.Command, args []string) error {
+	reviewer, _ := cmd.Flags().GetBool(reviewerFlagName)
+
+	role := application.RoleUploader
+	if reviewer {
+		role = application.RoleReviewer
+	}
+
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		memberRequest := &rpcSrv.ProjectMemberRequest{
+			Project:  args[0],
+			Username: args[1],
+			Role:     role,
+		}
+
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.AddProjectMember",
+			zap.String("project", memberRequest.Project), zap.String("username", memberRequest.Username))
+
+		return client.Call("RpcServer.AddProjectMember", memberRequest, &reply)
+	})
+}
+
+//noinspection GoUnusedParameter
+func projectRemoveCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		memberRequest := &rpcSrv.ProjectMemberRequest{
+			Project:  args[0],
+			Username: args[1],
+		}
+
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.RemoveProjectMember",
+			zap.String("project", memberRequest.Project), zap.String("username", memberRequest.Username))
+
+		return client.Call("RpcServer.RemoveProjectMember", memberRequest, &reply)
+	})
+}
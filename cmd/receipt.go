@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/horizontal-org/direct-upload/db"
+	"github.com/horizontal-org/direct-upload/repository"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/rpc"
+	"os"
+	"time"
+)
+
+const receiptKeyFlagName = "key"
+
+var receiptCmd = &cobra.Command{
+	Use:   "receipt",
+	Short: "Show and verify signed upload receipts.",
+}
+
+var receiptKeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Print public key verifying receipts, to be published.",
+	Args:  cobra.ExactArgs(0),
+	RunE:  receiptKeyCmdFunc,
+}
+
+var receiptGetCmd = &cobra.Command{
+	Use:   "get <username> <file>",
+	Short: "Print receipt of closed file as JSON.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  receiptGetCmdFunc,
+}
+
+var receiptVerifyCmd = &cobra.Command{
+	Use:   "verify <receipt file|->",
+	Short: "Verify receipt offline against the server's public key.",
+	Long: "Verify receipt offline against the server's public key.\n\n" +
+		"With --file, the receipt must also match size and SHA-256 of the given file.",
+	Args: cobra.ExactArgs(1),
+	RunE: receiptVerifyCmdFunc,
+}
+
+func init() {
+	receiptVerifyCmd.Flags().String(receiptKeyFlagName, "", "PEM file with the server's public key")
+	receiptVerifyCmd.Flags().String(fileFlagName, "", "file the receipt must match")
+	_ = receiptVerifyCmd.MarkFlagRequired(receiptKeyFlagName)
+
+	receiptCmd.AddCommand(receiptKeyCmd)
+	receiptCmd.AddCommand(receiptGetCmd)
+	receiptCmd.AddCommand(receiptVerifyCmd)
+	rootCmd.AddCommand(receiptCmd)
+}
+
+//noinspection GoUnusedParameter
+func receiptKeyCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply []byte
+
+		logger.Debug("Calling RpcServer.ReceiptKey")
+
+		err := client.Call("RpcServer.ReceiptKey", &rpcSrv.Request{}, &reply)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(string(reply))
+
+		return nil
+	})
+}
+
+//noinspection GoUnusedParameter
+func receiptGetCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		receiptRequest := &rpcSrv.FileRequest{
+			Username: args[0],
+			File:     args[1],
+		}
+
+		var reply application.Receipt
+
+		logger.Debug("Calling RpcServer.GetReceipt",
+			zap.String("username", receiptRequest.Username), zap.String("file", receiptRequest.File))
+
+		err := client.Call("RpcServer.GetReceipt", receiptRequest, &reply)
+		if err != nil {
+			return err
+		}
+
+		out, err := json.MarshalIndent(&reply, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(out))
+
+		return nil
+	})
+}
+
+//noinspection GoUnusedParameter
+func receiptVerifyCmdFunc(cmd *cobra.Command, args []string) error {
+	keyFile, _ := cmd.Flags().GetString(receiptKeyFlagName)
+	file, _ := cmd.Flags().GetString(fileFlagName)
+
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+
+	key, err := application.ParseReceiptPublicKey(keyPEM)
+	if err != nil {
+		return fmt.Errorf("%s: %v", keyFile, err)
+	}
+
+	receipt, err := readReceipt(args[0])
+	if err != nil {
+		return err
+	}
+
+	err = receipt.Verify(key)
+	if err != nil {
+		return err
+	}
+
+	if file != "" {
+		size, digest, err := fileDigest(file)
+		if err != nil {
+			return err
+		}
+
+		if size != receipt.Size || digest != receipt.SHA256 {
+			return errors.New("receipt signature valid, but it doesn't match the file")
+		}
+	}
+
+	fmt.Printf("valid:    signed by key %s\n", receipt.KeyID)
+	fmt.Printf("username: %s\n", receipt.Username)
+
+	if receipt.Project != "" {
+		fmt.Printf("project:  %s\n", receipt.Project)
+	}
+
+	fmt.Printf("file:     %s\n", receipt.File)
+	fmt.Printf("size:     %d\n", receipt.Size)
+	fmt.Printf("sha256:   %s\n", receipt.SHA256)
+	fmt.Printf("received: %s\n", receipt.Time.Local().Format(time.RFC3339))
+
+	return nil
+}
+
+// readReceipt reads JSON encoded receipt from file, "-" for stdin.
+func readReceipt(path string) (*application.Receipt, error) {
+	var in io.Reader = os.Stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		//noinspection GoUnhandledErrorResult
+		defer f.Close()
+
+		in = f
+	}
+
+	var receipt application.Receipt
+
+	err := json.NewDecoder(in).Decode(&receipt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: receipt not valid: %v", path, err)
+	}
+
+	return &receipt, nil
+}
+
+func fileDigest(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// newReceiptIssuer loads receipt signing key, creating it on first start.
+func newReceiptIssuer(conn *db.BoltConnection, store application.FileStore,
+	logger *zap.Logger) (*application.ReceiptIssuer, error) {
+	repo, err := repository.NewReceiptRepo(repository.ReceiptRepoConfig{
+		DB: conn.GetDB(),
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := application.LoadReceiptKey(viper.GetString("receipts.key"))
+	if err != nil {
+		return nil, err
+	}
+
+	return application.NewReceiptIssuer(key, store, repo, logger), nil
+}
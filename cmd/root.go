@@ -25,14 +25,16 @@ to collect data for research, advocacy, or legal proceedings.`,
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVarP(&rpcAddress, rpcFlagName, "r", "127.0.0.1:1206",
-		"address for rpc server to bind to")
+	rootCmd.PersistentFlags().StringVarP(&rpcAddress, rpcFlagName, "r", "unix:direct-upload.sock",
+		"address for rpc server to bind to, unix:<socket path> or <host>:<port>")
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, verboseFlagName, "v", false,
 		"make logging more talkative")
 
 	//noinspection GoUnhandledErrorResult
 	viper.BindPFlags(rootCmd.Flags())
+	//noinspection GoUnhandledErrorResult
+	viper.BindPFlag(rpcFlagName, rootCmd.PersistentFlags().Lookup(rpcFlagName))
 }
 
 func initConfig() {
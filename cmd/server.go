@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/horizontal-org/direct-upload/application"
 	"github.com/horizontal-org/direct-upload/db"
 	logger2 "github.com/horizontal-org/direct-upload/logger"
 	"github.com/horizontal-org/direct-upload/repository"
+	"github.com/horizontal-org/direct-upload/s3"
 	"github.com/horizontal-org/direct-upload/server/http"
 	"github.com/horizontal-org/direct-upload/server/rpc"
 	"github.com/spf13/cobra"
@@ -19,11 +21,18 @@ const (
 	certFlagName     = "cert"
 	keyFlagName      = "key"
 	rpcFlagName      = "rpc"
+	storageFlagName  = "storage"
 	verboseFlagName  = "verbose"
+	webhooksKey      = "webhooks"
+	collisionKey     = "collision"
+	dedupeKey        = "dedupe"
+
+	storageLocal = "local"
+	storageS3    = "s3"
 )
 
 // cmd args
-var address, database, files, cert, key string
+var address, database, files, cert, key, storage string
 
 var serverCmd = &cobra.Command{
 	Use:   "server",
@@ -48,24 +57,89 @@ func init() {
 	serverCmd.Flags().StringVarP(&key, keyFlagName, "k", viper.GetString(keyFlagName),
 		"private key file, ie. ./key.pem")
 
+	serverCmd.Flags().StringVarP(&storage, storageFlagName, "s", storageLocal,
+		"storage backend for uploaded files, local or s3")
+
 	viper.BindPFlags(serverCmd.Flags())
 
+	viper.SetDefault("acme.cache", "/data/acme")
+	viper.SetDefault("mtls.ca", "/data/ca")
+	viper.SetDefault("receipts.key", "./receipt-key.pem")
+
 	rootCmd.AddCommand(serverCmd)
 }
 
 //noinspection GoUnusedParameter
 func serverCmdFunc(cmd *cobra.Command, args []string) {
-	logger, _ := logger2.NewLogger(isVerbose(cmd))
+	logger, level, _ := logger2.NewLeveledLogger(isVerbose(cmd))
 	//goland:noinspection GoUnhandledErrorResult
 	defer logger.Sync()
 
-	localFileStore, _ := application.NewLocalFileStore(application.LocalFileStoreConfig{
-		Path: viper.GetString(filesFlagName),
-	}, logger)
-
 	conn := db.NewBoltConnection(logger, viper.GetString(databaseFlagName))
 	defer conn.Close(logger)
 
+	events := application.NewEventBus(logger)
+
+	webhookRepository, err := repository.NewWebhookRepo(repository.WebhookRepoConfig{
+		DB: conn.GetDB(),
+	}, logger)
+	if err != nil {
+		logger.Fatal("Unable to create Webhook Repository", zap.Error(err))
+	}
+
+	var webhooks []application.WebhookConfig
+
+	err = viper.UnmarshalKey(webhooksKey, &webhooks)
+	if err != nil {
+		logger.Fatal("Unable to read webhooks config", zap.Error(err))
+	}
+
+	webhookDispatcher := application.NewWebhookDispatcher(application.WebhookDispatcherConfig{
+		Webhooks: webhooks,
+	}, webhookRepository, logger)
+	events.Subscribe(webhookDispatcher.Handle)
+
+	go webhookDispatcher.Start()
+
+	fileStore, err := newFileStore(events, logger)
+	if err != nil {
+		logger.Fatal("Unable to create File Store", zap.Error(err))
+	}
+
+	processingRepository, err := repository.NewProcessingRepo(repository.ProcessingRepoConfig{
+		DB: conn.GetDB(),
+	}, logger)
+	if err != nil {
+		logger.Fatal("Unable to create Processing Repository", zap.Error(err))
+	}
+
+	fileMetadataRepository, err := repository.NewFileMetadataRepo(repository.FileMetadataRepoConfig{
+		DB: conn.GetDB(),
+	}, logger)
+	if err != nil {
+		logger.Fatal("Unable to create File Metadata Repository", zap.Error(err))
+	}
+
+	timestamper, err := newTimestamper()
+	if err != nil {
+		logger.Fatal("Unable to set up trusted timestamps", zap.Error(err))
+	}
+
+	processors, err := newProcessors(fileStore, fileMetadataRepository, timestamper)
+	if err != nil {
+		logger.Fatal("Unable to read processing config", zap.Error(err))
+	}
+
+	processingPipeline := application.NewProcessingPipeline(application.ProcessingConfig{
+		Workers:    viper.GetInt("processing.workers"),
+		Retries:    viper.GetInt("processing.retries"),
+		RetryDelay: viper.GetDuration("processing.retry-delay"),
+		QueueSize:  viper.GetInt("processing.queue-size"),
+	}, processors, fileStore, processingRepository, logger)
+	events.Subscribe(processingPipeline.Handle)
+
+	go processingPipeline.Start()
+
 	authRepository, err := repository.NewUserRepo(repository.UserRepoConfig{
 		DB: conn.GetDB(),
 	}, logger)
@@ -73,22 +147,159 @@ func serverCmdFunc(cmd *cobra.Command, args []string) {
 		logger.Fatal("Unable to create User Repository", zap.Error(err))
 	}
 
-	authManager := application.NewAuthManager(logger, authRepository)
+	authManager := application.NewAuthManager(logger, authRepository, events)
 
-	// start http server
-	go http.NewServer(http.Config{
+	policy, err := passwordPolicy(viper.GetViper())
+	if err != nil {
+		logger.Fatal("Unable to read password policy config", zap.Error(err))
+	}
+
+	authManager.SetPasswordPolicy(policy)
+
+	hasher, err := passwordHasher(viper.GetViper())
+	if err != nil {
+		logger.Fatal("Unable to read password hash config", zap.Error(err))
+	}
+
+	authManager.SetPasswordHasher(hasher)
+
+	projectRepository, err := repository.NewProjectRepo(repository.ProjectRepoConfig{
+		DB: conn.GetDB(),
+	}, logger)
+	if err != nil {
+		logger.Fatal("Unable to create Project Repository", zap.Error(err))
+	}
+
+	projectManager := application.NewProjectManager(projectRepository, authManager, logger)
+	events.Subscribe(projectManager.Handle)
+
+	auditRepository, err := repository.NewAuditRepo(repository.AuditRepoConfig{
+		DB: conn.GetDB(),
+	}, logger)
+	if err != nil {
+		logger.Fatal("Unable to create Audit Repository", zap.Error(err))
+	}
+
+	auditLog, err := application.NewAuditLog(auditRepository, logger)
+	if err != nil {
+		logger.Fatal("Unable to read audit log", zap.Error(err))
+	}
+
+	events.Subscribe(auditLog.Handle)
+
+	receiptIssuer, err := newReceiptIssuer(conn, fileStore, logger)
+	if err != nil {
+		logger.Fatal("Unable to set up receipts", zap.Error(err))
+	}
+
+	clientAuth, deviceCA, err := newClientAuth(conn, logger)
+	if err != nil {
+		logger.Fatal("Unable to set up client certificates", zap.Error(err))
+	}
+
+	httpServer := http.NewServer(http.Config{
 		Address:        viper.GetString(addressFlagName),
 		CertFile:       viper.GetString(certFlagName),
 		PrivateKeyFile: viper.GetString(keyFlagName),
-	}, authManager, localFileStore, logger).Start()
+		ACME: &http.ACMEConfig{
+			Domains:      viper.GetStringSlice("acme.domains"),
+			Email:        viper.GetString("acme.email"),
+			CacheDir:     viper.GetString("acme.cache"),
+			DirectoryURL: viper.GetString("acme.directory"),
+			HTTPAddress:  viper.GetString("acme.http-address"),
+			CAFile:       viper.GetString("acme.ca"),
+		},
+		ClientAuth: clientAuth,
+	}, authManager, projectManager, fileStore, receiptIssuer, logger)
 
-	rpcAddress, err := cmd.Flags().GetString(rpcFlagName)
+	// start http server
+	go httpServer.Start()
+
+	adminServerConfig, err := adminConfig()
 	if err != nil {
-		logger.Fatal("Unknown rpc server address", zap.Error(err))
+		logger.Fatal("Unable to read admin API config", zap.Error(err))
+	}
+
+	// start admin API server, only when configured
+	if adminServerConfig.Address != "" {
+		adminServer := http.NewAdminServer(adminServerConfig, authManager, fileStore, conn, httpServer, auditLog, logger)
+
+		go adminServer.Start()
+	}
+
+	reloader := newConfigReloader(cmd, level, httpServer, webhookDispatcher, processingPipeline, authManager, logger)
+
+	go reloader.watchSignals()
+
+	rpcServerConfig, err := rpcConfig()
+	if err != nil {
+		logger.Fatal("Unable to read rpc config", zap.Error(err))
 	}
 
 	// start rpc server
-	rpc.StartRpcServer(rpc.Config{
-		Path: rpcAddress,
-	}, authManager, conn, logger)
+	rpc.StartRpcServer(rpcServerConfig, rpc.Deps{
+		AuthManager:        authManager,
+		ProjectManager:     projectManager,
+		WebhookDispatcher:  webhookDispatcher,
+		ProcessingPipeline: processingPipeline,
+		FileMetadata:       fileMetadataRepository,
+		FileStore:          fileStore,
+		Reloader:           reloader,
+		Health:             serverHealth{httpServer},
+		DeviceCA:           deviceCA,
+		AuditLog:           auditLog,
+		ReceiptIssuer:      receiptIssuer,
+		Timestamper:        timestamper,
+		DB:                 conn,
+	}, logger)
+}
+
+func newFileStore(events *application.EventBus, logger *zap.Logger) (application.FileStore, error) {
+	collision, err := application.ParseCollisionPolicy(viper.GetString(collisionKey))
+	if err != nil {
+		return nil, err
+	}
+
+	switch viper.GetString(storageFlagName) {
+	case storageLocal, "":
+		store, err := application.NewLocalFileStore(application.LocalFileStoreConfig{
+			Path:      viper.GetString(filesFlagName),
+			Collision: collision,
+			Dedupe:    viper.GetBool(dedupeKey),
+			Compression: application.CompressionConfig{
+				ContentTypes: viper.GetStringSlice("compression.content-types"),
+				Level:        viper.GetString("compression.level"),
+			},
+		}, events, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		return store, store.Migrate()
+
+	case storageS3:
+		if viper.GetBool(dedupeKey) {
+			return nil, application.ErrDedupeDisabled
+		}
+
+		client, err := s3.NewClient(s3.Config{
+			Endpoint:  viper.GetString("s3.endpoint"),
+			Region:    viper.GetString("s3.region"),
+			Bucket:    viper.GetString("s3.bucket"),
+			AccessKey: viper.GetString("s3.access-key"),
+			SecretKey: viper.GetString("s3.secret-key"),
+			PathStyle: viper.GetBool("s3.path-style"),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return application.NewS3FileStore(application.S3FileStoreConfig{
+			Prefix:    viper.GetString("s3.prefix"),
+			PartSize:  viper.GetInt64("s3.part-size"),
+			Collision: collision,
+		}, client, events, logger)
+	}
+
+	return nil, fmt.Errorf("unknown storage %q", viper.GetString(storageFlagName))
 }
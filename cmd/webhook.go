@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	rpcSrv "github.com/horizontal-org/direct-upload/server/rpc"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"net/rpc"
+	"time"
+)
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Manage webhook deliveries.",
+}
+
+var webhookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List failed webhook deliveries.",
+	Args:  cobra.ExactArgs(0),
+	RunE:  webhookListCmdFunc,
+}
+
+var webhookReplayCmd = &cobra.Command{
+	Use:   "replay <id>",
+	Short: "Queue failed webhook delivery for another attempt.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  webhookReplayCmdFunc,
+}
+
+func init() {
+	webhookCmd.AddCommand(webhookListCmd)
+	webhookCmd.AddCommand(webhookReplayCmd)
+	rootCmd.AddCommand(webhookCmd)
+}
+
+//noinspection GoUnusedParameter
+func webhookListCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		var reply []application.WebhookDelivery
+
+		logger.Debug("Calling RpcServer.ListFailedWebhooks")
+
+		err := client.Call("RpcServer.ListFailedWebhooks", &rpcSrv.Request{}, &reply)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range reply {
+			fmt.Printf("%s\t%s\t%s\t%d\t%s\t%s\n",
+				d.ID, d.Created.Format(time.RFC3339), d.EventType, d.Attempts, d.URL, d.LastError)
+		}
+
+		return nil
+	})
+}
+
+//noinspection GoUnusedParameter
+func webhookReplayCmdFunc(cmd *cobra.Command, args []string) error {
+	return with(cmd, func(logger *zap.Logger, client *rpc.Client) error {
+		replayRequest := &rpcSrv.WebhookDeliveryRequest{
+			ID: args[0],
+		}
+
+		var reply rpcSrv.Response
+
+		logger.Debug("Calling RpcServer.ReplayWebhook", zap.String("id", replayRequest.ID))
+
+		return client.Call("RpcServer.ReplayWebhook", replayRequest, &reply)
+	})
+}
@@ -3,6 +3,7 @@ package db
 import (
 	bolt "go.etcd.io/bbolt"
 	"go.uber.org/zap"
+	"io"
 	"sync"
 	"time"
 )
@@ -40,6 +41,19 @@ func (c *BoltConnection) Close(logger *zap.Logger) {
 	}
 }
 
+// WriteBackup streams consistent copy of the database.
+func (c *BoltConnection) WriteBackup(w io.Writer) (int64, error) {
+	var written int64
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		var err error
+		written, err = tx.WriteTo(w)
+		return err
+	})
+
+	return written, err
+}
+
 func (c *BoltConnection) Backup(logger *zap.Logger, toPath string) error {
 	return c.db.View(func(tx *bolt.Tx) error {
 		return tx.CopyFile(toPath, 0600)
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func NewLogger(verbose bool) (*zap.Logger, error) {
@@ -11,3 +12,25 @@ func NewLogger(verbose bool) (*zap.Logger, error) {
 
 	return zap.NewProduction()
 }
+
+// NewLeveledLogger returns logger whose level can be changed while running,
+// output format is kept.
+func NewLeveledLogger(verbose bool) (*zap.Logger, zap.AtomicLevel, error) {
+	config := zap.NewProductionConfig()
+	if verbose {
+		config = zap.NewDevelopmentConfig()
+	}
+
+	logger, err := config.Build()
+
+	return logger, config.Level, err
+}
+
+// Level returns logging level used by NewLogger.
+func Level(verbose bool) zapcore.Level {
+	if verbose {
+		return zapcore.DebugLevel
+	}
+
+	return zapcore.InfoLevel
+}
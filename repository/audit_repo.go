@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"github.com/horizontal-org/direct-upload/application"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+type AuditRepoConfig struct {
+	DB *bolt.DB
+}
+
+// AuditRepo stores audit entries keyed by big endian Seq, so cursor order is
+// the order of entries.
+type AuditRepo struct {
+	logger *zap.Logger
+	db     *bolt.DB
+}
+
+var auditBucket = []byte("Audit")
+
+func NewAuditRepo(config AuditRepoConfig, logger *zap.Logger) (*AuditRepo, error) {
+	auditRepo := &AuditRepo{
+		logger: logger,
+		db:     config.DB,
+	}
+
+	err := auditRepo.setupDb()
+	if err != nil {
+		return nil, err
+	}
+
+	return auditRepo, nil
+}
+
+func auditKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+
+	return key
+}
+
+func (r *AuditRepo) Append(entry *application.AuditEntry) error {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(entry)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditBucket)
+
+		last := uint64(0)
+		if k, _ := b.Cursor().Last(); k != nil {
+			last = binary.BigEndian.Uint64(k)
+		}
+
+		if entry.Seq != last+1 {
+			return application.ErrAuditSequence
+		}
+
+		r.logger.Debug("Append AuditEntry in DB", zap.Uint64("seq", entry.Seq))
+
+		return b.Put(auditKey(entry.Seq), buf.Bytes())
+	})
+}
+
+func (r *AuditRepo) Last() (*application.AuditEntry, error) {
+	var entry *application.AuditEntry
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		_, v := tx.Bucket(auditBucket).Cursor().Last()
+		if v == nil {
+			return nil
+		}
+
+		entry = &application.AuditEntry{}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (r *AuditRepo) List(from uint64, limit int) <-chan application.AuditEntry {
+	out := make(chan application.AuditEntry)
+
+	go func() {
+		defer close(out)
+
+		err := r.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(auditBucket).Cursor()
+
+			n := 0
+
+			for k, v := c.Seek(auditKey(from)); k != nil && (limit <= 0 || n < limit); k, v = c.Next() {
+				var entry application.AuditEntry
+
+				err := gob.NewDecoder(bytes.NewReader(v)).Decode(&entry)
+				if err != nil {
+					return err
+				}
+
+				out <- entry
+				n++
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			r.logger.Error("Error iterating bucket",
+				zap.String("bucket", string(auditBucket)),
+				zap.Error(err))
+		}
+	}()
+
+	return out
+}
+
+func (r *AuditRepo) setupDb() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(auditBucket)
+		return err
+	})
+}
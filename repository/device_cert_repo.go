@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/horizontal-org/direct-upload/application"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+type DeviceCertRepoConfig struct {
+	DB *bolt.DB
+}
+
+type DeviceCertRepo struct {
+	logger *zap.Logger
+	db     *bolt.DB
+}
+
+var deviceCertificateBucket = []byte("DeviceCertificate")
+
+func NewDeviceCertRepo(config DeviceCertRepoConfig, logger *zap.Logger) (*DeviceCertRepo, error) {
+	deviceCertRepo := &DeviceCertRepo{
+		logger: logger,
+		db:     config.DB,
+	}
+
+	err := deviceCertRepo.setupDb()
+	if err != nil {
+		return nil, err
+	}
+
+	return deviceCertRepo, nil
+}
+
+func (r *DeviceCertRepo) Save(cert *application.DeviceCertificate) error {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(cert)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		r.logger.Debug("Save DeviceCertificate in DB", zap.String("serial", cert.Serial))
+
+		return tx.Bucket(deviceCertificateBucket).Put([]byte(cert.Serial), buf.Bytes())
+	})
+}
+
+func (r *DeviceCertRepo) Read(serial string) (*application.DeviceCertificate, error) {
+	var cert application.DeviceCertificate
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(deviceCertificateBucket).Get([]byte(serial))
+
+		if v == nil {
+			return errNotFound
+		}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(&cert)
+	})
+	if err == errNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+func (r *DeviceCertRepo) List() <-chan application.DeviceCertificate {
+	out := make(chan application.DeviceCertificate)
+
+	go func() {
+		defer close(out)
+
+		err := r.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(deviceCertificateBucket).ForEach(func(k, v []byte) error {
+				var cert application.DeviceCertificate
+
+				err := gob.NewDecoder(bytes.NewReader(v)).Decode(&cert)
+				if err != nil {
+					return err
+				}
+
+				out <- cert
+
+				return nil
+			})
+		})
+
+		if err != nil {
+			r.logger.Error("Error iterating bucket",
+				zap.String("bucket", string(deviceCertificateBucket)),
+				zap.Error(err))
+		}
+	}()
+
+	return out
+}
+
+func (r *DeviceCertRepo) setupDb() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(deviceCertificateBucket)
+		return err
+	})
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/horizontal-org/direct-upload/application"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+type FileMetadataRepoConfig struct {
+	DB *bolt.DB
+}
+
+type FileMetadataRepo struct {
+	logger *zap.Logger
+	db     *bolt.DB
+}
+
+var fileMetadataBucket = []byte("FileMetadata")
+
+func NewFileMetadataRepo(config FileMetadataRepoConfig, logger *zap.Logger) (*FileMetadataRepo, error) {
+	fileMetadataRepo := &FileMetadataRepo{
+		logger: logger,
+		db:     config.DB,
+	}
+
+	err := fileMetadataRepo.setupDb()
+	if err != nil {
+		return nil, err
+	}
+
+	return fileMetadataRepo, nil
+}
+
+func (r *FileMetadataRepo) Save(meta *application.FileMetadata) error {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(meta)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		r.logger.Debug("Update FileMetadata in DB",
+			zap.String("username", meta.Username), zap.String("file", meta.File))
+
+		return tx.Bucket(fileMetadataBucket).Put(fileKey(meta.Username, meta.File), buf.Bytes())
+	})
+}
+
+func (r *FileMetadataRepo) Read(username, file string) (*application.FileMetadata, error) {
+	var meta application.FileMetadata
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(fileMetadataBucket).Get(fileKey(username, file))
+
+		if v == nil {
+			return errNotFound
+		}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(&meta)
+	})
+	if err == errNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &meta, nil
+}
+
+func (r *FileMetadataRepo) Delete(username, file string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		r.logger.Debug("Delete FileMetadata in DB", zap.String("username", username), zap.String("file", file))
+
+		return tx.Bucket(fileMetadataBucket).Delete(fileKey(username, file))
+	})
+}
+
+func (r *FileMetadataRepo) setupDb() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(fileMetadataBucket)
+		return err
+	})
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/horizontal-org/direct-upload/application"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+type ProcessingRepoConfig struct {
+	DB *bolt.DB
+}
+
+type ProcessingRepo struct {
+	logger *zap.Logger
+	db     *bolt.DB
+}
+
+var processingStatusBucket = []byte("ProcessingStatus")
+
+func NewProcessingRepo(config ProcessingRepoConfig, logger *zap.Logger) (*ProcessingRepo, error) {
+	processingRepo := &ProcessingRepo{
+		logger: logger,
+		db:     config.DB,
+	}
+
+	err := processingRepo.setupDb()
+	if err != nil {
+		return nil, err
+	}
+
+	return processingRepo, nil
+}
+
+func (r *ProcessingRepo) Save(status *application.ProcessingStatus) error {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(status)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(processingStatusBucket).Put(fileKey(status.Username, status.File), buf.Bytes())
+	})
+}
+
+func (r *ProcessingRepo) Read(username, file string) (*application.ProcessingStatus, error) {
+	var status application.ProcessingStatus
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(processingStatusBucket).Get(fileKey(username, file))
+
+		if v == nil {
+			return errNotFound
+		}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(&status)
+	})
+	if err == errNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func (r *ProcessingRepo) List() <-chan application.ProcessingStatus {
+	out := make(chan application.ProcessingStatus)
+
+	go func() {
+		defer close(out)
+
+		var statuses []application.ProcessingStatus
+
+		err := r.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(processingStatusBucket).ForEach(func(k, v []byte) error {
+				var status application.ProcessingStatus
+
+				err := gob.NewDecoder(bytes.NewReader(v)).Decode(&status)
+				if err != nil {
+					return err
+				}
+
+				statuses = append(statuses, status)
+
+				return nil
+			})
+		})
+
+		if err != nil {
+			r.logger.Error("Error iterating bucket",
+				zap.String("bucket", string(processingStatusBucket)),
+				zap.Error(err))
+		}
+
+		for _, status := range statuses {
+			out <- status
+		}
+	}()
+
+	return out
+}
+
+func (r *ProcessingRepo) setupDb() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(processingStatusBucket)
+		return err
+	})
+}
+
+// fileKey builds key for per-file records, slash can't be part of username.
+func fileKey(username, file string) []byte {
+	return []byte(username + "/" + file)
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/horizontal-org/direct-upload/application"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+type ProjectRepoConfig struct {
+	DB *bolt.DB
+}
+
+type ProjectRepo struct {
+	logger *zap.Logger
+	db     *bolt.DB
+}
+
+var projectBucket = []byte("Project")
+
+func NewProjectRepo(config ProjectRepoConfig, logger *zap.Logger) (*ProjectRepo, error) {
+	projectRepo := &ProjectRepo{
+		logger: logger,
+		db:     config.DB,
+	}
+
+	err := projectRepo.setupDb()
+	if err != nil {
+		return nil, err
+	}
+
+	return projectRepo, nil
+}
+
+func (r *ProjectRepo) Save(project *application.Project) error {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(project)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		r.logger.Debug("Save Project in DB", zap.String("project", project.Name))
+
+		return tx.Bucket(projectBucket).Put([]byte(project.Name), buf.Bytes())
+	})
+}
+
+func (r *ProjectRepo) Read(name string) (*application.Project, error) {
+	var project application.Project
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(projectBucket).Get([]byte(name))
+
+		if v == nil {
+			return errNotFound
+		}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(&project)
+	})
+	if err == errNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &project, nil
+}
+
+func (r *ProjectRepo) Delete(name string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		r.logger.Debug("Delete Project in DB", zap.String("project", name))
+
+		return tx.Bucket(projectBucket).Delete([]byte(name))
+	})
+}
+
+func (r *ProjectRepo) List() <-chan application.Project {
+	out := make(chan application.Project)
+
+	go func() {
+		defer close(out)
+
+		err := r.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(projectBucket).ForEach(func(k, v []byte) error {
+				var project application.Project
+
+				err := gob.NewDecoder(bytes.NewReader(v)).Decode(&project)
+				if err != nil {
+					return err
+				}
+
+				out <- project
+
+				return nil
+			})
+		})
+
+		if err != nil {
+			r.logger.Error("Error iterating bucket",
+				zap.String("bucket", string(projectBucket)),
+				zap.Error(err))
+		}
+	}()
+
+	return out
+}
+
+func (r *ProjectRepo) setupDb() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(projectBucket)
+		return err
+	})
+}
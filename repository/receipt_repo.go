@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/horizontal-org/direct-upload/application"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+type ReceiptRepoConfig struct {
+	DB *bolt.DB
+}
+
+// ReceiptRepo keeps receipts keyed by owner and file, like file metadata.
+type ReceiptRepo struct {
+	logger *zap.Logger
+	db     *bolt.DB
+}
+
+var receiptBucket = []byte("Receipts")
+
+func NewReceiptRepo(config ReceiptRepoConfig, logger *zap.Logger) (*ReceiptRepo, error) {
+	receiptRepo := &ReceiptRepo{
+		logger: logger,
+		db:     config.DB,
+	}
+
+	err := receiptRepo.setupDb()
+	if err != nil {
+		return nil, err
+	}
+
+	return receiptRepo, nil
+}
+
+func (r *ReceiptRepo) Save(receipt *application.Receipt) error {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(receipt)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		r.logger.Debug("Update Receipt in DB",
+			zap.String("owner", receipt.Owner()), zap.String("file", receipt.File))
+
+		return tx.Bucket(receiptBucket).Put(fileKey(receipt.Owner(), receipt.File), buf.Bytes())
+	})
+}
+
+func (r *ReceiptRepo) Read(owner, file string) (*application.Receipt, error) {
+	var receipt application.Receipt
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(receiptBucket).Get(fileKey(owner, file))
+
+		if v == nil {
+			return errNotFound
+		}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(&receipt)
+	})
+	if err == errNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &receipt, nil
+}
+
+func (r *ReceiptRepo) setupDb() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(receiptBucket)
+		return err
+	})
+}
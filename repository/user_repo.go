@@ -43,6 +43,42 @@ func (r *UserRepo) Create(user *application.UserAuth) error {
 	return r.Update(user)
 }
 
+// CreateAll stores all users in one transaction, nothing is stored if any of
+// them already exists.
+func (r *UserRepo) CreateAll(users []*application.UserAuth) error {
+	encoded := make([][]byte, len(users))
+
+	for i, user := range users {
+		var buf bytes.Buffer
+
+		err := gob.NewEncoder(&buf).Encode(user)
+		if err != nil {
+			return err
+		}
+
+		encoded[i] = buf.Bytes()
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(userAuthBucket)
+
+		for i, user := range users {
+			if b.Get([]byte(user.Username)) != nil {
+				return application.ErrUsernameExists
+			}
+
+			r.logger.Debug("Create UserAuth in DB", zap.String("username", user.Username))
+
+			err := b.Put([]byte(user.Username), encoded[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 func (r *UserRepo) Read(username string) (*application.UserAuth, error) {
 	var userAuth application.UserAuth
 
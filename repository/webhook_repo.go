@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/horizontal-org/direct-upload/application"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+type WebhookRepoConfig struct {
+	DB *bolt.DB
+}
+
+type WebhookRepo struct {
+	logger *zap.Logger
+	db     *bolt.DB
+}
+
+var webhookDeliveryBucket = []byte("WebhookDelivery")
+
+func NewWebhookRepo(config WebhookRepoConfig, logger *zap.Logger) (*WebhookRepo, error) {
+	webhookRepo := &WebhookRepo{
+		logger: logger,
+		db:     config.DB,
+	}
+
+	err := webhookRepo.setupDb()
+	if err != nil {
+		return nil, err
+	}
+
+	return webhookRepo, nil
+}
+
+func (r *WebhookRepo) Save(delivery *application.WebhookDelivery) error {
+	var buf bytes.Buffer
+
+	err := gob.NewEncoder(&buf).Encode(delivery)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		r.logger.Debug("Save WebhookDelivery in DB", zap.String("id", delivery.ID))
+
+		return tx.Bucket(webhookDeliveryBucket).Put([]byte(delivery.ID), buf.Bytes())
+	})
+}
+
+func (r *WebhookRepo) Read(id string) (*application.WebhookDelivery, error) {
+	var delivery application.WebhookDelivery
+
+	err := r.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(webhookDeliveryBucket).Get([]byte(id))
+
+		if v == nil {
+			return errNotFound
+		}
+
+		return gob.NewDecoder(bytes.NewReader(v)).Decode(&delivery)
+	})
+	if err == errNotFound {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func (r *WebhookRepo) Delete(id string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		r.logger.Debug("Delete WebhookDelivery in DB", zap.String("id", id))
+
+		return tx.Bucket(webhookDeliveryBucket).Delete([]byte(id))
+	})
+}
+
+func (r *WebhookRepo) List() <-chan application.WebhookDelivery {
+	out := make(chan application.WebhookDelivery)
+
+	go func() {
+		defer close(out)
+
+		var deliveries []application.WebhookDelivery
+
+		// collect first so the read transaction isn't held while consumers
+		// write back to the bucket
+		err := r.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(webhookDeliveryBucket).ForEach(func(k, v []byte) error {
+				var delivery application.WebhookDelivery
+
+				err := gob.NewDecoder(bytes.NewReader(v)).Decode(&delivery)
+				if err != nil {
+					return err
+				}
+
+				deliveries = append(deliveries, delivery)
+
+				return nil
+			})
+		})
+
+		if err != nil {
+			r.logger.Error("Error iterating bucket",
+				zap.String("bucket", string(webhookDeliveryBucket)),
+				zap.Error(err))
+		}
+
+		for _, delivery := range deliveries {
+			out <- delivery
+		}
+	}()
+
+	return out
+}
+
+func (r *WebhookRepo) setupDb() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(webhookDeliveryBucket)
+		return err
+	})
+}
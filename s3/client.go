@@ -0,0 +1,361 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client is a minimal S3 REST client covering the calls needed by
+// application.S3FileStore. It works with AWS S3 and S3-compatible servers
+// such as MinIO.
+type Client struct {
+	config   Config
+	endpoint *url.URL
+	http     *http.Client
+	now      func() time.Time
+}
+
+type Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+type ErrorResponse struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func NewClient(config Config) (*Client, error) {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint must be absolute url, got %q", config.Endpoint)
+	}
+
+	return &Client{
+		config:   config,
+		endpoint: endpoint,
+		http:     &http.Client{Timeout: 5 * time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (c *Client) HeadObject(key string) (int64, bool, error) {
+	res, err := c.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return 0, false, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return 0, false, &ErrorResponse{StatusCode: res.StatusCode, Code: res.Status}
+	}
+
+	return res.ContentLength, true, nil
+}
+
+func (c *Client) GetObject(key string) (io.ReadCloser, error) {
+	res, err := c.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		//noinspection GoUnhandledErrorResult
+		res.Body.Close()
+		return nil, application.ErrObjectNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, readError(res)
+	}
+
+	return res.Body, nil
+}
+
+func (c *Client) PutObject(key string, data []byte) error {
+	res, err := c.do(http.MethodPut, key, nil, data)
+	if err != nil {
+		return err
+	}
+
+	return expectOK(res)
+}
+
+func (c *Client) DeleteObject(key string) error {
+	res, err := c.do(http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		//noinspection GoUnhandledErrorResult
+		res.Body.Close()
+		return nil
+	}
+
+	return expectOK(res)
+}
+
+func (c *Client) CreateMultipartUpload(key string) (string, error) {
+	res, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", readError(res)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	var result initiateMultipartUploadResult
+
+	err = xml.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+
+	return result.UploadID, nil
+}
+
+func (c *Client) UploadPart(key, uploadID string, number int, data []byte) (string, error) {
+	query := url.Values{
+		"partNumber": {strconv.Itoa(number)},
+		"uploadId":   {uploadID},
+	}
+
+	res, err := c.do(http.MethodPut, key, query, data)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", readError(res)
+	}
+	//noinspection GoUnhandledErrorResult
+	res.Body.Close()
+
+	return res.Header.Get("ETag"), nil
+}
+
+func (c *Client) CompleteMultipartUpload(key, uploadID string, parts []application.ObjectPart) error {
+	var body completeMultipartUpload
+
+	for _, part := range parts {
+		body.Parts = append(body.Parts, completedPart{PartNumber: part.Number, ETag: part.ETag})
+	}
+
+	data, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, data)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return readError(res)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	// S3 can report an error with 200 status once it has started responding
+	payload, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Contains(payload, []byte("<Error>")) {
+		s3Err := &ErrorResponse{StatusCode: res.StatusCode}
+		_ = xml.Unmarshal(payload, s3Err)
+		return s3Err
+	}
+
+	return nil
+}
+
+func (c *Client) AbortMultipartUpload(key, uploadID string) error {
+	res, err := c.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		//noinspection GoUnhandledErrorResult
+		res.Body.Close()
+		return nil
+	}
+
+	return expectOK(res)
+}
+
+func (c *Client) ListObjects(prefix string) ([]application.ObjectInfo, error) {
+	var objects []application.ObjectInfo
+
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+	}
+
+	for {
+		res, err := c.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode != http.StatusOK {
+			return nil, readError(res)
+		}
+
+		var result listBucketResult
+
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		//noinspection GoUnhandledErrorResult
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			objects = append(objects, application.ObjectInfo{
+				Key:      content.Key,
+				Size:     content.Size,
+				Modified: content.LastModified,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (c *Client) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := c.objectURL(key, query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+
+	c.sign(req, hashHex(body))
+
+	return c.http.Do(req)
+}
+
+func (c *Client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	escapedKey := uriEncode(key, false)
+
+	if c.config.PathStyle {
+		base := strings.TrimSuffix(c.endpoint.Path, "/")
+		escapedBase := strings.TrimSuffix(c.endpoint.EscapedPath(), "/")
+
+		u.Path = base + "/" + c.config.Bucket + "/" + key
+		u.RawPath = escapedBase + "/" + uriEncode(c.config.Bucket, true) + "/" + escapedKey
+	} else {
+		u.Host = c.config.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escapedKey
+	}
+
+	u.RawQuery = canonicalQuery(query)
+
+	return &u
+}
+
+func expectOK(res *http.Response) error {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return readError(res)
+	}
+
+	//noinspection GoUnhandledErrorResult
+	res.Body.Close()
+
+	return nil
+}
+
+func readError(res *http.Response) error {
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	s3Err := &ErrorResponse{StatusCode: res.StatusCode, Code: res.Status}
+
+	payload, err := ioutil.ReadAll(res.Body)
+	if err == nil && len(payload) > 0 {
+		_ = xml.Unmarshal(payload, s3Err)
+	}
+
+	return s3Err
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// ACMEConfig enables automatic certificates from Let's Encrypt or another
+// ACME CA for Domains.
+type ACMEConfig struct {
+	Domains []string
+	Email   string
+	// CacheDir keeps account key and certificates between restarts.
+	CacheDir string
+	// DirectoryURL defaults to Let's Encrypt production directory.
+	DirectoryURL string
+	// HTTPAddress serves HTTP-01 challenges and redirects other requests to
+	// HTTPS, empty leaves only TLS-ALPN-01 challenges on the main address.
+	HTTPAddress string
+	// CAFile adds roots trusted when talking to the ACME server, ie. Pebble
+	// test CA.
+	CAFile string
+}
+
+func (c *ACMEConfig) enabled() bool {
+	return c != nil && len(c.Domains) > 0
+}
+
+func (s *HttpServer) newACMEManager() (*autocert.Manager, error) {
+	cfg := s.config.ACME
+
+	if cfg.CacheDir == "" {
+		return nil, fmt.Errorf("acme: cache dir not set")
+	}
+
+	client := &acme.Client{
+		DirectoryURL: cfg.DirectoryURL,
+		UserAgent:    "direct-upload",
+	}
+
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = acme.LetsEncryptURL
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("acme: no certificates in %s", cfg.CAFile)
+		}
+
+		client.HTTPClient = &http.Client{
+			Timeout: time.Minute,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: roots},
+			},
+		}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Email:      cfg.Email,
+		Client:     client,
+	}, nil
+}
+
+// listenACME serves HTTPS with certificates obtained and renewed by manager.
+func (s *HttpServer) listenACME(srv *http.Server) error {
+	manager, err := s.newACMEManager()
+	if err != nil {
+		return err
+	}
+
+	srv.TLSConfig = newTLSConfig()
+	srv.TLSConfig.GetCertificate = manager.GetCertificate
+	srv.TLSConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+
+	if s.config.ClientAuth.enabled() {
+		err = s.configureClientAuth(srv.TLSConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.config.ACME.HTTPAddress != "" {
+		challenges := &http.Server{
+			Addr:              s.config.ACME.HTTPAddress,
+			Handler:           manager.HTTPHandler(nil),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			s.logger.Fatal("Error on ACME challenge server", zap.Error(challenges.ListenAndServe()))
+		}()
+	}
+
+	s.logger.Info("Using ACME certificates",
+		zap.Strings("domains", s.config.ACME.Domains), zap.String("directory", manager.Client.DirectoryURL))
+
+	return srv.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"crypto/tls"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestACME obtains a certificate from Pebble, https://github.com/letsencrypt/pebble.
+// Autocert waits for issuance using order URL from finalize response, which
+// Pebble sends up to v2.6.0. Autocert only accepts names with a dot, Pebble
+// needs the test domain resolved to 127.0.0.1, ie. by pebble-challtestsrv:
+//
+//	pebble-challtestsrv -defaultIPv4 127.0.0.1 -http01 "" -https01 "" -tlsalpn01 "" -doh ""
+//	pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053
+//	PEBBLE_DIRECTORY=https://localhost:14000/dir PEBBLE_CA=test/certs/pebble.minica.pem go test ./server/http
+//
+// Pebble validates challenges on ports 5001 (TLS-ALPN-01) and 5002 (HTTP-01),
+// where the test server listens.
+func TestACME(t *testing.T) {
+	directory := os.Getenv("PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("PEBBLE_DIRECTORY not set")
+	}
+
+	domain := os.Getenv("ACME_TEST_DOMAIN")
+	if domain == "" {
+		domain = "direct-upload.test"
+	}
+
+	cache, err := ioutil.TempDir("", "direct-upload-acme")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(cache)
+
+	srv := NewServer(Config{
+		Address: "127.0.0.1:5001",
+		ACME: &ACMEConfig{
+			Domains:      []string{domain},
+			CacheDir:     cache,
+			DirectoryURL: directory,
+			HTTPAddress:  "127.0.0.1:5002",
+			CAFile:       os.Getenv("PEBBLE_CA"),
+		},
+	}, nil, nil, nil, nil, zaptest.NewLogger(t))
+
+	go func() {
+		_ = srv.listen(httprouter.New())
+	}()
+
+	var conn *tls.Conn
+
+	for i := 0; i < 60; i++ {
+		conn, err = tls.Dial("tcp", "127.0.0.1:5001", &tls.Config{
+			ServerName:         domain,
+			InsecureSkipVerify: true,
+		})
+		if err == nil {
+			break
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	cert := conn.ConnectionState().PeerCertificates[0]
+
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != domain {
+		t.Errorf("Unexpected certificate names %v", cert.DNSNames)
+	}
+
+	if !strings.Contains(cert.Issuer.CommonName, "Pebble") {
+		t.Errorf("Certificate not issued by Pebble: %s", cert.Issuer)
+	}
+
+	if _, err := os.Stat(cache + "/" + domain); err != nil {
+		t.Errorf("Certificate not cached: %v", err)
+	}
+}
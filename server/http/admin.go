@@ -0,0 +1,481 @@
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/horizontal-org/direct-upload/db"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxAdminRequestSize limits JSON request bodies of the admin API.
+const maxAdminRequestSize = 1 << 20
+
+// ErrAdminPlainHTTP refuses to send admin credentials and backups over the
+// network unencrypted.
+var ErrAdminPlainHTTP = errors.New("admin API needs cert and key unless it listens on loopback address")
+
+// AdminConfig configures admin REST API, served on its own address so it can
+// be kept off the network uploads come from.
+type AdminConfig struct {
+	Address        string
+	CertFile       string
+	PrivateKeyFile string
+	// Tokens accepted as "Authorization: Bearer <token>", users with admin
+	// role authenticate with their credentials instead.
+	Tokens []string
+}
+
+// AdminServer serves JSON REST API for user and server administration, doing
+// the same operations as RPC commands.
+type AdminServer struct {
+	config      AdminConfig
+	authManager *application.AuthManager
+	fileStore   application.FileStore
+	bc          *db.BoltConnection
+	httpServer  *HttpServer
+	audit       *application.AuditLog
+	started     time.Time
+	logger      *zap.Logger
+}
+
+type adminUser struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type adminNewUser struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type adminPassword struct {
+	Password string `json:"password"`
+}
+
+type adminRole struct {
+	Role string `json:"role"`
+}
+
+type adminFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Closed  bool      `json:"closed"`
+	Updated time.Time `json:"updated"`
+}
+
+type adminCertificate struct {
+	File     string    `json:"file"`
+	Names    []string  `json:"names"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+}
+
+type adminStatus struct {
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Users         int               `json:"users"`
+	TLS           string            `json:"tls"`
+	Certificate   *adminCertificate `json:"certificate,omitempty"`
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+func NewAdminServer(cfg AdminConfig, am *application.AuthManager, fs application.FileStore, bc *db.BoltConnection,
+	httpServer *HttpServer, audit *application.AuditLog, logger *zap.Logger) *AdminServer {
+	return &AdminServer{
+		config:      cfg,
+		authManager: am,
+		fileStore:   fs,
+		bc:          bc,
+		httpServer:  httpServer,
+		audit:       audit,
+		started:     time.Now(),
+		logger:      logger,
+	}
+}
+
+func (s *AdminServer) Start() {
+	s.logger.Sugar().Infof("Starting Tella admin API server on %s", s.config.Address)
+
+	s.logger.Fatal("Error on Tella admin API server start", zap.Error(s.listen(s.router())))
+}
+
+func (s *AdminServer) router() *httprouter.Router {
+	auth := NewTokenAuthMiddleware(s.logger, s.config.Tokens,
+		NewAuthorizationMiddleware(s.logger, PermissionManageUsers, NewBasicAuthMiddleware(s.logger, s.authManager)))
+	pacifier := NewPanicMiddleware(s.logger)
+	logger := NewLoggerMiddleware(s.logger)
+
+	restricted := func(h httprouter.Handle) httprouter.Handle {
+		return pacifier.Handle(logger.Handle(auth.Handle(h)))
+	}
+
+	router := httprouter.New()
+	router.GET("/api/v1/openapi.json", pacifier.Handle(s.handleOpenAPI))
+	router.GET("/api/v1/status", restricted(s.handleStatus))
+	router.GET("/api/v1/users", restricted(s.handleListUsers))
+	router.POST("/api/v1/users", restricted(s.handleAddUser))
+	router.GET("/api/v1/users/:username", restricted(s.handleGetUser))
+	router.DELETE("/api/v1/users/:username", restricted(s.handleDeleteUser))
+	router.PUT("/api/v1/users/:username/password", restricted(s.handleSetPassword))
+	router.PUT("/api/v1/users/:username/role", restricted(s.handleSetRole))
+	router.GET("/api/v1/users/:username/files", restricted(s.handleListFiles))
+	router.GET("/api/v1/backup", restricted(s.handleBackup))
+
+	return router
+}
+
+func (s *AdminServer) listen(router *httprouter.Router) error {
+	srv := http.Server{
+		Addr:              s.config.Address,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if s.config.CertFile != "" && s.config.PrivateKeyFile != "" {
+		srv.TLSConfig = newTLSConfig()
+
+		return srv.ListenAndServeTLS(s.config.CertFile, s.config.PrivateKeyFile)
+	}
+
+	if !loopbackAddress(s.config.Address) {
+		return ErrAdminPlainHTTP
+	}
+
+	return srv.ListenAndServe()
+}
+
+// loopbackAddress reports whether address accepts local connections only.
+func loopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *AdminServer) handleOpenAPI(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	w.Header().Set("content-type", "application/json")
+	_, _ = w.Write([]byte(adminOpenAPI))
+}
+
+func (s *AdminServer) handleStatus(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	usernames, err := s.authManager.ListUsernames()
+	if err != nil {
+		s.sendError(w, err)
+		return
+	}
+
+	status := adminStatus{
+		UptimeSeconds: int64(time.Since(s.started).Seconds()),
+		Users:         len(usernames),
+		TLS:           s.httpServer.TLSMode(),
+	}
+
+	if cert := s.httpServer.CertificateStatus(); cert != nil {
+		status.Certificate = &adminCertificate{
+			File:     cert.File,
+			Names:    cert.Names,
+			NotAfter: cert.NotAfter,
+			DaysLeft: cert.DaysLeft,
+		}
+	}
+
+	sendJSON(w, http.StatusOK, status)
+}
+
+func (s *AdminServer) handleListUsers(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	usernames, err := s.authManager.ListUsernames()
+	if err != nil {
+		s.sendError(w, err)
+		return
+	}
+
+	users := []adminUser{}
+	for _, username := range usernames {
+		user, err := s.authManager.GetUser(username)
+		if err != nil {
+			s.sendError(w, err)
+			return
+		}
+
+		// deleted since listed
+		if user != nil {
+			users = append(users, adminUser{Username: user.Username, Role: user.Role})
+		}
+	}
+
+	sendJSON(w, http.StatusOK, users)
+}
+
+func (s *AdminServer) handleAddUser(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var user adminNewUser
+
+	if !decodeJSON(w, r, &user) {
+		return
+	}
+
+	err := s.authManager.AddUser(user.Username, user.Password)
+	if err != nil {
+		s.sendError(w, err)
+		return
+	}
+
+	s.audit.Record(adminActor(r), application.AuditUserCreated, user.Username, "")
+
+	sendJSON(w, http.StatusCreated, adminUser{Username: user.Username, Role: application.RoleUploader})
+}
+
+func (s *AdminServer) handleGetUser(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+	user, ok := s.existingUser(w, ps)
+	if !ok {
+		return
+	}
+
+	sendJSON(w, http.StatusOK, adminUser{Username: user.Username, Role: user.Role})
+}
+
+func (s *AdminServer) handleDeleteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	user, ok := s.existingUser(w, ps)
+	if !ok {
+		return
+	}
+
+	err := s.authManager.Delete(user.Username)
+	if err != nil {
+		s.sendError(w, err)
+		return
+	}
+
+	s.audit.Record(adminActor(r), application.AuditUserDeleted, user.Username, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) handleSetPassword(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var password adminPassword
+
+	if !decodeJSON(w, r, &password) {
+		return
+	}
+
+	err := s.authManager.ChangePassword(ps.ByName("username"), password.Password)
+	if err != nil {
+		s.sendError(w, err)
+		return
+	}
+
+	s.audit.Record(adminActor(r), application.AuditPasswordChanged, ps.ByName("username"), "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) handleSetRole(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var role adminRole
+
+	if !decodeJSON(w, r, &role) {
+		return
+	}
+
+	err := s.authManager.SetRole(ps.ByName("username"), role.Role)
+	if err != nil {
+		s.sendError(w, err)
+		return
+	}
+
+	s.audit.Record(adminActor(r), application.AuditRoleChanged, ps.ByName("username"), role.Role)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *AdminServer) handleListFiles(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	user, ok := s.existingUser(w, ps)
+	if !ok {
+		return
+	}
+
+	ctx := application.NewContext(r.Context(), user)
+
+	infos, err := s.fileStore.ListFiles(ctx)
+	if err != nil {
+		s.sendError(w, err)
+		return
+	}
+
+	files := []adminFile{}
+	for _, info := range infos {
+		files = append(files, adminFile{Name: info.Name, Size: info.Size, Closed: info.Closed, Updated: info.Updated})
+	}
+
+	sendJSON(w, http.StatusOK, files)
+}
+
+// handleBackup streams the database, so backups are never written to paths
+// on the server.
+func (s *AdminServer) handleBackup(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("content-type", "application/octet-stream")
+	w.Header().Set("content-disposition",
+		fmt.Sprintf("attachment; filename=\"direct-upload-%s.db\"", time.Now().UTC().Format("20060102-150405")))
+
+	_, err := s.bc.WriteBackup(w)
+	if err != nil {
+		// headers are sent already, client gets truncated body
+		s.logger.Error("Error while streaming backup", zap.Error(err))
+		return
+	}
+
+	s.audit.Record(adminActor(r), application.AuditBackupWritten, "admin API", "")
+}
+
+// adminActor identifies caller in audit log, "admin:<username>" for Basic auth
+// and "admin-token" for bearer token.
+func adminActor(r *http.Request) string {
+	if user, ok := application.UserFromContext(r.Context()); ok {
+		return "admin:" + user.Username
+	}
+
+	return "admin-token"
+}
+
+// existingUser returns user from the path, replying with error unless the
+// user exists.
+func (s *AdminServer) existingUser(w http.ResponseWriter, ps httprouter.Params) (*application.User, bool) {
+	username := ps.ByName("username")
+
+	if !application.ValidUsername(username) {
+		s.sendError(w, application.ErrUsernameNotValid)
+		return nil, false
+	}
+
+	user, err := s.authManager.GetUser(username)
+	if err != nil {
+		s.sendError(w, err)
+		return nil, false
+	}
+
+	if user == nil {
+		s.sendError(w, application.ErrUsernameNotFound)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (s *AdminServer) sendError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	if _, ok := err.(*application.PasswordPolicyError); ok {
+		sendJSON(w, http.StatusBadRequest, adminError{Error: err.Error()})
+		return
+	}
+
+	switch err {
+	case application.ErrUsernameNotValid, application.ErrRoleNotValid:
+		status = http.StatusBadRequest
+	case application.ErrUsernameNotFound:
+		status = http.StatusNotFound
+	case application.ErrUsernameExists:
+		status = http.StatusConflict
+	default:
+		s.logger.Error("Admin API error", zap.Error(err))
+		err = errors.New(http.StatusText(status))
+	}
+
+	sendJSON(w, status, adminError{Error: err.Error()})
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminRequestSize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		sendJSON(w, http.StatusBadRequest, adminError{Error: "invalid request body: " + err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func sendJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// TokenAuthMiddleware accepts requests with one of configured bearer tokens,
+// requests without bearer token are passed to next.
+type TokenAuthMiddleware struct {
+	tokens [][sha256.Size]byte
+	next   Middleware
+	logger *zap.Logger
+}
+
+func NewTokenAuthMiddleware(logger *zap.Logger, tokens []string, next Middleware) *TokenAuthMiddleware {
+	m := &TokenAuthMiddleware{
+		next:   next,
+		logger: logger,
+	}
+
+	for _, token := range tokens {
+		if token != "" {
+			m.tokens = append(m.tokens, sha256.Sum256([]byte(token)))
+		}
+	}
+
+	return m
+}
+
+func (m *TokenAuthMiddleware) Handle(h httprouter.Handle) httprouter.Handle {
+	fallback := m.next.Handle(h)
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		header := r.Header.Get("Authorization")
+
+		if !strings.HasPrefix(header, "Bearer ") {
+			fallback(w, r, ps)
+			return
+		}
+
+		if m.valid(strings.TrimPrefix(header, "Bearer ")) {
+			h(w, r, ps)
+			return
+		}
+
+		m.logger.Debug("Bad admin API token", zap.String("remote", r.RemoteAddr))
+
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		sendJSON(w, http.StatusUnauthorized, adminError{Error: http.StatusText(http.StatusUnauthorized)})
+	}
+}
+
+// valid compares hashes in constant time, so neither token content nor
+// length leaks through timing.
+func (m *TokenAuthMiddleware) valid(token string) bool {
+	hash := sha256.Sum256([]byte(token))
+
+	valid := 0
+	for _, t := range m.tokens {
+		valid |= subtle.ConstantTimeCompare(hash[:], t[:])
+	}
+
+	return valid == 1
+}
@@ -0,0 +1,189 @@
+package http
+
+// adminOpenAPI describes admin REST API, served unauthenticated at
+// /api/v1/openapi.json.
+const adminOpenAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Tella direct upload admin API",
+    "version": "1.0.0",
+    "description": "Manages users and the server, the same operations as the command line tools."
+  },
+  "servers": [{"url": "/api/v1"}],
+  "security": [{"token": []}, {"admin": []}],
+  "paths": {
+    "/status": {
+      "get": {
+        "summary": "Server status",
+        "responses": {
+          "200": {"description": "Status", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Status"}}}},
+          "401": {"$ref": "#/components/responses/Unauthorized"}
+        }
+      }
+    },
+    "/users": {
+      "get": {
+        "summary": "List users",
+        "responses": {
+          "200": {"description": "Users", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/User"}}}}},
+          "401": {"$ref": "#/components/responses/Unauthorized"}
+        }
+      },
+      "post": {
+        "summary": "Add user",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/NewUser"}}}},
+        "responses": {
+          "201": {"description": "User added", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "409": {"description": "Username exists", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+        }
+      }
+    },
+    "/users/{username}": {
+      "parameters": [{"$ref": "#/components/parameters/Username"}],
+      "get": {
+        "summary": "Get user",
+        "responses": {
+          "200": {"description": "User", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/User"}}}},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      },
+      "delete": {
+        "summary": "Delete user, uploaded files are kept",
+        "responses": {
+          "204": {"description": "User deleted"},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/users/{username}/password": {
+      "parameters": [{"$ref": "#/components/parameters/Username"}],
+      "put": {
+        "summary": "Reset password",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Password"}}}},
+        "responses": {
+          "204": {"description": "Password changed"},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/users/{username}/role": {
+      "parameters": [{"$ref": "#/components/parameters/Username"}],
+      "put": {
+        "summary": "Change role",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Role"}}}},
+        "responses": {
+          "204": {"description": "Role changed"},
+          "400": {"$ref": "#/components/responses/BadRequest"},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "403": {"$ref": "#/components/responses/Forbidden"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/users/{username}/files": {
+      "parameters": [{"$ref": "#/components/parameters/Username"}],
+      "get": {
+        "summary": "List files of user, including uploads in progress",
+        "responses": {
+          "200": {"description": "Files", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/File"}}}}},
+          "401": {"$ref": "#/components/responses/Unauthorized"},
+          "404": {"$ref": "#/components/responses/NotFound"}
+        }
+      }
+    },
+    "/backup": {
+      "get": {
+        "summary": "Download consistent copy of the database",
+        "responses": {
+          "200": {"description": "Bolt database", "content": {"application/octet-stream": {"schema": {"type": "string", "format": "binary"}}}},
+          "401": {"$ref": "#/components/responses/Unauthorized"}
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "summary": "This document",
+        "security": [],
+        "responses": {
+          "200": {"description": "OpenAPI description", "content": {"application/json": {}}}
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "token": {"type": "http", "scheme": "bearer"},
+      "admin": {"type": "http", "scheme": "basic", "description": "Credentials of a user with admin role"}
+    },
+    "parameters": {
+      "Username": {"name": "username", "in": "path", "required": true, "schema": {"type": "string"}}
+    },
+    "responses": {
+      "BadRequest": {"description": "Invalid username, request body or password rejected by password policy", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "Unauthorized": {"description": "Missing or wrong credentials", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+      "Forbidden": {"description": "User is not an admin"},
+      "NotFound": {"description": "Username not found", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "User": {
+        "type": "object",
+        "properties": {"username": {"type": "string"}, "role": {"$ref": "#/components/schemas/RoleName"}},
+        "required": ["username", "role"]
+      },
+      "RoleName": {"type": "string", "enum": ["uploader", "reviewer", "admin"]},
+      "Role": {
+        "type": "object",
+        "properties": {"role": {"$ref": "#/components/schemas/RoleName"}},
+        "required": ["role"]
+      },
+      "NewUser": {
+        "type": "object",
+        "properties": {"username": {"type": "string"}, "password": {"type": "string"}},
+        "required": ["username", "password"]
+      },
+      "Password": {
+        "type": "object",
+        "properties": {"password": {"type": "string"}},
+        "required": ["password"]
+      },
+      "File": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "size": {"type": "integer", "format": "int64"},
+          "closed": {"type": "boolean"},
+          "updated": {"type": "string", "format": "date-time"}
+        }
+      },
+      "Status": {
+        "type": "object",
+        "properties": {
+          "uptime_seconds": {"type": "integer", "format": "int64"},
+          "users": {"type": "integer"},
+          "tls": {"type": "string", "enum": ["acme", "files", "off"]},
+          "certificate": {
+            "type": "object",
+            "properties": {
+              "file": {"type": "string"},
+              "names": {"type": "array", "items": {"type": "string"}},
+              "not_after": {"type": "string", "format": "date-time"},
+              "days_left": {"type": "integer"}
+            }
+          }
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {"error": {"type": "string"}},
+        "required": ["error"]
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/horizontal-org/direct-upload/db"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type adminFixture struct {
+	server *httptest.Server
+	am     *application.AuthManager
+	dir    string
+}
+
+// newAdminFixture serves admin API, bc is nil unless backups are tested as
+// the database is opened once per process.
+func newAdminFixture(t *testing.T, withDB bool) *adminFixture {
+	logger := zaptest.NewLogger(t)
+
+	dir, err := ioutil.TempDir("", "direct-upload-admin")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	events := application.NewEventBus(logger)
+
+	am := application.NewAuthManager(logger, &memAuthRepo{users: map[string]application.UserAuth{}}, events)
+	fs := application.NewMemoryFileStore(application.MemoryFileStoreConfig{}, events, logger)
+
+	var bc *db.BoltConnection
+	if withDB {
+		bc = db.NewBoltConnection(logger, filepath.Join(dir, "direct-upload.db"))
+	}
+
+	admin := NewAdminServer(AdminConfig{Tokens: []string{"t0ken"}}, am, fs, bc,
+		NewServer(Config{}, am, nil, fs, nil, logger), nil, logger)
+
+	return &adminFixture{server: httptest.NewServer(admin.router()), am: am, dir: dir}
+}
+
+func (f *adminFixture) close() {
+	f.server.Close()
+	_ = os.RemoveAll(f.dir)
+}
+
+// do sends JSON body and decodes JSON response into out, unless it is nil.
+func (f *adminFixture) do(t *testing.T, method, path, token string, body, out interface{}) int {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, _ := http.NewRequest(method, f.server.URL+"/api/v1"+path, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := f.server.Client().Do(req)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Error("Error while running test", err)
+		}
+	}
+
+	return res.StatusCode
+}
+
+func TestAdminAuthentication(t *testing.T) {
+	f := newAdminFixture(t, false)
+	defer f.close()
+
+	for _, token := range []string{"", "wrong", "t0ke"} {
+		if status := f.do(t, http.MethodGet, "/users", token, nil, nil); status != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %d", token, status)
+		}
+	}
+
+	if status := f.do(t, http.MethodGet, "/users", "t0ken", nil, nil); status != http.StatusOK {
+		t.Errorf("Expected 200, got %d", status)
+	}
+
+	var spec map[string]interface{}
+	if status := f.do(t, http.MethodGet, "/openapi.json", "", nil, &spec); status != http.StatusOK ||
+		spec["openapi"] != "3.0.3" {
+		t.Errorf("Expected OpenAPI description, got %d %v", status, spec["openapi"])
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	f := newAdminFixture(t, false)
+	defer f.close()
+
+	newUser := adminNewUser{Username: "alice", Password: testPassword}
+
+	if status := f.do(t, http.MethodPost, "/users", "t0ken", newUser, nil); status != http.StatusCreated {
+		t.Errorf("Expected 201, got %d", status)
+	}
+
+	if status := f.do(t, http.MethodPost, "/users", "t0ken", newUser, nil); status != http.StatusConflict {
+		t.Errorf("Expected 409 for existing user, got %d", status)
+	}
+
+	invalid := adminNewUser{Username: "../alice", Password: testPassword}
+	if status := f.do(t, http.MethodPost, "/users", "t0ken", invalid, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid username, got %d", status)
+	}
+
+	weak := adminNewUser{Username: "bob", Password: "password1"}
+	if status := f.do(t, http.MethodPost, "/users", "t0ken", weak, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for weak password, got %d", status)
+	}
+
+	var users []adminUser
+	if f.do(t, http.MethodGet, "/users", "t0ken", nil, &users); len(users) != 1 || users[0].Username != "alice" {
+		t.Errorf("Unexpected users %+v", users)
+	}
+
+	password := adminPassword{Password: "changed-harbor-lantern"}
+	if status := f.do(t, http.MethodPut, "/users/alice/password", "t0ken", password, nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", status)
+	}
+
+	if ok, _ := f.am.CheckPassword("alice", "changed-harbor-lantern"); !ok {
+		t.Error("Password not changed")
+	}
+
+	if status := f.do(t, http.MethodPut, "/users/bob/password", "t0ken", password, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown user, got %d", status)
+	}
+
+	var files []adminFile
+	if status := f.do(t, http.MethodGet, "/users/alice/files", "t0ken", nil, &files); status != http.StatusOK || len(files) != 0 {
+		t.Errorf("Expected no files, got %d %+v", status, files)
+	}
+
+	var status adminStatus
+	if f.do(t, http.MethodGet, "/status", "t0ken", nil, &status); status.Users != 1 || status.TLS != "off" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	if status := f.do(t, http.MethodDelete, "/users/alice", "t0ken", nil, nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", status)
+	}
+
+	if status := f.do(t, http.MethodGet, "/users/alice", "t0ken", nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for deleted user, got %d", status)
+	}
+}
+
+func TestAdminBackup(t *testing.T) {
+	f := newAdminFixture(t, true)
+	defer f.close()
+
+	req, _ := http.NewRequest(http.MethodGet, f.server.URL+"/api/v1/backup", nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+
+	res, err := f.server.Client().Do(req)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("content-disposition"), "attachment") {
+		t.Errorf("Unexpected response %d %v", res.StatusCode, res.Header)
+	}
+
+	// bolt pages are at least 4 KiB, meta page holds magic 0xED0CDAED
+	if len(data) < 4096 || !bytes.Contains(data[:4096], []byte{0xED, 0xDA, 0x0C, 0xED}) {
+		t.Errorf("Backup is not a bolt database, %d bytes", len(data))
+	}
+}
+
+func TestAdminPlainHTTPOnLoopbackOnly(t *testing.T) {
+	for address, allowed := range map[string]bool{
+		"127.0.0.1:8081": true,
+		"[::1]:8081":     true,
+		"localhost:8081": true,
+		":8081":          false,
+		"0.0.0.0:8081":   false,
+		"10.0.0.5:8081":  false,
+	} {
+		if loopbackAddress(address) != allowed {
+			t.Errorf("Expected plain HTTP on %s allowed %v", address, allowed)
+		}
+	}
+
+	server := &AdminServer{config: AdminConfig{Address: "0.0.0.0:0"}}
+
+	if err := server.listen(server.router()); err != ErrAdminPlainHTTP {
+		t.Error("Expected admin API refused without TLS, got", err)
+	}
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// Permission is an action a role may be allowed to do.
+type Permission int
+
+const (
+	// PermissionUpload allows uploads to user's own directory.
+	PermissionUpload Permission = iota
+	// PermissionReview allows reading closed files of other users.
+	PermissionReview
+	// PermissionManageUsers allows admin API.
+	PermissionManageUsers
+)
+
+var rolePermissions = map[string][]Permission{
+	application.RoleUploader: {PermissionUpload},
+	application.RoleReviewer: {PermissionUpload, PermissionReview},
+	application.RoleAdmin:    {PermissionUpload, PermissionReview, PermissionManageUsers},
+}
+
+// Allowed reports whether user's role grants the permission.
+func Allowed(user *application.User, permission Permission) bool {
+	if user == nil {
+		return false
+	}
+
+	for _, p := range rolePermissions[user.Role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthorizationMiddleware authenticates requests with auth and rejects users
+// whose role doesn't grant the permission.
+type AuthorizationMiddleware struct {
+	permission Permission
+	auth       Middleware
+	logger     *zap.Logger
+}
+
+func NewAuthorizationMiddleware(logger *zap.Logger, permission Permission, auth Middleware) *AuthorizationMiddleware {
+	return &AuthorizationMiddleware{
+		permission: permission,
+		auth:       auth,
+		logger:     logger,
+	}
+}
+
+func (m *AuthorizationMiddleware) Handle(h httprouter.Handle) httprouter.Handle {
+	return m.auth.Handle(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		user, ok := application.UserFromContext(r.Context())
+		if !ok {
+			errorForbidden(w)
+			return
+		}
+
+		if !Allowed(user, m.permission) {
+			m.logger.Debug("Permission denied", zap.String("username", user.Username),
+				zap.String("role", user.Role), zap.Int("permission", int(m.permission)))
+			errorForbidden(w)
+			return
+		}
+
+		h(w, r, ps)
+	})
+}
+
+// ProjectAuthorizationMiddleware authenticates requests with auth and lets
+// the user work in the project from the path. Uploads need membership,
+// reviewing needs reviewer role in the project or admin role.
+type ProjectAuthorizationMiddleware struct {
+	permission Permission
+	projects   *application.ProjectManager
+	auth       Middleware
+	logger     *zap.Logger
+}
+
+func NewProjectAuthorizationMiddleware(logger *zap.Logger, permission Permission, projects *application.ProjectManager,
+	auth Middleware) *ProjectAuthorizationMiddleware {
+	return &ProjectAuthorizationMiddleware{
+		permission: permission,
+		projects:   projects,
+		auth:       auth,
+		logger:     logger,
+	}
+}
+
+func (m *ProjectAuthorizationMiddleware) Handle(h httprouter.Handle) httprouter.Handle {
+	return m.auth.Handle(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		user, ok := application.UserFromContext(r.Context())
+		if !ok {
+			errorForbidden(w)
+			return
+		}
+
+		project, err := m.projects.Get(ps.ByName("project"))
+		if err == application.ErrProjectNotValid {
+			errorValidation(w)
+			return
+		}
+
+		if err != nil {
+			m.logger.Error("Error while reading project", zap.Error(err))
+			errorInternal(w)
+			return
+		}
+
+		if project == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !projectAllowed(project, user, m.permission) {
+			m.logger.Debug("Project permission denied", zap.String("username", user.Username),
+				zap.String("project", project.Name), zap.Int("permission", int(m.permission)))
+			errorForbidden(w)
+			return
+		}
+
+		member := *user
+		member.Project = project.Name
+
+		h(w, r.WithContext(application.NewContext(r.Context(), &member)), ps)
+	})
+}
+
+func projectAllowed(project *application.Project, user *application.User, permission Permission) bool {
+	switch permission {
+	case PermissionUpload:
+		return project.IsMember(user.Username)
+	case PermissionReview:
+		return project.IsReviewer(user.Username) || user.Role == application.RoleAdmin
+	}
+
+	return false
+}
@@ -0,0 +1,232 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/horizontal-org/direct-upload/application"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPassword is accepted by the default password policy.
+const testPassword = "plum-harbor-lantern"
+
+// newRolesFixture serves uploads of alice (uploader), bob (reviewer) and
+// carol (admin), all with testPassword.
+func newRolesFixture(t *testing.T) (*httptest.Server, *application.AuthManager) {
+	logger := zaptest.NewLogger(t)
+	events := application.NewEventBus(logger)
+
+	am := application.NewAuthManager(logger, &memAuthRepo{users: map[string]application.UserAuth{}}, events)
+	fs := application.NewMemoryFileStore(application.MemoryFileStoreConfig{}, events, logger)
+
+	for username, role := range map[string]string{
+		"alice": application.RoleUploader,
+		"bob":   application.RoleReviewer,
+		"carol": application.RoleAdmin,
+	} {
+		if err := am.AddUser(username, testPassword); err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		if err := am.SetRole(username, role); err != nil {
+			t.Fatal("Error while running test", err)
+		}
+	}
+
+	server := httptest.NewServer(NewServer(Config{}, am, nil, fs, nil, logger).router())
+
+	return server, am
+}
+
+func request(t *testing.T, method, url, username, body string) (int, string) {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.SetBasicAuth(username, testPassword)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	return res.StatusCode, string(data)
+}
+
+func TestReviewerReadsClosedFiles(t *testing.T) {
+	server, _ := newRolesFixture(t)
+	defer server.Close()
+
+	request(t, http.MethodPut, server.URL+"/report.txt", "alice", "evidence")
+	request(t, http.MethodPost, server.URL+"/report.txt", "alice", "")
+	request(t, http.MethodPut, server.URL+"/draft.txt", "alice", "in progress")
+
+	for _, username := range []string{"bob", "carol"} {
+		status, body := request(t, http.MethodGet, server.URL+"/files/alice/report.txt", username, "")
+		if status != http.StatusOK || body != "evidence" {
+			t.Errorf("Expected %s to read closed file, got %d %q", username, status, body)
+		}
+	}
+
+	status, body := request(t, http.MethodGet, server.URL+"/files/alice", "bob", "")
+
+	var files []reviewFile
+	if err := json.Unmarshal([]byte(body), &files); err != nil || status != http.StatusOK {
+		t.Fatal("Error while running test", status, err)
+	}
+
+	if len(files) != 1 || files[0].Name != "report.txt" {
+		t.Errorf("Expected closed files only, got %+v", files)
+	}
+
+	if status, _ := request(t, http.MethodGet, server.URL+"/files/alice/draft.txt", "bob", ""); status != http.StatusNotFound {
+		t.Errorf("Expected upload in progress not found, got %d", status)
+	}
+
+	if status, _ := request(t, http.MethodGet, server.URL+"/files/nobody", "bob", ""); status != http.StatusNotFound {
+		t.Errorf("Expected unknown user not found, got %d", status)
+	}
+}
+
+func TestUploaderCannotReview(t *testing.T) {
+	server, _ := newRolesFixture(t)
+	defer server.Close()
+
+	request(t, http.MethodPut, server.URL+"/report.txt", "bob", "notes")
+	request(t, http.MethodPost, server.URL+"/report.txt", "bob", "")
+
+	for _, url := range []string{"/files/bob", "/files/bob/report.txt", "/files/alice"} {
+		if status, _ := request(t, http.MethodGet, server.URL+url, "alice", ""); status != http.StatusForbidden {
+			t.Errorf("Expected uploader forbidden on %s, got %d", url, status)
+		}
+	}
+}
+
+func TestRoleKeptOnPasswordChange(t *testing.T) {
+	_, am := newRolesFixture(t)
+
+	if err := am.ChangePassword("bob", "changed-harbor-lantern"); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if user, _ := am.GetUser("bob"); user.Role != application.RoleReviewer {
+		t.Errorf("Expected reviewer role kept, got %q", user.Role)
+	}
+
+	if err := am.SetRole("bob", "owner"); err != application.ErrRoleNotValid {
+		t.Errorf("Expected ErrRoleNotValid, got %v", err)
+	}
+
+	if err := am.SetRole("nobody", application.RoleAdmin); err != application.ErrUsernameNotFound {
+		t.Errorf("Expected ErrUsernameNotFound, got %v", err)
+	}
+}
+
+func TestAdminRoleUsesAdminAPI(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	_, am := newRolesFixture(t)
+
+	admin := NewAdminServer(AdminConfig{}, am, nil, nil, NewServer(Config{}, am, nil, nil, nil, logger), nil, logger)
+
+	server := httptest.NewServer(admin.router())
+	defer server.Close()
+
+	if status, _ := request(t, http.MethodGet, server.URL+"/api/v1/users/alice", "carol", ""); status != http.StatusOK {
+		t.Errorf("Expected admin allowed, got %d", status)
+	}
+
+	for _, username := range []string{"alice", "bob"} {
+		if status, _ := request(t, http.MethodGet, server.URL+"/api/v1/users", username, ""); status != http.StatusForbidden {
+			t.Errorf("Expected %s forbidden, got %d", username, status)
+		}
+	}
+
+	status, _ := request(t, http.MethodPut, server.URL+"/api/v1/users/alice/role", "carol", `{"role":"reviewer"}`)
+	if user, _ := am.GetUser("alice"); status != http.StatusNoContent || user.Role != application.RoleReviewer {
+		t.Errorf("Expected alice promoted to reviewer, got %d %q", status, user.Role)
+	}
+}
+
+func TestAccessRefused(t *testing.T) {
+	server, am := newRolesFixture(t)
+	defer server.Close()
+
+	url := server.URL + "/report.txt"
+
+	if err := am.SetDisabled("alice", true); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if status, body := request(t, http.MethodPut, url, "alice", "x"); status != http.StatusForbidden ||
+		!strings.Contains(body, application.ErrAccountDisabled.Error()) {
+		t.Errorf("Expected disabled account refused, got %d %q", status, body)
+	}
+
+	if err := am.SetDisabled("alice", false); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if status, _ := request(t, http.MethodPut, url, "alice", "x"); status != http.StatusOK {
+		t.Errorf("Expected enabled account allowed, got %d", status)
+	}
+
+	if err := am.SetExpiry("bob", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if status, body := request(t, http.MethodPut, url, "bob", "x"); status != http.StatusForbidden ||
+		!strings.Contains(body, application.ErrAccountExpired.Error()) {
+		t.Errorf("Expected expired account refused, got %d %q", status, body)
+	}
+
+	// a window which is never now
+	now := time.Now()
+	start := (now.Hour()*60 + now.Minute() + 120) % (24 * 60)
+	window := application.UploadWindow{Start: start, End: (start + 60) % (24 * 60)}
+
+	if err := am.SetUploadWindows("carol", []application.UploadWindow{window}); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if status, body := request(t, http.MethodPut, url, "carol", "x"); status != http.StatusForbidden ||
+		!strings.Contains(body, application.ErrOutsideUploadWindow.Error()) {
+		t.Errorf("Expected upload outside window refused, got %d %q", status, body)
+	}
+
+	if status, _ := request(t, http.MethodPost, url, "carol", ""); status != http.StatusForbidden {
+		t.Errorf("Expected close outside window refused, got %d", status)
+	}
+
+	// windows limit uploads only, not reviewing or the admin API
+	if status, _ := request(t, http.MethodGet, server.URL+"/files/alice", "carol", ""); status != http.StatusOK {
+		t.Errorf("Expected review outside upload window allowed, got %d", status)
+	}
+
+	if status, _ := request(t, http.MethodHead, url, "carol", ""); status != http.StatusOK {
+		t.Errorf("Expected HEAD outside upload window allowed, got %d", status)
+	}
+
+	admin := httptest.NewServer(NewAdminServer(AdminConfig{}, am, nil, nil, nil, nil, zaptest.NewLogger(t)).router())
+	defer admin.Close()
+
+	if status, _ := request(t, http.MethodGet, admin.URL+"/api/v1/users/alice", "carol", ""); status != http.StatusOK {
+		t.Errorf("Expected admin API outside upload window allowed, got %d", status)
+	}
+
+	if err := am.ChangePassword("carol", "changed-harbor-lantern"); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if userAuth, _ := am.GetUserAuth("carol"); len(userAuth.UploadWindows) != 1 {
+		t.Error("Expected upload windows kept on password change")
+	}
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"time"
+)
+
+// DefaultCertCheckInterval is how often certificate files are checked for
+// changes.
+const DefaultCertCheckInterval = time.Minute
+
+// certExpiryWarning is how long before expiry warnings are logged, once a
+// day.
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// CertificateStatus describes certificate served to new connections.
+type CertificateStatus struct {
+	File     string
+	Names    []string
+	NotAfter time.Time
+	DaysLeft int
+}
+
+// loadedCertificate is certificate with files it was loaded from, stamps
+// detect files replaced by renewal.
+type loadedCertificate struct {
+	cert     *tls.Certificate
+	certFile string
+	keyFile  string
+	stamp    string
+}
+
+// LoadCertificate replaces certificate served to new connections, existing
+// connections keep the old one.
+func (s *HttpServer) LoadCertificate(certFile, keyFile string) error {
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+
+	loaded, err := loadCertificate(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	s.certificate.Store(loaded)
+
+	s.logger.Info("Certificate loaded", zap.String("cert", certFile),
+		zap.Strings("names", loaded.cert.Leaf.DNSNames), zap.Time("not_after", loaded.cert.Leaf.NotAfter),
+		zap.Int("days_left", daysLeft(loaded.cert.Leaf.NotAfter)))
+
+	s.warnExpiry(loaded)
+
+	return nil
+}
+
+func loadCertificate(certFile, keyFile string) (*loadedCertificate, error) {
+	// stamp before reading, files changed while loading are loaded again
+	stamp, err := fileStamp(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &loadedCertificate{
+		cert:     &cert,
+		certFile: certFile,
+		keyFile:  keyFile,
+		stamp:    stamp,
+	}, nil
+}
+
+// fileStamp changes whenever any of the files is replaced or written to,
+// symlinks are followed as certbot renews them by pointing to new files.
+func fileStamp(files ...string) (string, error) {
+	var stamp string
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+
+		stamp += fmt.Sprintf("%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+
+	return stamp, nil
+}
+
+func (s *HttpServer) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.certificate.Load().(*loadedCertificate).cert, nil
+}
+
+// CertificateStatus returns nil unless the server serves certificate from
+// files.
+func (s *HttpServer) CertificateStatus() *CertificateStatus {
+	loaded, ok := s.certificate.Load().(*loadedCertificate)
+	if !ok {
+		return nil
+	}
+
+	return &CertificateStatus{
+		File:     loaded.certFile,
+		Names:    loaded.cert.Leaf.DNSNames,
+		NotAfter: loaded.cert.Leaf.NotAfter,
+		DaysLeft: daysLeft(loaded.cert.Leaf.NotAfter),
+	}
+}
+
+// watchCertificate swaps in certificate renewed in place by external tools,
+// like certbot. Certificate and key are written separately, invalid pairs are
+// skipped until both are updated.
+func (s *HttpServer) watchCertificate() {
+	interval := s.config.CertCheckInterval
+	if interval <= 0 {
+		interval = DefaultCertCheckInterval
+	}
+
+	for range time.Tick(interval) {
+		s.checkCertificate()
+	}
+}
+
+func (s *HttpServer) checkCertificate() {
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+
+	current := s.certificate.Load().(*loadedCertificate)
+
+	defer func() {
+		s.warnExpiry(s.certificate.Load().(*loadedCertificate))
+	}()
+
+	stamp, err := fileStamp(current.certFile, current.keyFile)
+	if err != nil || stamp == current.stamp || stamp == s.failedStamp {
+		return
+	}
+
+	loaded, err := loadCertificate(current.certFile, current.keyFile)
+	if err == nil && time.Now().After(loaded.cert.Leaf.NotAfter) {
+		err = fmt.Errorf("certificate expired on %s", loaded.cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	if err != nil {
+		// logged once per change of files
+		s.failedStamp = stamp
+		s.logger.Warn("Changed certificate not loaded, serving the old one",
+			zap.String("cert", current.certFile), zap.Error(err))
+		return
+	}
+
+	s.certificate.Store(loaded)
+
+	s.logger.Info("Certificate reloaded", zap.String("cert", loaded.certFile),
+		zap.Strings("names", loaded.cert.Leaf.DNSNames), zap.Time("not_after", loaded.cert.Leaf.NotAfter),
+		zap.Int("days_left", daysLeft(loaded.cert.Leaf.NotAfter)))
+}
+
+// warnExpiry logs a warning at most once a day when certificate expires soon.
+func (s *HttpServer) warnExpiry(loaded *loadedCertificate) {
+	notAfter := loaded.cert.Leaf.NotAfter
+
+	if time.Until(notAfter) > certExpiryWarning || time.Since(s.expiryWarned) < 24*time.Hour {
+		return
+	}
+
+	s.expiryWarned = time.Now()
+
+	s.logger.Warn("Certificate expires soon", zap.String("cert", loaded.certFile),
+		zap.Time("not_after", notAfter), zap.Int("days_left", daysLeft(notAfter)))
+}
+
+func daysLeft(notAfter time.Time) int {
+	return int(time.Until(notAfter).Hours() / 24)
+}
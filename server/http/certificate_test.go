@@ -0,0 +1,168 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes self-signed certificate and its key, modification
+// time is moved forward on every write so changes are detected even on
+// filesystems with coarse timestamps.
+func writeCertificate(t *testing.T, certFile, keyFile, name string, notAfter time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	writes := map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+	}
+
+	for file, block := range writes {
+		if file == "" {
+			continue
+		}
+
+		if err := ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		touch(t, file)
+	}
+}
+
+var touches int
+
+func touch(t *testing.T, file string) {
+	touches++
+	modified := time.Now().Add(time.Duration(touches) * time.Second)
+
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+}
+
+func certificateServer(t *testing.T) (*HttpServer, string, string, func()) {
+	dir, err := ioutil.TempDir("", "direct-upload-cert")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	certFile := filepath.Join(dir, "fullchain.pem")
+	keyFile := filepath.Join(dir, "privkey.pem")
+
+	writeCertificate(t, certFile, keyFile, "old.example.org", time.Now().Add(30*24*time.Hour))
+
+	srv := NewServer(Config{CertFile: certFile, PrivateKeyFile: keyFile}, nil, nil, nil, nil, zaptest.NewLogger(t))
+
+	if err := srv.LoadCertificate(certFile, keyFile); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	return srv, certFile, keyFile, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func servedName(t *testing.T, srv *HttpServer) string {
+	cert, err := srv.getCertificate(nil)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	return cert.Leaf.DNSNames[0]
+}
+
+func TestCertificateReload(t *testing.T) {
+	srv, certFile, keyFile, cleanup := certificateServer(t)
+	defer cleanup()
+
+	status := srv.CertificateStatus()
+	if status == nil || status.File != certFile || status.DaysLeft != 29 {
+		t.Fatalf("Unexpected certificate status %+v", status)
+	}
+
+	// unchanged files are not loaded again
+	srv.checkCertificate()
+
+	if name := servedName(t, srv); name != "old.example.org" {
+		t.Errorf("Expected old certificate, got %s", name)
+	}
+
+	writeCertificate(t, certFile, keyFile, "new.example.org", time.Now().Add(90*24*time.Hour))
+
+	srv.checkCertificate()
+
+	if name := servedName(t, srv); name != "new.example.org" {
+		t.Errorf("Expected renewed certificate, got %s", name)
+	}
+
+	if status := srv.CertificateStatus(); status.DaysLeft != 89 || status.Names[0] != "new.example.org" {
+		t.Errorf("Unexpected certificate status %+v", status)
+	}
+}
+
+func TestCertificateReloadPartialWrite(t *testing.T) {
+	srv, certFile, keyFile, cleanup := certificateServer(t)
+	defer cleanup()
+
+	// certificate written, key not yet
+	writeCertificate(t, certFile, "", "new.example.org", time.Now().Add(90*24*time.Hour))
+
+	srv.checkCertificate()
+
+	if name := servedName(t, srv); name != "old.example.org" {
+		t.Errorf("Expected old certificate while key doesn't match, got %s", name)
+	}
+
+	writeCertificate(t, certFile, keyFile, "new.example.org", time.Now().Add(90*24*time.Hour))
+
+	srv.checkCertificate()
+
+	if name := servedName(t, srv); name != "new.example.org" {
+		t.Errorf("Expected renewed certificate, got %s", name)
+	}
+}
+
+func TestCertificateReloadExpired(t *testing.T) {
+	srv, certFile, keyFile, cleanup := certificateServer(t)
+	defer cleanup()
+
+	writeCertificate(t, certFile, keyFile, "expired.example.org", time.Now().Add(-time.Hour))
+
+	srv.checkCertificate()
+
+	if name := servedName(t, srv); name != "old.example.org" {
+		t.Errorf("Expected old certificate instead of expired one, got %s", name)
+	}
+}
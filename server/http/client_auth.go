@@ -0,0 +1,291 @@
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Client certificate modes.
+const (
+	ClientAuthOff = "off"
+	// ClientAuthOptional accepts client certificates, requests without one
+	// fall back to Basic auth.
+	ClientAuthOptional = "optional"
+	// ClientAuthRequired accepts only requests with client certificate.
+	ClientAuthRequired = "required"
+)
+
+// Fields of client certificate usernames are taken from.
+const (
+	UsernameFromCN    = "cn"
+	UsernameFromEmail = "email"
+	UsernameFromDNS   = "dns"
+)
+
+type ClientAuthConfig struct {
+	Mode string
+	// CAFiles are PEM files with CA certificates client certificates are
+	// verified against.
+	CAFiles []string
+	// CRLFiles are checked on every handshake, CRL of an issuer applies only
+	// to certificates it issued. Files are parsed again after they change.
+	CRLFiles []string
+	// UsernameFrom is one of "cn", "email" or "dns", defaults to "cn".
+	UsernameFrom string
+}
+
+func (c *ClientAuthConfig) enabled() bool {
+	return c != nil && c.Mode != "" && c.Mode != ClientAuthOff
+}
+
+func (c *ClientAuthConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	switch c.Mode {
+	case "", ClientAuthOff, ClientAuthOptional, ClientAuthRequired:
+	default:
+		return fmt.Errorf("unknown client certificate mode %q", c.Mode)
+	}
+
+	switch c.UsernameFrom {
+	case "", UsernameFromCN, UsernameFromEmail, UsernameFromDNS:
+	default:
+		return fmt.Errorf("unknown client certificate username field %q", c.UsernameFrom)
+	}
+
+	return nil
+}
+
+// revocationLists caches parsed CRL files until they change.
+type revocationLists struct {
+	files []string
+	mu    sync.Mutex
+	lists map[string]*revocationList
+}
+
+type revocationList struct {
+	stamp string
+	list  *x509.RevocationList
+}
+
+// configureClientAuth makes tlsConfig verify client certificates given by
+// clients. Certificates are only requested, missing certificate is handled by
+// ClientCertMiddleware so clients get HTTP error instead of failed handshake.
+func (s *HttpServer) configureClientAuth(tlsConfig *tls.Config) error {
+	cfg := s.config.ClientAuth
+
+	pool := x509.NewCertPool()
+
+	for _, file := range cfg.CAFiles {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates in %s", file)
+		}
+	}
+
+	crls := &revocationLists{
+		files: cfg.CRLFiles,
+		lists: map[string]*revocationList{},
+	}
+
+	// fail on start rather than on first handshake
+	_, err := crls.load()
+	if err != nil {
+		return err
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	tlsConfig.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+		return crls.check(chains)
+	}
+
+	s.logger.Info("Client certificates enabled",
+		zap.String("mode", cfg.Mode), zap.Strings("ca", cfg.CAFiles), zap.Strings("crl", cfg.CRLFiles))
+
+	return nil
+}
+
+// load returns current lists, parsing files changed since the last call.
+func (l *revocationLists) load() ([]*x509.RevocationList, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var lists []*x509.RevocationList
+
+	for _, file := range l.files {
+		stamp, err := fileStamp(file)
+		if err != nil {
+			return nil, err
+		}
+
+		cached, ok := l.lists[file]
+		if !ok || cached.stamp != stamp {
+			list, err := parseRevocationList(file)
+			if err != nil {
+				return nil, err
+			}
+
+			cached = &revocationList{stamp: stamp, list: list}
+			l.lists[file] = cached
+		}
+
+		lists = append(lists, cached.list)
+	}
+
+	return lists, nil
+}
+
+func parseRevocationList(file string) (*x509.RevocationList, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	return list, nil
+}
+
+// check rejects verified chains containing revoked certificates. Unreadable
+// CRL fails the handshake, so revoked certificates are never accepted.
+func (l *revocationLists) check(chains [][]*x509.Certificate) error {
+	if len(chains) == 0 {
+		return nil
+	}
+
+	lists, err := l.load()
+	if err != nil {
+		return err
+	}
+
+	for _, chain := range chains {
+		for i := 0; i+1 < len(chain); i++ {
+			cert, issuer := chain[i], chain[i+1]
+
+			for _, list := range lists {
+				if !bytes.Equal(list.RawIssuer, cert.RawIssuer) || list.CheckSignatureFrom(issuer) != nil {
+					continue
+				}
+
+				for _, revoked := range list.RevokedCertificateEntries {
+					if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+						return fmt.Errorf("certificate %s revoked", cert.SerialNumber.Text(16))
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ClientCertMiddleware authenticates requests by verified client certificate,
+// requests without one are passed to next middleware unless certificate is
+// required.
+type ClientCertMiddleware struct {
+	manager      *application.AuthManager
+	required     bool
+	usernameFrom string
+	next         Middleware
+	logger       *zap.Logger
+}
+
+func NewClientCertMiddleware(logger *zap.Logger, manager *application.AuthManager, cfg *ClientAuthConfig,
+	next Middleware) *ClientCertMiddleware {
+	return &ClientCertMiddleware{
+		manager:      manager,
+		required:     cfg.Mode == ClientAuthRequired,
+		usernameFrom: cfg.UsernameFrom,
+		next:         next,
+		logger:       logger,
+	}
+}
+
+func (m *ClientCertMiddleware) Handle(h httprouter.Handle) httprouter.Handle {
+	fallback := m.next.Handle(h)
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			if m.required {
+				m.logger.Debug("Client certificate missing")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+
+			fallback(w, r, ps)
+			return
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+
+		user := m.username(cert)
+		if !application.ValidUsername(user) {
+			m.logger.Debug("Client certificate username not valid",
+				zap.String("username", user), zap.String("serial", cert.SerialNumber.Text(16)))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		authenticated, err := m.manager.GetUser(user)
+		if err != nil {
+			m.logger.Error("Error while validating client certificate", zap.Error(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if authenticated == nil {
+			m.logger.Debug("Client certificate of unknown user", zap.String("username", user))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		if !checkAccess(w, m.manager, m.logger, user) {
+			return
+		}
+
+		ctx := application.NewContext(r.Context(), authenticated)
+		h(w, r.WithContext(ctx), ps)
+	}
+}
+
+// username returns username from the configured certificate field, or empty
+// string if the field is missing.
+func (m *ClientCertMiddleware) username(cert *x509.Certificate) string {
+	switch m.usernameFrom {
+	case UsernameFromEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case UsernameFromDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+
+	return ""
+}
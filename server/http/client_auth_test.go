@@ -0,0 +1,253 @@
+package http
+
+import (
+	"crypto/tls"
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+type memAuthRepo struct {
+	mu    sync.Mutex
+	users map[string]application.UserAuth
+}
+
+func (r *memAuthRepo) Create(u *application.UserAuth) error {
+	return r.Update(u)
+}
+
+func (r *memAuthRepo) CreateAll(users []*application.UserAuth) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range users {
+		if _, ok := r.users[u.Username]; ok {
+			return application.ErrUsernameExists
+		}
+	}
+	for _, u := range users {
+		r.users[u.Username] = *u
+	}
+	return nil
+}
+
+func (r *memAuthRepo) Read(username string) (*application.UserAuth, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	u, ok := r.users[username]
+	if !ok {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func (r *memAuthRepo) Update(u *application.UserAuth) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[u.Username] = *u
+	return nil
+}
+
+func (r *memAuthRepo) Delete(username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.users, username)
+	return nil
+}
+
+func (r *memAuthRepo) List() <-chan application.UserAuth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(chan application.UserAuth, len(r.users))
+	for _, u := range r.users {
+		out <- u
+	}
+	close(out)
+	return out
+}
+
+type memDeviceCertRepo struct {
+	mu    sync.Mutex
+	certs map[string]application.DeviceCertificate
+}
+
+func (r *memDeviceCertRepo) Save(cert *application.DeviceCertificate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certs[cert.Serial] = *cert
+	return nil
+}
+
+func (r *memDeviceCertRepo) Read(serial string) (*application.DeviceCertificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cert, ok := r.certs[serial]
+	if !ok {
+		return nil, nil
+	}
+	return &cert, nil
+}
+
+func (r *memDeviceCertRepo) List() <-chan application.DeviceCertificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(chan application.DeviceCertificate, len(r.certs))
+	for _, cert := range r.certs {
+		out <- cert
+	}
+	close(out)
+	return out
+}
+
+type clientAuthFixture struct {
+	server *httptest.Server
+	ca     *application.DeviceCA
+	dir    string
+}
+
+// newClientAuthFixture serves username of authenticated user, alice is the
+// only user with testPassword.
+func newClientAuthFixture(t *testing.T, mode string) *clientAuthFixture {
+	logger := zaptest.NewLogger(t)
+
+	dir, err := ioutil.TempDir("", "direct-upload-mtls")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	ca, err := application.NewDeviceCA(application.DeviceCAConfig{Dir: dir},
+		&memDeviceCertRepo{certs: map[string]application.DeviceCertificate{}}, logger)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	am := application.NewAuthManager(logger, &memAuthRepo{users: map[string]application.UserAuth{}},
+		application.NewEventBus(logger))
+
+	if err := am.SetPassword("alice", testPassword); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	cfg := &ClientAuthConfig{
+		Mode:     mode,
+		CAFiles:  []string{ca.CertFile()},
+		CRLFiles: []string{ca.CRLFile()},
+	}
+
+	srv := NewServer(Config{ClientAuth: cfg}, am, nil, nil, nil, logger)
+
+	auth := NewClientCertMiddleware(logger, am, cfg, NewBasicAuthMiddleware(logger, am))
+
+	router := httprouter.New()
+	router.GET("/", auth.Handle(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user, _ := application.UserFromContext(r.Context())
+		_, _ = w.Write([]byte(user.Username))
+	}))
+
+	server := httptest.NewUnstartedServer(router)
+	server.TLS = newTLSConfig()
+
+	if err := srv.configureClientAuth(server.TLS); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	server.StartTLS()
+
+	return &clientAuthFixture{server: server, ca: ca, dir: dir}
+}
+
+func (f *clientAuthFixture) close() {
+	f.server.Close()
+	_ = os.RemoveAll(f.dir)
+}
+
+func (f *clientAuthFixture) issue(t *testing.T, username string) (*tls.Certificate, string) {
+	issued, err := f.ca.Issue(username, "phone", 0)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	cert, err := tls.X509KeyPair(issued.CertPEM, issued.KeyPEM)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	return &cert, issued.Serial
+}
+
+// get returns status and body, new connection is made for every request so
+// revocation is checked.
+func (f *clientAuthFixture) get(cert *tls.Certificate, password string) (int, string, error) {
+	transport := f.server.Client().Transport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = true
+
+	if cert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, f.server.URL, nil)
+	if password != "" {
+		req.SetBasicAuth("alice", password)
+	}
+
+	res, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+
+	return res.StatusCode, string(body), err
+}
+
+func TestClientCertRequired(t *testing.T) {
+	f := newClientAuthFixture(t, ClientAuthRequired)
+	defer f.close()
+
+	alice, serial := f.issue(t, "alice")
+
+	status, body, err := f.get(alice, "")
+	if err != nil || status != http.StatusOK || body != "alice" {
+		t.Errorf("Expected alice authenticated by certificate, got %d %q %v", status, body, err)
+	}
+
+	if status, _, err := f.get(nil, testPassword); err != nil || status != http.StatusUnauthorized {
+		t.Errorf("Expected password rejected when certificate is required, got %d %v", status, err)
+	}
+
+	bob, _ := f.issue(t, "bob")
+
+	if status, _, err := f.get(bob, ""); err != nil || status != http.StatusUnauthorized {
+		t.Errorf("Expected certificate of unknown user rejected, got %d %v", status, err)
+	}
+
+	if _, err := f.ca.Revoke(serial); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if _, _, err := f.get(alice, ""); err == nil {
+		t.Error("Expected handshake with revoked certificate to fail")
+	}
+}
+
+func TestClientCertOptional(t *testing.T) {
+	f := newClientAuthFixture(t, ClientAuthOptional)
+	defer f.close()
+
+	alice, _ := f.issue(t, "alice")
+
+	if status, body, err := f.get(alice, ""); err != nil || status != http.StatusOK || body != "alice" {
+		t.Errorf("Expected alice authenticated by certificate, got %d %q %v", status, body, err)
+	}
+
+	if status, body, err := f.get(nil, testPassword); err != nil || status != http.StatusOK || body != "alice" {
+		t.Errorf("Expected alice authenticated by password, got %d %q %v", status, body, err)
+	}
+}
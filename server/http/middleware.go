@@ -43,7 +43,18 @@ func (m *BasicAuthMiddleware) Handle(h httprouter.Handle) httprouter.Handle {
 			}
 
 			if ok {
-				ctx := application.NewContext(r.Context(), &application.User{Username: user})
+				authenticated, err := m.manager.GetUser(user)
+				if err != nil || authenticated == nil {
+					m.logger.Error("Error while reading user", zap.Error(err))
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+
+				if !checkAccess(w, m.manager, m.logger, user) {
+					return
+				}
+
+				ctx := application.NewContext(r.Context(), authenticated)
 				h(w, r.WithContext(ctx), ps)
 				return
 			}
@@ -56,6 +67,29 @@ func (m *BasicAuthMiddleware) Handle(h httprouter.Handle) httprouter.Handle {
 	}
 }
 
+// checkAccess refuses authenticated user whose account is disabled or
+// expired, reporting whether the request may continue.
+func checkAccess(w http.ResponseWriter, manager *application.AuthManager, logger *zap.Logger, username string) bool {
+	return accessAllowed(w, logger, username, manager.CheckAccess(username))
+}
+
+// accessAllowed responds to refused access, reporting whether the request may
+// continue.
+func accessAllowed(w http.ResponseWriter, logger *zap.Logger, username string, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case application.ErrAccountDisabled, application.ErrAccountExpired, application.ErrOutsideUploadWindow:
+		// the manager logs and publishes the reason
+		http.Error(w, http.StatusText(http.StatusForbidden)+": "+err.Error(), http.StatusForbidden)
+	default:
+		logger.Error("Error while checking access", zap.String("username", username), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	return false
+}
+
 type PanicMiddleware struct {
 	logger *zap.Logger
 }
@@ -0,0 +1,197 @@
+package http
+
+import (
+	"github.com/horizontal-org/direct-upload/application"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type memProjectRepo struct {
+	mu       sync.Mutex
+	projects map[string]application.Project
+}
+
+func (r *memProjectRepo) Save(project *application.Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members := map[string]string{}
+	for username, role := range project.Members {
+		members[username] = role
+	}
+	saved := *project
+	saved.Members = members
+	r.projects[project.Name] = saved
+	return nil
+}
+
+func (r *memProjectRepo) Read(name string) (*application.Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	project, ok := r.projects[name]
+	if !ok {
+		return nil, nil
+	}
+	return &project, nil
+}
+
+func (r *memProjectRepo) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.projects, name)
+	return nil
+}
+
+func (r *memProjectRepo) List() <-chan application.Project {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(chan application.Project, len(r.projects))
+	for _, project := range r.projects {
+		out <- project
+	}
+	close(out)
+	return out
+}
+
+// newProjectFixture serves project "inquiry" where alice uploads and bob
+// reviews, dave is not a member and carol is an admin.
+func newProjectFixture(t *testing.T) (*httptest.Server, *application.ProjectManager, *application.EventBus) {
+	logger := zaptest.NewLogger(t)
+	events := application.NewEventBus(logger)
+
+	am := application.NewAuthManager(logger, &memAuthRepo{users: map[string]application.UserAuth{}}, events)
+	fs := application.NewMemoryFileStore(application.MemoryFileStoreConfig{}, events, logger)
+	pm := application.NewProjectManager(&memProjectRepo{projects: map[string]application.Project{}}, am, logger)
+	events.Subscribe(pm.Handle)
+
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		if err := am.AddUser(username, testPassword); err != nil {
+			t.Fatal("Error while running test", err)
+		}
+	}
+
+	if err := am.SetRole("carol", application.RoleAdmin); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := pm.Create("inquiry"); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := pm.AddMember("inquiry", "alice", application.RoleUploader); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := pm.AddMember("inquiry", "bob", application.RoleReviewer); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	server := httptest.NewServer(NewServer(Config{}, am, pm, fs, nil, logger).handler())
+
+	return server, pm, events
+}
+
+func TestProjectUploads(t *testing.T) {
+	server, _, events := newProjectFixture(t)
+	defer server.Close()
+
+	var closed []application.Event
+	events.Subscribe(func(e application.Event) {
+		if e.Type == application.EventFileClosed {
+			closed = append(closed, e)
+		}
+	})
+
+	url := server.URL + "/projects/inquiry/report.txt"
+
+	if status, _ := request(t, http.MethodPut, url, "alice", "evidence"); status != http.StatusOK {
+		t.Errorf("Expected member upload, got %d", status)
+	}
+
+	if status, _ := request(t, http.MethodPost, url, "alice", ""); status != http.StatusOK {
+		t.Errorf("Expected member close, got %d", status)
+	}
+
+	if len(closed) != 1 || closed[0].Username != "alice" || closed[0].Project != "inquiry" ||
+		closed[0].Owner() != application.ProjectOwner("inquiry") {
+		t.Errorf("Unexpected events %+v", closed)
+	}
+
+	if status, _ := request(t, http.MethodPut, server.URL+"/projects/inquiry/other.txt", "dave", "x"); status != http.StatusForbidden {
+		t.Errorf("Expected non-member forbidden, got %d", status)
+	}
+
+	if status, _ := request(t, http.MethodPut, server.URL+"/projects/unknown/other.txt", "alice", "x"); status != http.StatusNotFound {
+		t.Errorf("Expected unknown project not found, got %d", status)
+	}
+
+	// the user's own folder is separate
+	if status, _ := request(t, http.MethodGet, server.URL+"/files/alice/report.txt", "carol", ""); status != http.StatusNotFound {
+		t.Errorf("Expected project file not in user folder, got %d", status)
+	}
+}
+
+func TestProjectReviewers(t *testing.T) {
+	server, pm, _ := newProjectFixture(t)
+	defer server.Close()
+
+	url := server.URL + "/projects/inquiry/report.txt"
+
+	request(t, http.MethodPut, url, "alice", "evidence")
+	request(t, http.MethodPost, url, "alice", "")
+
+	for _, username := range []string{"bob", "carol"} {
+		if status, body := request(t, http.MethodGet, url, username, ""); status != http.StatusOK || body != "evidence" {
+			t.Errorf("Expected %s to read project file, got %d %q", username, status, body)
+		}
+	}
+
+	for _, username := range []string{"alice", "dave"} {
+		if status, _ := request(t, http.MethodGet, server.URL+"/projects/inquiry", username, ""); status != http.StatusForbidden {
+			t.Errorf("Expected %s forbidden, got %d", username, status)
+		}
+	}
+
+	if err := pm.RemoveMember("inquiry", "bob"); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if status, _ := request(t, http.MethodGet, url, "bob", ""); status != http.StatusForbidden {
+		t.Errorf("Expected removed member forbidden, got %d", status)
+	}
+}
+
+func TestDeletedUserLeavesProjects(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	events := application.NewEventBus(logger)
+
+	am := application.NewAuthManager(logger, &memAuthRepo{users: map[string]application.UserAuth{}}, events)
+	pm := application.NewProjectManager(&memProjectRepo{projects: map[string]application.Project{}}, am, logger)
+	events.Subscribe(pm.Handle)
+
+	if err := am.AddUser("alice", testPassword); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := pm.Create("inquiry"); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := pm.AddMember("inquiry", "alice", application.RoleReviewer); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if err := pm.AddMember("inquiry", "bob", application.RoleUploader); err != application.ErrUsernameNotFound {
+		t.Errorf("Expected ErrUsernameNotFound, got %v", err)
+	}
+
+	if err := am.Delete("alice"); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if project, _ := pm.Get("inquiry"); project.IsMember("alice") {
+		t.Error("Deleted user is still a project member")
+	}
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"github.com/horizontal-org/direct-upload/application"
+	"go.uber.org/zap/zaptest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type memReceiptRepo map[string]application.Receipt
+
+func (r memReceiptRepo) Save(receipt *application.Receipt) error {
+	r[receipt.Owner()+"/"+receipt.File] = *receipt
+	return nil
+}
+
+func (r memReceiptRepo) Read(owner, file string) (*application.Receipt, error) {
+	receipt, ok := r[owner+"/"+file]
+	if !ok {
+		return nil, nil
+	}
+
+	return &receipt, nil
+}
+
+func TestCloseReturnsReceipt(t *testing.T) {
+	for collision, versions := range map[application.CollisionPolicy][]string{
+		application.CollisionReject:  {"statement.txt"},
+		application.CollisionVersion: {"statement.txt", "statement (2).txt"},
+	} {
+		testCloseReturnsReceipt(t, collision, versions)
+	}
+}
+
+func testCloseReturnsReceipt(t *testing.T, collision application.CollisionPolicy, versions []string) {
+	logger := zaptest.NewLogger(t)
+	events := application.NewEventBus(logger)
+
+	am := application.NewAuthManager(logger, &memAuthRepo{users: map[string]application.UserAuth{}}, events)
+	if err := am.AddUser("alice", testPassword); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	fs := application.NewMemoryFileStore(application.MemoryFileStoreConfig{Collision: collision}, events, logger)
+
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	receipts := application.NewReceiptIssuer(key, fs, memReceiptRepo{}, logger)
+
+	server := httptest.NewServer(NewServer(Config{}, am, nil, fs, receipts, logger).router())
+	defer server.Close()
+
+	status, body := request(t, http.MethodGet, server.URL+"/receipt-key", "", "")
+	if status != http.StatusOK {
+		t.Fatal("Expected public key published, got", status)
+	}
+
+	publicKey, err := application.ParseReceiptPublicKey([]byte(body))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	expectReceipt := func(version string) {
+		status, body := request(t, http.MethodPost, server.URL+"/statement.txt", "alice", "")
+		if status != http.StatusOK {
+			t.Fatal("Expected file closed, got", status)
+		}
+
+		var receipt application.Receipt
+		if err := json.Unmarshal([]byte(body), &receipt); err != nil {
+			t.Fatal("Error while running test", err)
+		}
+
+		if receipt.Username != "alice" || receipt.File != version || receipt.Size != 8 {
+			t.Errorf("%s: unexpected receipt %+v", collision, receipt)
+		}
+
+		if err := receipt.Verify(publicKey); err != nil {
+			t.Error("Expected receipt valid, got", err)
+		}
+	}
+
+	for _, version := range versions {
+		request(t, http.MethodPut, server.URL+"/statement.txt", "alice", "evidence")
+
+		expectReceipt(version)
+	}
+
+	// retried close gets receipt of the version closed last
+	expectReceipt(versions[len(versions)-1])
+
+	// closing file that was never uploaded has nothing to receipt
+	if status, body := request(t, http.MethodPost, server.URL+"/missing.txt", "alice", ""); status != http.StatusOK ||
+		body != "" {
+		t.Errorf("Expected empty response, got %d %q", status, body)
+	}
+}
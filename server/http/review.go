@@ -0,0 +1,133 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/horizontal-org/direct-upload/application"
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type reviewFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Updated time.Time `json:"updated"`
+}
+
+// handleReviewList lists closed files of the user in the path, uploads in
+// progress are not shown to reviewers.
+func (s *HttpServer) handleReviewList(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx, ok := s.ownerContext(w, r, ps)
+	if !ok {
+		return
+	}
+
+	s.sendClosedFiles(ctx, w)
+}
+
+// handleReviewGet returns content of a closed file of the user in the path.
+func (s *HttpServer) handleReviewGet(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	file, valid := fileName(ps)
+	if !valid {
+		errorValidation(w)
+		return
+	}
+
+	ctx, ok := s.ownerContext(w, r, ps)
+	if !ok {
+		return
+	}
+
+	s.sendClosedFile(ctx, w, r, file)
+}
+
+// handleProjectList lists closed files of the project in context.
+func (s *HttpServer) handleProjectList(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	s.sendClosedFiles(r.Context(), w)
+}
+
+// handleProjectGet returns content of a closed file of the project in context.
+func (s *HttpServer) handleProjectGet(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	file, valid := fileName(ps)
+	if !valid {
+		errorValidation(w)
+		return
+	}
+
+	s.sendClosedFile(r.Context(), w, r, file)
+}
+
+func (s *HttpServer) sendClosedFiles(ctx context.Context, w http.ResponseWriter) {
+	infos, err := s.fileStore.ListFiles(ctx)
+	if err != nil {
+		errorInternal(w)
+		return
+	}
+
+	files := []reviewFile{}
+	for _, info := range infos {
+		if info.Closed {
+			files = append(files, reviewFile{Name: info.Name, Size: info.Size, Updated: info.Updated})
+		}
+	}
+
+	w.Header().Set("content-type", "application/json")
+	_ = json.NewEncoder(w).Encode(files)
+}
+
+// sendClosedFile sends file of the owner in ctx, r is the reviewer's request.
+func (s *HttpServer) sendClosedFile(ctx context.Context, w http.ResponseWriter, r *http.Request, file string) {
+	content, err := s.fileStore.OpenFile(ctx, file)
+	if err == application.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		errorInternal(w)
+		return
+	}
+	//noinspection GoUnhandledErrorResult
+	defer content.Close()
+
+	reviewer, _ := application.UserFromContext(r.Context())
+	owner, _ := application.UserFromContext(ctx)
+	s.logger.Info("File read by reviewer", zap.String("reviewer", reviewer.Username),
+		zap.String("owner", owner.Owner()), zap.String("file", file))
+
+	w.Header().Set("content-type", "application/octet-stream")
+	w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s", url.PathEscape(file)))
+
+	_, err = io.Copy(w, content)
+	if err != nil {
+		s.logger.Error("Error while sending file", zap.Error(err))
+	}
+}
+
+// ownerContext returns context of the user whose files are reviewed.
+func (s *HttpServer) ownerContext(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (context.Context, bool) {
+	username := ps.ByName("username")
+
+	if !application.ValidUsername(username) {
+		errorValidation(w)
+		return nil, false
+	}
+
+	owner, err := s.authManager.GetUser(username)
+	if err != nil {
+		errorInternal(w)
+		return nil, false
+	}
+
+	if owner == nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	return application.NewContext(r.Context(), owner), true
+}
@@ -2,12 +2,15 @@ package http
 
 import (
 	"crypto/tls"
+	"fmt"
 	"github.com/horizontal-org/direct-upload/application"
 	"github.com/julienschmidt/httprouter"
 	"go.uber.org/zap"
 	"net/http"
-	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,52 +18,150 @@ import (
 type HttpServer struct {
 	config      Config
 	authManager *application.AuthManager
+	projects    *application.ProjectManager
 	fileStore   application.FileStore
-	logger      *zap.Logger
+	receipts    *application.ReceiptIssuer
+	certificate atomic.Value
+	// certMu serializes certificate loads, guards failedStamp and expiryWarned
+	certMu       sync.Mutex
+	failedStamp  string
+	expiryWarned time.Time
+	logger       *zap.Logger
 }
 
 type Config struct {
 	Address        string
 	CertFile       string
 	PrivateKeyFile string
+	ACME           *ACMEConfig
+	ClientAuth     *ClientAuthConfig
+	// CertCheckInterval defaults to DefaultCertCheckInterval.
+	CertCheckInterval time.Duration
 }
 
-var fileRegexp = regexp.MustCompile("^[a-zA-Z0-9_\\-][a-zA-Z0-9_.\\-]*$")
+// projectsPrefix starts paths of shared project folders.
+const projectsPrefix = "/projects/"
 
-func NewServer(cfg Config, am *application.AuthManager, fs application.FileStore, logger *zap.Logger) *HttpServer {
+// NewServer returns upload server, project folders are served unless pm is
+// nil and closed files get receipts unless ri is nil.
+func NewServer(cfg Config, am *application.AuthManager, pm *application.ProjectManager, fs application.FileStore,
+	ri *application.ReceiptIssuer, logger *zap.Logger) *HttpServer {
 	return &HttpServer{
 		config:      cfg,
 		authManager: am,
+		projects:    pm,
 		fileStore:   fs,
+		receipts:    ri,
 		logger:      logger,
 	}
 }
 
 func (s *HttpServer) Start() {
-	auth := NewBasicAuthMiddleware(s.logger, s.authManager)
-	pacifier := NewPanicMiddleware(s.logger)
-	logger := NewLoggerMiddleware(s.logger)
+	s.logger.Sugar().Infof("Starting Tella upload server on %s", s.config.Address)
+
+	s.logger.Fatal("Error on Tella upload server start", zap.Error(s.listen(s.handler())))
+}
 
-	restricted := func(h httprouter.Handle) httprouter.Handle {
-		return pacifier.Handle(logger.Handle(auth.Handle(h)))
+// handler routes project paths separately, as httprouter doesn't allow them
+// next to the "/:file" wildcard.
+func (s *HttpServer) handler() http.Handler {
+	uploads := s.router()
+
+	if s.projects == nil {
+		return uploads
 	}
 
+	projects := s.projectRouter()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, projectsPrefix) {
+			projects.ServeHTTP(w, r)
+			return
+		}
+
+		uploads.ServeHTTP(w, r)
+	})
+}
+
+func (s *HttpServer) auth() Middleware {
+	var auth Middleware = NewBasicAuthMiddleware(s.logger, s.authManager)
+	if s.config.ClientAuth.enabled() {
+		auth = NewClientCertMiddleware(s.logger, s.authManager, s.config.ClientAuth, auth)
+	}
+
+	return auth
+}
+
+func (s *HttpServer) restricted(m Middleware, h httprouter.Handle) httprouter.Handle {
+	return NewPanicMiddleware(s.logger).Handle(NewLoggerMiddleware(s.logger).Handle(m.Handle(h)))
+}
+
+func (s *HttpServer) router() *httprouter.Router {
+	auth := s.auth()
+
+	upload := NewAuthorizationMiddleware(s.logger, PermissionUpload, auth)
+	review := NewAuthorizationMiddleware(s.logger, PermissionReview, auth)
+
+	restricted := s.restricted
+
 	router := httprouter.New()
-	router.HEAD("/:file", restricted(s.handleHead))
-	router.PUT("/:file", restricted(s.handlePut))
-	router.POST("/:file", restricted(s.handlePost))
-	router.DELETE("/:file", restricted(s.handleDelete))
+	router.HEAD("/:file", restricted(upload, s.handleHead))
+	router.PUT("/:file", restricted(upload, s.inUploadWindow(s.handlePut)))
+	router.POST("/:file", restricted(upload, s.inUploadWindow(s.handlePost)))
+	router.DELETE("/:file", restricted(upload, s.handleDelete))
+	router.GET("/files/:username", restricted(review, s.handleReviewList))
+	router.GET("/files/:username/:file", restricted(review, s.handleReviewGet))
+
+	if s.receipts != nil {
+		router.GET("/receipt-key", NewPanicMiddleware(s.logger).Handle(s.handleReceiptKey))
+	}
 
-	s.logger.Sugar().Infof("Starting Tella upload server on %s", s.config.Address)
+	return router
+}
+
+// inUploadWindow refuses uploads outside of upload windows of the user, other
+// requests are not limited by them.
+func (s *HttpServer) inUploadWindow(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		user, ok := application.UserFromContext(r.Context())
+		if !ok {
+			errorForbidden(w)
+			return
+		}
+
+		if !accessAllowed(w, s.logger, user.Username, s.authManager.CheckUploadWindow(user.Username)) {
+			return
+		}
 
-	s.logger.Fatal("Error on Tella upload server start", zap.Error(s.listen(router)))
+		h(w, r, ps)
+	}
 }
 
-func (s *HttpServer) handleHead(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	file := ps.ByName("file")
+// projectRouter serves uploads to project folders, and reading them to
+// project reviewers.
+func (s *HttpServer) projectRouter() *httprouter.Router {
+	auth := s.auth()
+
+	upload := NewProjectAuthorizationMiddleware(s.logger, PermissionUpload, s.projects, auth)
+	review := NewProjectAuthorizationMiddleware(s.logger, PermissionReview, s.projects, auth)
+
+	restricted := s.restricted
 
+	router := httprouter.New()
+	router.HEAD("/projects/:project/:file", restricted(upload, s.handleHead))
+	router.PUT("/projects/:project/:file", restricted(upload, s.inUploadWindow(s.handlePut)))
+	router.POST("/projects/:project/:file", restricted(upload, s.inUploadWindow(s.handlePost)))
+	router.DELETE("/projects/:project/:file", restricted(upload, s.handleDelete))
+	router.GET("/projects/:project", restricted(review, s.handleProjectList))
+	router.GET("/projects/:project/:file", restricted(review, s.handleProjectGet))
+
+	return router
+}
+
+func (s *HttpServer) handleHead(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// validate parameters
-	if !validFileName(file) {
+	file, valid := fileName(ps)
+	if !valid {
 		errorValidation(w)
 		return
 	}
@@ -75,10 +176,9 @@ func (s *HttpServer) handleHead(w http.ResponseWriter, r *http.Request, ps httpr
 }
 
 func (s *HttpServer) handlePut(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	file := ps.ByName("file")
-
 	// validate parameters
-	if !validFileName(file) {
+	file, valid := fileName(ps)
+	if !valid {
 		errorValidation(w)
 		return
 	}
@@ -99,36 +199,65 @@ func (s *HttpServer) handlePut(w http.ResponseWriter, r *http.Request, ps httpro
 }
 
 func (s *HttpServer) handlePost(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	file := ps.ByName("file")
-
 	// validate parameters
-	if !validFileName(file) {
+	file, valid := fileName(ps)
+	if !valid {
 		errorValidation(w)
 		return
 	}
 
-	err := s.fileStore.CloseFile(r.Context(), file)
+	closed, err := s.fileStore.CloseFile(r.Context(), file)
 	if err != nil {
 		errorInternal(w)
 		return
 	}
 
-	ok(w)
+	if s.receipts == nil || closed == "" {
+		ok(w)
+		return
+	}
+
+	// the file stays closed, retried close gets the receipt
+	receipt, err := s.receipts.Issue(r.Context(), closed)
+	if err != nil {
+		s.logger.Error("Error issuing receipt", zap.String("file", closed), zap.Error(err))
+		errorInternal(w)
+		return
+	}
+
+	sendJSON(w, http.StatusOK, receipt)
 }
 
-func (s *HttpServer) handleDelete(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
-	file := ps.ByName("file")
+// handleReceiptKey publishes public key verifying receipts.
+func (s *HttpServer) handleReceiptKey(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	key, err := application.MarshalReceiptPublicKey(s.receipts.PublicKey())
+	if err != nil {
+		errorInternal(w)
+		return
+	}
 
+	w.Header().Set("content-type", "application/x-pem-file")
+	_, _ = w.Write(key)
+}
+
+func (s *HttpServer) handleDelete(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	// validate parameters
-	if !validFileName(file) {
+	file, valid := fileName(ps)
+	if !valid {
 		errorValidation(w)
 		return
 	}
 
+	err := s.fileStore.DeleteFile(r.Context(), file)
+	if err != nil {
+		errorInternal(w)
+		return
+	}
+
 	ok(w)
 }
 
-func (s *HttpServer) listen(router *httprouter.Router) error {
+func (s *HttpServer) listen(router http.Handler) error {
 	srv := http.Server{
 		Addr:              s.config.Address,
 		Handler:           router,
@@ -137,31 +266,86 @@ func (s *HttpServer) listen(router *httprouter.Router) error {
 		WriteTimeout:      0,
 	}
 
-	if s.config.CertFile != "" && s.config.PrivateKeyFile != "" {
-		srv.TLSConfig = &tls.Config{
-			PreferServerCipherSuites: true,
-			CurvePreferences: []tls.CurveID{
-				tls.CurveP256,
-				tls.X25519,
-			},
-			MinVersion: tls.VersionTLS12,
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
-				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			},
+	if s.config.ACME.enabled() {
+		return s.listenACME(&srv)
+	}
+
+	if s.config.ClientAuth.enabled() && !s.TLSEnabled() {
+		return fmt.Errorf("client certificates need HTTPS")
+	}
+
+	if s.TLSEnabled() {
+		srv.TLSConfig = newTLSConfig()
+
+		if s.config.ClientAuth.enabled() {
+			err := s.configureClientAuth(srv.TLSConfig)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := s.LoadCertificate(s.config.CertFile, s.config.PrivateKeyFile)
+		if err != nil {
+			return err
 		}
 
-		return srv.ListenAndServeTLS(s.config.CertFile, s.config.PrivateKeyFile)
+		srv.TLSConfig.GetCertificate = s.getCertificate
+
+		go s.watchCertificate()
+
+		return srv.ListenAndServeTLS("", "")
 	}
 
 	return srv.ListenAndServe()
 }
 
-func validFileName(str string) bool {
-	return fileRegexp.MatchString(str)
+func newTLSConfig() *tls.Config {
+	return &tls.Config{
+		PreferServerCipherSuites: true,
+		CurvePreferences: []tls.CurveID{
+			tls.CurveP256,
+			tls.X25519,
+		},
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		},
+	}
+}
+
+// TLSEnabled reports whether the server serves HTTPS with certificate from
+// configured files.
+func (s *HttpServer) TLSEnabled() bool {
+	return !s.config.ACME.enabled() && s.config.CertFile != "" && s.config.PrivateKeyFile != ""
+}
+
+// ACMEEnabled reports whether the server serves HTTPS with ACME certificates.
+func (s *HttpServer) ACMEEnabled() bool {
+	return s.config.ACME.enabled()
+}
+
+// TLSMode returns "acme", "files" or "off", as reported by health checks.
+func (s *HttpServer) TLSMode() string {
+	switch {
+	case s.ACMEEnabled():
+		return "acme"
+	case s.TLSEnabled():
+		return "files"
+	default:
+		return "off"
+	}
+}
+
+// fileName returns normalized file name from the request path, where it is
+// percent-encoded UTF-8.
+func fileName(ps httprouter.Params) (string, bool) {
+	file, err := application.NormalizeFileName(ps.ByName("file"))
+
+	return file, err == nil
 }
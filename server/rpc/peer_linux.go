@@ -0,0 +1,29 @@
+//go:build linux
+// +build linux
+
+package rpc
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerUID returns user id of process on the other end of Unix domain socket.
+func peerUID(conn *net.UnixConn) (uint32, bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return 0, false
+	}
+
+	return cred.Uid, true
+}
@@ -1,24 +1,57 @@
 package rpc
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"github.com/horizontal-org/direct-upload/application"
 	"github.com/horizontal-org/direct-upload/db"
 	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/rpc"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// MaxReadLength limits data returned by a single ReadFile call.
+const MaxReadLength = 4 * 1024 * 1024
+
 type Config struct {
+	// Path is Unix domain socket, ie. "unix:/run/direct-upload.sock", or TCP
+	// address.
 	Path string
+	// SocketMode of Unix domain socket, defaults to DefaultSocketMode.
+	SocketMode os.FileMode
+	// Secret shared by server and clients, required for TCP unless client
+	// certificates are required.
+	Secret string
+	TLS    *TLSConfig
 }
 
 //noinspection GoNameStartsWithPackageName
 type RpcServer struct {
 	config Config
 	am     *application.AuthManager
+	pm     *application.ProjectManager
+	wd     *application.WebhookDispatcher
+	pp     *application.ProcessingPipeline
+	fm     application.FileMetadataRepository
+	fs     application.FileStore
+	cr     Reloader
+	hc     HealthChecker
+	ca     *application.DeviceCA
+	audit  *application.AuditLog
+	ri     *application.ReceiptIssuer
+	ts     *application.Timestamper
 	bc     *db.BoltConnection
 	logger *zap.Logger
+	// actor identifies client of the connection in audit log.
+	actor string
 }
 
 type Response bool
@@ -33,55 +66,303 @@ type AddAuthRequest struct {
 	Password string
 }
 
+type RoleRequest struct {
+	Username string
+	Role     string
+}
+
+type DisabledRequest struct {
+	Username string
+	Disabled bool
+}
+
+type ExpiryRequest struct {
+	Username string
+	// Expires is zero for never.
+	Expires time.Time
+}
+
+type UploadWindowsRequest struct {
+	Username string
+	// Windows are parsed by application.ParseUploadWindow, none for any time.
+	Windows []string
+}
+
+// UserInfo describes account, PasswordHash is set only when explicitly
+// requested.
+type UserInfo struct {
+	Username      string
+	Role          string
+	Disabled      bool
+	Expires       time.Time
+	UploadWindows []string
+	PasswordHash  string
+}
+
+type ImportUsersRequest struct {
+	Users  []application.ImportUser
+	DryRun bool
+}
+
+// ImportUsersReply lists rows that are not valid, no user is created when
+// there are any.
+type ImportUsersReply struct {
+	Errors []application.ImportRowError
+}
+
+type ExportUsersRequest struct {
+	IncludeHashes bool
+}
+
+type ProjectRequest struct {
+	Project string
+}
+
+type ProjectMemberRequest struct {
+	Project  string
+	Username string
+	Role     string
+}
+
 type BackupAuthRequest struct {
 	Path string
 }
 
+type WebhookDeliveryRequest struct {
+	ID string
+}
+
+type FileRequest struct {
+	Username string
+	File     string
+}
+
+type ReadFileRequest struct {
+	Username string
+	File     string
+	Offset   int64
+	Length   int
+}
+
+type IssueCertificateRequest struct {
+	Username string
+	Device   string
+	// Days of validity, zero uses configured default.
+	Days int
+}
+
+type SerialRequest struct {
+	Serial string
+}
+
+type AuditListRequest struct {
+	// From is Seq of the first entry.
+	From uint64
+	// Limit of entries, zero for all.
+	Limit int
+	// Last lists the last entries instead, ignoring From.
+	Last int
+}
+
+// AuditVerifyReply describes the audit log chain, Head can be kept elsewhere to
+// later prove entries up to it were not changed.
+type AuditVerifyReply struct {
+	Head *application.AuditEntry
+	// Error describes where the chain is broken, empty if it's intact.
+	Error string
+}
+
+type ProcessingListRequest struct {
+	State application.ProcessingState
+}
+
+// ReloadReport lists settings applied by config reload and changed settings
+// that take effect only after restart.
+type ReloadReport struct {
+	Applied         []string
+	RestartRequired []string
+}
+
+// Reloader reloads configuration of the running server.
+type Reloader interface {
+	Reload() (*ReloadReport, error)
+}
+
+// HealthReport describes state of the running server.
+type HealthReport struct {
+	// TLS is "off", "files" for certificate loaded from files or "acme".
+	TLS         string
+	Certificate *CertificateHealth
+}
+
+// CertificateHealth describes certificate loaded from files.
+type CertificateHealth struct {
+	File     string
+	Names    []string
+	NotAfter time.Time
+	DaysLeft int
+}
+
+// HealthChecker reports health of the running server.
+type HealthChecker interface {
+	Health() *HealthReport
+}
+
 type SetAuthRequest AddAuthRequest
 type DelAuthRequest UsernameRequest
 type HasUsernameRequest UsernameRequest
 
-var ErrUsernameNotValid = errors.New("username not valid")
-var ErrUsernameExists = errors.New("username already exists")
+var ErrUsernameNotValid = application.ErrUsernameNotValid
+var ErrUsernameExists = application.ErrUsernameExists
+var ErrUsernameNotFound = application.ErrUsernameNotFound
+var ErrDeviceNotValid = errors.New("device name not valid")
+var ErrOffsetNotValid = errors.New("offset not valid")
 
-func StartRpcServer(config Config, authManager *application.AuthManager, bc *db.BoltConnection, logger *zap.Logger) {
+// Deps are services managed through the rpc server. DeviceCA, AuditLog,
+// ReceiptIssuer and Timestamper are nil when disabled, requests needing them
+// fail then.
+type Deps struct {
+	AuthManager        *application.AuthManager
+	ProjectManager     *application.ProjectManager
+	WebhookDispatcher  *application.WebhookDispatcher
+	ProcessingPipeline *application.ProcessingPipeline
+	FileMetadata       application.FileMetadataRepository
+	FileStore          application.FileStore
+	Reloader           Reloader
+	Health             HealthChecker
+	DeviceCA           *application.DeviceCA
+	AuditLog           *application.AuditLog
+	ReceiptIssuer      *application.ReceiptIssuer
+	Timestamper        *application.Timestamper
+	DB                 *db.BoltConnection
+}
+
+func StartRpcServer(config Config, deps Deps, logger *zap.Logger) {
 	srv := &RpcServer{
 		config: config,
-		am:     authManager,
-		bc:     bc,
+		am:     deps.AuthManager,
+		pm:     deps.ProjectManager,
+		wd:     deps.WebhookDispatcher,
+		pp:     deps.ProcessingPipeline,
+		fm:     deps.FileMetadata,
+		fs:     deps.FileStore,
+		cr:     deps.Reloader,
+		hc:     deps.Health,
+		ca:     deps.DeviceCA,
+		audit:  deps.AuditLog,
+		ri:     deps.ReceiptIssuer,
+		ts:     deps.Timestamper,
+		bc:     deps.DB,
 		logger: logger,
 	}
 
-	err := rpc.Register(srv)
+	listener, err := Listen(srv.config)
 	if err != nil {
-		srv.logger.Fatal("unable to register rpc server", zap.Error(err))
+		srv.logger.Fatal("rpc server unable to listen", zap.String("Path", srv.config.Path), zap.Error(err))
+	}
+
+	srv.logger.Sugar().Infof("Starting Tella RPC server on %s", config.Path)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			srv.logger.Fatal("rpc server unable to accept connection", zap.Error(err))
+		}
+
+		go srv.serveConn(conn)
+	}
+}
+
+// serveConn authenticates connection before serving rpc requests on it. Every
+// connection is served by its own copy of the server, which knows the actor
+// to record in audit log.
+func (a *RpcServer) serveConn(conn net.Conn) {
+	if !a.authenticate(conn) {
+		return
 	}
 
-	listener, err := net.Listen("tcp", srv.config.Path)
+	session := *a
+	session.actor = connActor(conn)
+
+	server := rpc.NewServer()
+
+	err := server.RegisterName("RpcServer", &session)
 	if err != nil {
-		srv.logger.Fatal("rpc server unable to listen", zap.String("Path", srv.config.Path), zap.Error(err))
+		a.logger.Error("unable to register rpc server", zap.Error(err))
+		_ = conn.Close()
+		return
 	}
 
-	srv.logger.Sugar().Infof("Starting Tella RPC server on %s", config.Path)
+	server.ServeConn(conn)
+}
 
-	rpc.Accept(listener)
+// authenticate checks shared secret, closing connection of unauthenticated
+// client.
+func (a *RpcServer) authenticate(conn net.Conn) bool {
+	if a.config.Secret == "" {
+		return true
+	}
+
+	err := serverHandshake(conn, []byte(a.config.Secret))
+	if err != nil {
+		a.logger.Warn("rpc client not authenticated",
+			zap.String("remote", conn.RemoteAddr().String()), zap.Error(err))
+		_ = conn.Close()
+		return false
+	}
+
+	return true
 }
 
-func (a *RpcServer) AddAuth(req *AddAuthRequest, _ *Response) error {
-	if !application.ValidUsername(req.Username) {
-		return ErrUsernameNotValid
+// connActor is "cert:<common name>" for client certificates, "local:<user>"
+// for Unix domain sockets and "rpc:<host>" for shared secret.
+func connActor(conn net.Conn) string {
+	switch c := conn.(type) {
+	case *tls.Conn:
+		// handshake is done before the first read, certificate is needed now
+		if c.Handshake() == nil {
+			if certs := c.ConnectionState().PeerCertificates; len(certs) > 0 {
+				return "cert:" + certs[0].Subject.CommonName
+			}
+		}
+
+		return "cert:unknown"
+	case *net.UnixConn:
+		uid, ok := peerUID(c)
+		if !ok {
+			return "local"
+		}
+
+		id := strconv.FormatUint(uint64(uid), 10)
+
+		if u, err := user.LookupId(id); err == nil {
+			return "local:" + u.Username
+		}
+
+		return "uid:" + id
 	}
 
-	exists, err := a.am.HasUsername(req.Username)
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
 	if err != nil {
-		return err
+		return "rpc"
 	}
 
-	if exists {
-		return ErrUsernameExists
+	return "rpc:" + host
+}
+
+// record writes successful action of the connection's client to audit log.
+func (a *RpcServer) record(err error, action, subject, detail string) error {
+	if err == nil {
+		a.audit.Record(a.actor, action, subject, detail)
 	}
 
-	return a.am.SetPassword(req.Username, req.Password)
+	return err
+}
+
+func (a *RpcServer) AddAuth(req *AddAuthRequest, _ *Response) error {
+	err := a.am.AddUser(req.Username, req.Password)
+
+	return a.record(err, application.AuditUserCreated, req.Username, "")
 }
 
 func (a *RpcServer) DelAuth(req *DelAuthRequest, _ *Response) error {
@@ -89,7 +370,9 @@ func (a *RpcServer) DelAuth(req *DelAuthRequest, _ *Response) error {
 		return ErrUsernameNotValid
 	}
 
-	return a.am.Delete(req.Username)
+	err := a.am.Delete(req.Username)
+
+	return a.record(err, application.AuditUserDeleted, req.Username, "")
 }
 
 func (a *RpcServer) SetAuth(req *SetAuthRequest, _ *Response) error {
@@ -97,7 +380,176 @@ func (a *RpcServer) SetAuth(req *SetAuthRequest, _ *Response) error {
 		return ErrUsernameNotValid
 	}
 
-	return a.am.SetPassword(req.Username, req.Password)
+	err := a.am.SetPassword(req.Username, req.Password)
+
+	return a.record(err, application.AuditPasswordChanged, req.Username, "")
+}
+
+func (a *RpcServer) SetRole(req *RoleRequest, _ *Response) error {
+	if !application.ValidUsername(req.Username) {
+		return ErrUsernameNotValid
+	}
+
+	err := a.am.SetRole(req.Username, req.Role)
+
+	return a.record(err, application.AuditRoleChanged, req.Username, req.Role)
+}
+
+func (a *RpcServer) SetDisabled(req *DisabledRequest, _ *Response) error {
+	if !application.ValidUsername(req.Username) {
+		return ErrUsernameNotValid
+	}
+
+	err := a.am.SetDisabled(req.Username, req.Disabled)
+
+	action := application.AuditUserEnabled
+	if req.Disabled {
+		action = application.AuditUserDisabled
+	}
+
+	return a.record(err, action, req.Username, "")
+}
+
+func (a *RpcServer) SetExpiry(req *ExpiryRequest, _ *Response) error {
+	if !application.ValidUsername(req.Username) {
+		return ErrUsernameNotValid
+	}
+
+	err := a.am.SetExpiry(req.Username, req.Expires)
+
+	detail := "never"
+	if !req.Expires.IsZero() {
+		detail = req.Expires.UTC().Format(time.RFC3339)
+	}
+
+	return a.record(err, application.AuditExpiryChanged, req.Username, detail)
+}
+
+func (a *RpcServer) SetUploadWindows(req *UploadWindowsRequest, _ *Response) error {
+	if !application.ValidUsername(req.Username) {
+		return ErrUsernameNotValid
+	}
+
+	var windows []application.UploadWindow
+
+	for _, spec := range req.Windows {
+		window, err := application.ParseUploadWindow(spec)
+		if err != nil {
+			return err
+		}
+
+		windows = append(windows, window)
+	}
+
+	err := a.am.SetUploadWindows(req.Username, windows)
+
+	return a.record(err, application.AuditWindowsChanged, req.Username, strings.Join(req.Windows, "; "))
+}
+
+func (a *RpcServer) GetUser(req *UsernameRequest, reply *UserInfo) error {
+	if !application.ValidUsername(req.Username) {
+		return ErrUsernameNotValid
+	}
+
+	userAuth, err := a.am.GetUserAuth(req.Username)
+	if err != nil {
+		return err
+	}
+
+	if userAuth == nil {
+		return application.ErrUsernameNotFound
+	}
+
+	*reply = userInfo(userAuth, false)
+
+	return nil
+}
+
+func (a *RpcServer) ImportUsers(req *ImportUsersRequest, reply *ImportUsersReply) error {
+	rowErrors, err := a.am.ImportUsers(req.Users, req.DryRun)
+	if err != nil {
+		return err
+	}
+
+	reply.Errors = rowErrors
+
+	if len(rowErrors) == 0 && !req.DryRun {
+		for _, user := range req.Users {
+			a.audit.Record(a.actor, application.AuditUserCreated, user.Username, "import")
+		}
+	}
+
+	return nil
+}
+
+func (a *RpcServer) ExportUsers(req *ExportUsersRequest, reply *[]UserInfo) error {
+	users := a.am.ListUsers()
+
+	if req.IncludeHashes {
+		a.logger.Warn("Password hashes exported", zap.Int("users", len(users)))
+	}
+
+	for i := range users {
+		*reply = append(*reply, userInfo(&users[i], req.IncludeHashes))
+	}
+
+	detail := ""
+	if req.IncludeHashes {
+		detail = "with password hashes"
+	}
+
+	a.audit.Record(a.actor, application.AuditUsersExported, "", detail)
+
+	return nil
+}
+
+func userInfo(userAuth *application.UserAuth, includeHash bool) UserInfo {
+	info := UserInfo{
+		Username: userAuth.Username,
+		Role:     userAuth.UserRole(),
+		Disabled: userAuth.Disabled,
+		Expires:  userAuth.Expires,
+	}
+
+	for _, window := range userAuth.UploadWindows {
+		info.UploadWindows = append(info.UploadWindows, window.String())
+	}
+
+	if includeHash {
+		info.PasswordHash = userAuth.PasswordHash
+	}
+
+	return info
+}
+
+func (a *RpcServer) CreateProject(req *ProjectRequest, _ *Response) error {
+	err := a.pm.Create(req.Project)
+
+	return a.record(err, application.AuditProjectCreated, req.Project, "")
+}
+
+func (a *RpcServer) DeleteProject(req *ProjectRequest, _ *Response) error {
+	err := a.pm.Delete(req.Project)
+
+	return a.record(err, application.AuditProjectDeleted, req.Project, "")
+}
+
+func (a *RpcServer) ListProjects(_ *Request, res *[]application.Project) error {
+	*res = a.pm.List()
+
+	return nil
+}
+
+func (a *RpcServer) AddProjectMember(req *ProjectMemberRequest, _ *Response) error {
+	err := a.pm.AddMember(req.Project, req.Username, req.Role)
+
+	return a.record(err, application.AuditMemberAdded, req.Project+"/"+req.Username, req.Role)
+}
+
+func (a *RpcServer) RemoveProjectMember(req *ProjectMemberRequest, _ *Response) error {
+	err := a.pm.RemoveMember(req.Project, req.Username)
+
+	return a.record(err, application.AuditMemberRemoved, req.Project+"/"+req.Username, "")
 }
 
 func (a *RpcServer) ListUsernames(_ *Request, res *[]string) error {
@@ -123,5 +575,364 @@ func (a *RpcServer) HasUsername(req *HasUsernameRequest, res *bool) error {
 }
 
 func (a *RpcServer) BackupDatabase(req *BackupAuthRequest, _ *Response) error {
-	return a.bc.Backup(a.logger, req.Path)
+	err := a.bc.Backup(a.logger, req.Path)
+
+	return a.record(err, application.AuditBackupWritten, req.Path, "")
+}
+
+func (a *RpcServer) ListFailedWebhooks(_ *Request, res *[]application.WebhookDelivery) error {
+	deliveries, err := a.wd.ListFailed()
+	if err != nil {
+		return err
+	}
+
+	*res = deliveries
+
+	return nil
+}
+
+func (a *RpcServer) ReplayWebhook(req *WebhookDeliveryRequest, _ *Response) error {
+	return a.wd.Replay(req.ID)
+}
+
+func (a *RpcServer) ProcessingStatus(req *FileRequest, res *application.ProcessingStatus) error {
+	file, err := fileOfUser(req.Username, req.File)
+	if err != nil {
+		return err
+	}
+
+	status, err := a.pp.Status(req.Username, file)
+	if err != nil {
+		return err
+	}
+
+	*res = *status
+
+	return nil
+}
+
+func (a *RpcServer) ListProcessing(req *ProcessingListRequest, res *[]application.ProcessingStatus) error {
+	statuses, err := a.pp.List(req.State)
+	if err != nil {
+		return err
+	}
+
+	*res = statuses
+
+	return nil
+}
+
+func (a *RpcServer) FileMetadata(req *FileRequest, res *application.FileMetadata) error {
+	file, err := fileOfUser(req.Username, req.File)
+	if err != nil {
+		return err
+	}
+
+	meta, err := a.fm.Read(req.Username, file)
+	if err != nil {
+		return err
+	}
+
+	if meta == nil {
+		return application.ErrNotFound
+	}
+
+	*res = *meta
+
+	return nil
+}
+
+// VerifyTimestamp checks trusted timestamp stored with file metadata against
+// the current content of the file.
+func (a *RpcServer) VerifyTimestamp(req *FileRequest, res *application.TimestampToken) error {
+	if a.ts == nil {
+		return application.ErrTimestampsDisabled
+	}
+
+	file, err := fileOfUser(req.Username, req.File)
+	if err != nil {
+		return err
+	}
+
+	meta, err := a.fm.Read(req.Username, file)
+	if err != nil {
+		return err
+	}
+
+	if meta == nil {
+		return application.ErrNotFound
+	}
+
+	token, err := a.ts.VerifyFile(userContext(req.Username), a.fs, meta)
+	if err != nil {
+		return err
+	}
+
+	*res = *token
+
+	return nil
+}
+
+// ListFiles returns all files of the user, including every version kept by
+// the version collision policy and uploads in progress.
+func (a *RpcServer) ListFiles(req *UsernameRequest, res *[]application.FileInfo) error {
+	if !validOwner(req.Username) {
+		return ErrUsernameNotValid
+	}
+
+	files, err := a.fs.ListFiles(userContext(req.Username))
+	if err != nil {
+		return err
+	}
+
+	*res = files
+
+	return nil
+}
+
+// ReadFile returns up to Length bytes of a closed file starting at Offset,
+// callers read the file in chunks until a short read.
+func (a *RpcServer) ReadFile(req *ReadFileRequest, res *[]byte) error {
+	file, err := fileOfUser(req.Username, req.File)
+	if err != nil {
+		return err
+	}
+
+	if req.Offset < 0 {
+		return ErrOffsetNotValid
+	}
+
+	if req.Length <= 0 || req.Length > MaxReadLength {
+		req.Length = MaxReadLength
+	}
+
+	r, err := a.fs.OpenFile(userContext(req.Username), file)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer r.Close()
+
+	if seeker, ok := r.(io.Seeker); ok {
+		_, err = seeker.Seek(req.Offset, io.SeekStart)
+	} else {
+		_, err = io.CopyN(ioutil.Discard, r, req.Offset)
+	}
+
+	if err == io.EOF {
+		*res = nil
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, req.Length)
+
+	n, err := io.ReadFull(r, data)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	*res = data[:n]
+
+	return nil
+}
+
+// fileOfUser validates owner and file name of requests reaching into user
+// or project folders, so they can't point outside of them. It returns the
+// normalized file name.
+func fileOfUser(username, file string) (string, error) {
+	if !validOwner(username) {
+		return "", ErrUsernameNotValid
+	}
+
+	return application.NormalizeFileName(file)
+}
+
+// validOwner accepts usernames and "@<project>" owners of project folders.
+func validOwner(owner string) bool {
+	return application.ValidUsername(owner) ||
+		strings.HasPrefix(owner, "@") && application.ValidProjectName(strings.TrimPrefix(owner, "@"))
+}
+
+func userContext(username string) context.Context {
+	return application.NewContext(context.Background(), &application.User{Username: username})
+}
+
+// DedupeFiles converts existing local storage to deduplicated one.
+func (a *RpcServer) DedupeFiles(_ *Request, res *application.DedupeStats) error {
+	store, ok := a.fs.(*application.LocalFileStore)
+	if !ok {
+		return application.ErrDedupeDisabled
+	}
+
+	stats, err := store.DedupeAll()
+	if err != nil {
+		return err
+	}
+
+	*res = *stats
+
+	return nil
+}
+
+func (a *RpcServer) ReloadConfig(_ *Request, res *ReloadReport) error {
+	report, err := a.cr.Reload()
+	if err != nil {
+		return err
+	}
+
+	*res = *report
+
+	return nil
+}
+
+func (a *RpcServer) Health(_ *Request, res *HealthReport) error {
+	*res = *a.hc.Health()
+
+	return nil
+}
+
+// IssueCertificate issues client certificate for an existing user's device.
+func (a *RpcServer) IssueCertificate(req *IssueCertificateRequest, res *application.IssuedCertificate) error {
+	if a.ca == nil {
+		return application.ErrDeviceCADisabled
+	}
+
+	if !application.ValidUsername(req.Username) {
+		return ErrUsernameNotValid
+	}
+
+	// device name is used in file names of the issued certificate
+	if !application.ValidUsername(req.Device) {
+		return ErrDeviceNotValid
+	}
+
+	exists, err := a.am.HasUsername(req.Username)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrUsernameNotFound
+	}
+
+	issued, err := a.ca.Issue(req.Username, req.Device, time.Duration(req.Days)*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	*res = *issued
+
+	a.audit.Record(a.actor, application.AuditCertificateIssued, req.Username+"/"+req.Device, issued.Serial)
+
+	return nil
+}
+
+// ListCertificates lists device certificates of user, or of all users for
+// empty username.
+func (a *RpcServer) ListCertificates(req *UsernameRequest, res *[]application.DeviceCertificate) error {
+	if a.ca == nil {
+		return application.ErrDeviceCADisabled
+	}
+
+	if req.Username != "" && !application.ValidUsername(req.Username) {
+		return ErrUsernameNotValid
+	}
+
+	*res = a.ca.List(req.Username)
+
+	return nil
+}
+
+func (a *RpcServer) RevokeCertificate(req *SerialRequest, res *application.DeviceCertificate) error {
+	if a.ca == nil {
+		return application.ErrDeviceCADisabled
+	}
+
+	cert, err := a.ca.Revoke(req.Serial)
+	if err != nil {
+		return err
+	}
+
+	*res = *cert
+
+	a.audit.Record(a.actor, application.AuditCertificateRevoked, cert.Username+"/"+cert.Device, cert.Serial)
+
+	return nil
+}
+
+func (a *RpcServer) ListAudit(req *AuditListRequest, res *[]application.AuditEntry) error {
+	if a.audit == nil {
+		return application.ErrAuditDisabled
+	}
+
+	from, limit := req.From, req.Limit
+
+	if req.Last > 0 {
+		from, limit = 1, req.Last
+
+		if lastSeq := a.audit.LastSeq(); lastSeq > uint64(req.Last) {
+			from = lastSeq - uint64(req.Last) + 1
+		}
+	}
+
+	*res = a.audit.List(from, limit)
+
+	return nil
+}
+
+func (a *RpcServer) VerifyAudit(_ *Request, res *AuditVerifyReply) error {
+	if a.audit == nil {
+		return application.ErrAuditDisabled
+	}
+
+	head, err := a.audit.Verify()
+	res.Head = head
+
+	if chainErr, ok := err.(*application.AuditChainError); ok {
+		res.Error = chainErr.Error()
+		return nil
+	}
+
+	return err
+}
+
+// GetReceipt returns stored receipt of a closed file.
+func (a *RpcServer) GetReceipt(req *FileRequest, res *application.Receipt) error {
+	if a.ri == nil {
+		return application.ErrReceiptsDisabled
+	}
+
+	file, err := fileOfUser(req.Username, req.File)
+	if err != nil {
+		return err
+	}
+
+	receipt, err := a.ri.Read(req.Username, file)
+	if err != nil {
+		return err
+	}
+
+	*res = *receipt
+
+	return nil
+}
+
+// ReceiptKey returns PEM encoded public key verifying receipts.
+func (a *RpcServer) ReceiptKey(_ *Request, res *[]byte) error {
+	if a.ri == nil {
+		return application.ErrReceiptsDisabled
+	}
+
+	key, err := application.MarshalReceiptPublicKey(a.ri.PublicKey())
+	if err != nil {
+		return err
+	}
+
+	*res = key
+
+	return nil
 }
@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"context"
+	"github.com/horizontal-org/direct-upload/application"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadFileStaysInUserFolder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direct-upload-rpc")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// secret outside of the files directory
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	logger := zaptest.NewLogger(t)
+
+	store, err := application.NewLocalFileStore(application.LocalFileStoreConfig{
+		Path: filepath.Join(dir, "files"),
+	}, application.NewEventBus(logger), logger)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	srv := &RpcServer{fs: store, logger: logger}
+
+	for _, req := range []ReadFileRequest{
+		{Username: "..", File: "secret"},
+		{Username: "alice", File: "../../secret"},
+	} {
+		var reply []byte
+
+		if err := srv.ReadFile(&req, &reply); err == nil || len(reply) > 0 {
+			t.Errorf("Expected %+v refused, got %q", req, reply)
+		}
+	}
+
+	var reply []byte
+
+	if err := srv.ReadFile(&ReadFileRequest{Username: "alice", File: "file", Offset: -1}, &reply); err != ErrOffsetNotValid {
+		t.Error("Expected negative offset refused, got", err)
+	}
+
+	if err := srv.ListFiles(&UsernameRequest{Username: ".."}, &[]application.FileInfo{}); err != ErrUsernameNotValid {
+		t.Error("Expected username refused, got", err)
+	}
+}
+
+func TestProjectOwnerFiles(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+
+	store := application.NewMemoryFileStore(application.MemoryFileStoreConfig{}, application.NewEventBus(logger), logger)
+
+	ctx := application.NewContext(context.Background(), &application.User{Username: "alice", Project: "inquiry"})
+
+	if err := store.AppendFile(ctx, "report.txt", ioutil.NopCloser(strings.NewReader("report"))); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if _, err := store.CloseFile(ctx, "report.txt"); err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	srv := &RpcServer{fs: store, logger: logger}
+
+	var files []application.FileInfo
+
+	if err := srv.ListFiles(&UsernameRequest{Username: "@inquiry"}, &files); err != nil || len(files) != 1 {
+		t.Errorf("Expected project file listed, got %+v %v", files, err)
+	}
+
+	var data []byte
+
+	if err := srv.ReadFile(&ReadFileRequest{Username: "@inquiry", File: "report.txt"}, &data); err != nil ||
+		string(data) != "report" {
+		t.Errorf("Expected project file read, got %q %v", data, err)
+	}
+
+	for _, owner := range []string{"@", "@..", "@@inquiry"} {
+		if err := srv.ListFiles(&UsernameRequest{Username: owner}, &files); err != ErrUsernameNotValid {
+			t.Errorf("Expected %q refused, got %v", owner, err)
+		}
+	}
+}
+
+func TestListAllCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direct-upload-rpc")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := zaptest.NewLogger(t)
+
+	ca, err := application.NewDeviceCA(application.DeviceCAConfig{Dir: dir}, &memDeviceCertRepo{
+		certs: map[string]application.DeviceCertificate{},
+	}, logger)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := ca.Issue(username, "phone", 0); err != nil {
+			t.Fatal("Error while running test", err)
+		}
+	}
+
+	srv := &RpcServer{ca: ca, logger: logger}
+
+	var certs []application.DeviceCertificate
+
+	if err := srv.ListCertificates(&UsernameRequest{}, &certs); err != nil || len(certs) != 2 {
+		t.Errorf("Expected all certificates listed, got %+v %v", certs, err)
+	}
+
+	if err := srv.ListCertificates(&UsernameRequest{Username: "alice"}, &certs); err != nil || len(certs) != 1 {
+		t.Errorf("Expected certificate of alice listed, got %+v %v", certs, err)
+	}
+
+	if err := srv.ListCertificates(&UsernameRequest{Username: ".."}, &certs); err != ErrUsernameNotValid {
+		t.Error("Expected username refused, got", err)
+	}
+}
+
+type memDeviceCertRepo struct {
+	certs map[string]application.DeviceCertificate
+}
+
+func (r *memDeviceCertRepo) Save(cert *application.DeviceCertificate) error {
+	r.certs[cert.Serial] = *cert
+	return nil
+}
+
+func (r *memDeviceCertRepo) Read(serial string) (*application.DeviceCertificate, error) {
+	cert, ok := r.certs[serial]
+	if !ok {
+		return nil, nil
+	}
+	return &cert, nil
+}
+
+func (r *memDeviceCertRepo) List() <-chan application.DeviceCertificate {
+	out := make(chan application.DeviceCertificate, len(r.certs))
+	for _, cert := range r.certs {
+		out <- cert
+	}
+	close(out)
+	return out
+}
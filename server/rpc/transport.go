@@ -0,0 +1,333 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// unixPrefix marks Unix domain socket addresses, ie. "unix:/run/direct-upload.sock".
+const unixPrefix = "unix:"
+
+// DefaultSocketMode allows only the user running the server to connect.
+const DefaultSocketMode = 0600
+
+const handshakeTimeout = 10 * time.Second
+
+const nonceLength = 32
+
+var ErrUnauthenticatedTCP = errors.New("rpc over tcp needs shared secret or client certificates")
+var errHandshake = errors.New("rpc authentication failed")
+
+// TLSConfig secures TCP transport. Server uses CertFile, KeyFile and
+// ClientCAFile to require client certificates, clients use CAFile,
+// ClientCertFile and ClientKeyFile.
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	CAFile         string
+	ClientCertFile string
+	ClientKeyFile  string
+	// ServerName defaults to host of the address.
+	ServerName string
+}
+
+func (c *TLSConfig) serverEnabled() bool {
+	return c != nil && c.CertFile != "" && c.KeyFile != "" && c.ClientCAFile != ""
+}
+
+func (c *TLSConfig) clientEnabled() bool {
+	return c != nil && c.ClientCertFile != "" && c.ClientKeyFile != ""
+}
+
+// splitAddress returns network and address for net.Listen and net.Dial.
+func splitAddress(address string) (string, string) {
+	if strings.HasPrefix(address, unixPrefix) {
+		return "unix", strings.TrimPrefix(strings.TrimPrefix(address, unixPrefix), "//")
+	}
+
+	return "tcp", strings.TrimPrefix(address, "tcp://")
+}
+
+// Listen returns listener for config.Path. Unix domain sockets are protected
+// by file permissions, TCP needs shared secret or client certificates.
+func Listen(config Config) (net.Listener, error) {
+	network, address := splitAddress(config.Path)
+
+	if network == "tcp" && config.Secret == "" && !config.TLS.serverEnabled() {
+		return nil, ErrUnauthenticatedTCP
+	}
+
+	var listener net.Listener
+	var err error
+
+	if network == "unix" {
+		listener, err = listenUnix(address, config.SocketMode)
+	} else {
+		listener, err = net.Listen(network, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config.TLS.serverEnabled() {
+		tlsConfig, err := config.TLS.server()
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	return listener, nil
+}
+
+// listenUnix binds socket under temporary name and moves it in place only
+// after its permissions are set, so it is never reachable with permissions
+// given by umask.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+
+	err := removeStaleSocket(path)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.%x", filepath.Base(path), suffix))
+
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	// the socket is unlinked by the next start, unlinking on close would
+	// remove the temporary name only
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	err = os.Chmod(tmp, mode)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	if err != nil {
+		_ = listener.Close()
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// removeStaleSocket removes socket left by a server that is not running.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is in use by running server", path)
+	}
+
+	return os.Remove(path)
+}
+
+func (c *TLSConfig) server() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := certPool(c.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (c *TLSConfig) client(address string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ServerName:   c.ServerName,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(address)
+	}
+
+	if c.CAFile != "" {
+		tlsConfig.RootCAs, err = certPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func certPool(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", file)
+	}
+
+	return pool, nil
+}
+
+// Dial connects to the rpc server the same way it listens, used by CLI
+// commands.
+func Dial(config Config) (*rpc.Client, error) {
+	network, address := splitAddress(config.Path)
+
+	conn, err := net.DialTimeout(network, address, handshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.TLS.clientEnabled() {
+		tlsConfig, err := config.TLS.client(address)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	if config.Secret != "" {
+		err = clientHandshake(conn, []byte(config.Secret))
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return rpc.NewClient(conn), nil
+}
+
+// Shared secret handshake is mutual challenge-response, the secret itself is
+// never sent and the client also verifies it talks to the server:
+//
+//	server -> client: server nonce
+//	client -> server: client nonce, HMAC(secret, "client", server nonce, client nonce)
+//	server -> client: HMAC(secret, "server", server nonce, client nonce)
+func serverHandshake(conn net.Conn, secret []byte) error {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	//noinspection GoUnhandledErrorResult
+	defer conn.SetDeadline(time.Time{})
+
+	serverNonce := make([]byte, nonceLength)
+	if _, err := rand.Read(serverNonce); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(serverNonce); err != nil {
+		return err
+	}
+
+	msg := make([]byte, nonceLength+sha256.Size)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return err
+	}
+
+	clientNonce, clientMAC := msg[:nonceLength], msg[nonceLength:]
+
+	if !hmac.Equal(clientMAC, handshakeMAC(secret, "client", serverNonce, clientNonce)) {
+		return errHandshake
+	}
+
+	_, err := conn.Write(handshakeMAC(secret, "server", serverNonce, clientNonce))
+
+	return err
+}
+
+func clientHandshake(conn net.Conn, secret []byte) error {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	//noinspection GoUnhandledErrorResult
+	defer conn.SetDeadline(time.Time{})
+
+	serverNonce := make([]byte, nonceLength)
+	if _, err := io.ReadFull(conn, serverNonce); err != nil {
+		return errHandshake
+	}
+
+	clientNonce := make([]byte, nonceLength)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return err
+	}
+
+	msg := append(append([]byte{}, clientNonce...), handshakeMAC(secret, "client", serverNonce, clientNonce)...)
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+
+	serverMAC := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, serverMAC); err != nil {
+		// server closes connection on wrong secret
+		return errHandshake
+	}
+
+	if !hmac.Equal(serverMAC, handshakeMAC(secret, "server", serverNonce, clientNonce)) {
+		return errHandshake
+	}
+
+	return nil
+}
+
+func handshakeMAC(secret []byte, role string, serverNonce, clientNonce []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("direct-upload-rpc " + role))
+	mac.Write(serverNonce)
+	mac.Write(clientNonce)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,281 @@
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"go.uber.org/zap/zaptest"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/rpc"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Echo struct{}
+
+func (Echo) Echo(req *string, res *string) error {
+	*res = *req
+	return nil
+}
+
+var registerEcho sync.Once
+
+// serve accepts connections like StartRpcServer until listener is closed.
+func serve(t *testing.T, config Config) net.Listener {
+	registerEcho.Do(func() {
+		if err := rpc.Register(Echo{}); err != nil {
+			t.Fatal("Error while running test", err)
+		}
+	})
+
+	listener, err := Listen(config)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	srv := &RpcServer{config: config, logger: zaptest.NewLogger(t)}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				if srv.authenticate(conn) {
+					rpc.ServeConn(conn)
+				}
+			}()
+		}
+	}()
+
+	return listener
+}
+
+func echo(config Config) error {
+	client, err := Dial(config)
+	if err != nil {
+		return err
+	}
+	//noinspection GoUnhandledErrorResult
+	defer client.Close()
+
+	req, res := "hello", ""
+
+	err = client.Call("Echo.Echo", &req, &res)
+	if err == nil && res != req {
+		return errHandshake
+	}
+
+	return err
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "direct-upload-rpc")
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	return dir
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	config := Config{Path: "unix:" + filepath.Join(dir, "rpc.sock")}
+
+	listener := serve(t, config)
+
+	info, err := os.Stat(filepath.Join(dir, "rpc.sock"))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	if info.Mode().Perm() != DefaultSocketMode {
+		t.Errorf("Expected socket mode %o, got %o", DefaultSocketMode, info.Mode().Perm())
+	}
+
+	if err := echo(config); err != nil {
+		t.Error("Error while running test", err)
+	}
+
+	if _, err := Listen(config); err == nil {
+		t.Error("Expected socket of running server not to be replaced")
+	}
+
+	_ = listener.Close()
+
+	// stale socket is replaced on next start
+	listener = serve(t, config)
+	defer listener.Close()
+
+	if err := echo(config); err != nil {
+		t.Error("Error while running test", err)
+	}
+}
+
+func TestUnixSocketActor(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	listener, err := Listen(Config{Path: "unix:" + filepath.Join(dir, "rpc.sock")})
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("unix", filepath.Join(dir, "rpc.sock"))
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer client.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+	defer conn.Close()
+
+	current, err := user.Current()
+	if err != nil {
+		t.Skip("Current user unknown", err)
+	}
+
+	if _, ok := peerUID(conn.(*net.UnixConn)); !ok {
+		t.Skip("Peer credentials not supported")
+	}
+
+	if actor := connActor(conn); actor != "local:"+current.Username {
+		t.Errorf("Expected actor local:%s, got %s", current.Username, actor)
+	}
+}
+
+func TestTCPNeedsAuthentication(t *testing.T) {
+	if _, err := Listen(Config{Path: "127.0.0.1:0"}); err != ErrUnauthenticatedTCP {
+		t.Errorf("Expected ErrUnauthenticatedTCP, got %v", err)
+	}
+}
+
+func TestSharedSecret(t *testing.T) {
+	listener := serve(t, Config{Path: "127.0.0.1:0", Secret: "s3cret"})
+	defer listener.Close()
+
+	address := listener.Addr().String()
+
+	if err := echo(Config{Path: address, Secret: "s3cret"}); err != nil {
+		t.Error("Error while running test", err)
+	}
+
+	if err := echo(Config{Path: address, Secret: "wrong"}); err != errHandshake {
+		t.Errorf("Expected handshake to fail with wrong secret, got %v", err)
+	}
+
+	if err := echo(Config{Path: address}); err == nil {
+		t.Error("Expected call without secret to fail")
+	}
+}
+
+// writeCert writes certificate signed by parent, or self-signed CA for nil
+// parent, and returns its files.
+func writeCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (string, string, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal("Error while running test", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+
+	_ = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	cert, _ := x509.ParseCertificate(der)
+
+	return certFile, keyFile, cert, key
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	caFile, _, ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	serverCert, serverKey, _, _ := writeCert(t, dir, "localhost", ca, caKey)
+	clientCert, clientKey, _, _ := writeCert(t, dir, "admin", ca, caKey)
+	otherCAFile, _, otherCA, otherCAKey := writeCert(t, dir, "other-ca", nil, nil)
+	otherCert, otherKey, _, _ := writeCert(t, dir, "intruder", otherCA, otherCAKey)
+
+	listener := serve(t, Config{Path: "localhost:0", TLS: &TLSConfig{
+		CertFile:     serverCert,
+		KeyFile:      serverKey,
+		ClientCAFile: caFile,
+	}})
+	defer listener.Close()
+
+	address := listener.Addr().String()
+
+	err := echo(Config{Path: address, TLS: &TLSConfig{
+		CAFile:         caFile,
+		ClientCertFile: clientCert,
+		ClientKeyFile:  clientKey,
+		ServerName:     "localhost",
+	}})
+	if err != nil {
+		t.Error("Error while running test", err)
+	}
+
+	err = echo(Config{Path: address, TLS: &TLSConfig{
+		CAFile:         caFile,
+		ClientCertFile: otherCert,
+		ClientKeyFile:  otherKey,
+		ServerName:     "localhost",
+	}})
+	if err == nil {
+		t.Error("Expected client certificate from other CA to be rejected")
+	}
+
+	err = echo(Config{Path: address, TLS: &TLSConfig{
+		CAFile:         otherCAFile,
+		ClientCertFile: clientCert,
+		ClientKeyFile:  clientKey,
+		ServerName:     "localhost",
+	}})
+	if err == nil {
+		t.Error("Expected server certificate from unknown CA to be rejected")
+	}
+}